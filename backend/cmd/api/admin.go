@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const grantAdminUsage = "usage: api grant-admin <email>"
+
+// runGrantAdmin handles `api grant-admin <email>`, which makes an existing
+// account an admin, and returns the process exit code. Admins cannot be
+// made through the API.
+func runGrantAdmin(db *sqlx.DB, queryTimeout time.Duration, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, grantAdminUsage)
+		return 2
+	}
+
+	users := repository.NewUserRepository(db, queryTimeout)
+	ctx := context.Background()
+	user, err := users.GetByEmail(ctx, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	if user.IsAdmin() {
+		fmt.Printf("%s is already an admin\n", user.Username)
+		return 0
+	}
+
+	user.Role = models.RoleAdmin
+	if err := users.Update(ctx, user); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s is now an admin; their next token carries the role\n", user.Username)
+	return 0
+}
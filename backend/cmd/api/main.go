@@ -6,125 +6,98 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"sync"
 	"syscall"
-	"time"
+	// Gig timezones must resolve even on images without /usr/share/zoneinfo.
+	_ "time/tzdata"
 
-	"sunyi-api/internal/handlers"
-	"sunyi-api/internal/middleware"
+	"sunyi-api/config"
+	"sunyi-api/internal/database"
+	"sunyi-api/internal/jwtkeys"
+	"sunyi-api/internal/mail"
 	"sunyi-api/internal/repository"
+	"sunyi-api/internal/repository/memory"
+	"sunyi-api/internal/server"
+	"sunyi-api/internal/storage"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/jmoiron/sqlx"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 func main() {
-	_ = godotenv.Load()
+	// Migrations run before the rest of the configuration is checked, so a
+	// fresh deployment can be migrated with only its database settings.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
 
-	if getEnv("ENV", "development") == "production" {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL required")
+	db, err := database.NewPostgresDB(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer db.Close()
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET required")
+	if len(os.Args) > 1 && os.Args[1] == "grant-admin" {
+		code := runGrantAdmin(db, cfg.Database.QueryTimeout, os.Args[2:])
+		db.Close()
+		os.Exit(code)
 	}
-	jwtExp := getEnv("JWT_EXPIRATION", "24h")
 
-	db, err := sqlx.Open("postgres", dsn)
+	blobs, err := storage.New(cfg.Uploads)
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		log.Fatal(err)
 	}
-	defer db.Close()
 
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	keys, err := jwtkeys.Load(cfg.JWT)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("failed to get database: %v", err)
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
 	}
-	log.Println("Connected to database")
-
-	userRepo := repository.NewUserRepository(db)
-	gigRepo := repository.NewGigRepository(db)
-
-	authHandler := handlers.NewAuthHandler(userRepo, jwtSecret, jwtExp)
-	gigHandler := handlers.NewGigHandler(gigRepo)
-
-	router := gin.Default()
-
-	allowedOrigins := strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:3000"), ",")
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     allowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
-			"time":   time.Now().Format(time.RFC3339),
-		})
-	})
-
-	api := router.Group("/api")
-	{
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
-			auth.GET("/me", middleware.AuthMiddleware(jwtSecret), authHandler.GetCurrentUser)
-		}
 
-		gigs := api.Group("/gigs")
-		{
-			gigs.GET("", gigHandler.GetAllGigs)
-			gigs.GET("/:id", gigHandler.GetGigByID)
-			gigs.GET("/organizer/:organizerId", gigHandler.GetGigsByOrganizer)
-
-			gigs.POST("", 
-				middleware.AuthMiddleware(jwtSecret), 
-				middleware.OrganizerOnly(), 
-				gigHandler.CreateGig,
-			)
-			gigs.PUT("/:id", 
-				middleware.AuthMiddleware(jwtSecret), 
-				middleware.OrganizerOnly(), 
-				gigHandler.UpdateGig,
-			)
-			gigs.DELETE("/:id", 
-				middleware.AuthMiddleware(jwtSecret), 
-				middleware.OrganizerOnly(), 
-				gigHandler.DeleteGig,
-			)
-		}
+	var loginAttempts repository.LoginAttemptStore = repository.NewLoginAttemptRepository(db, cfg.Database.QueryTimeout)
+	if cfg.Auth.Login.Store == "memory" {
+		loginAttempts = memory.NewLoginAttemptStore()
 	}
 
-	port := getEnv("PORT", "8080")
+	var background sync.WaitGroup
+	router := server.NewRouter(cfg, server.Stores{
+		Users:          repository.NewUserRepository(db, cfg.Database.QueryTimeout),
+		Gigs:           repository.NewGigRepository(db, cfg.Database.QueryTimeout),
+		Venues:         repository.NewVenueRepository(db, cfg.Database.QueryTimeout),
+		Artists:        repository.NewArtistRepository(db, cfg.Database.QueryTimeout),
+		Genres:         repository.NewGenreRepository(db, cfg.Database.QueryTimeout),
+		Sessions:       repository.NewSessionRepository(db, cfg.Database.QueryTimeout),
+		PasswordResets: repository.NewPasswordResetRepository(db, cfg.Database.QueryTimeout),
+		LoginAttempts:  loginAttempts,
+		Blobs:          blobs,
+		Mail:           mailer,
+		Background:     &background,
+	}, keys)
+
 	srv := &http.Server{
-		Addr:           ":" + port,
+		Addr:           ":" + cfg.Server.Port,
 		Handler:        router,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		IdleTimeout:    60 * time.Second,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
+		IdleTimeout:    cfg.Server.IdleTimeout,
 		MaxHeaderBytes: 1 << 20, // that's 1 mb
 	}
 
 	go func() {
-		log.Printf("Port: %s", port)
-		
+		log.Printf("Port: %s", cfg.Server.Port)
+
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("failed to start server: %v", err)
 		}
@@ -136,19 +109,24 @@ func main() {
 
 	log.Println("Server stopping. . .")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to stop: %v", err)
 	}
 
+	// Let mail already promised to callers go out, within the same limit.
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Stopped before background work finished")
+	}
+
 	log.Println("Server exited correctly")
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
\ No newline at end of file
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/database"
+)
+
+const migrateUsage = "usage: api migrate up [--default-timezone <zone>]|down|status|baseline <version>"
+
+// runMigrate handles `api migrate <command>` and returns the process exit
+// code. It reads only the database settings.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	defaultTimezone := flags.String("default-timezone", "",
+		"IANA zone to read the wall-clock times of gigs stored before timezones were tracked in")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	want := 0
+	if args[0] == "baseline" {
+		want = 1
+	}
+	if flags.NArg() != want {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	dbConfig, err := config.LoadDatabase()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := database.NewPostgresDB(dbConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load migrations: %v\n", err)
+		return 1
+	}
+	if *defaultTimezone != "" {
+		migrator.Set("app.default_timezone", *defaultTimezone)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+	case "down":
+		reverted, err := migrator.Down()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if reverted == nil {
+			fmt.Println("no migrations to revert")
+		} else {
+			fmt.Printf("reverted %04d_%s\n", reverted.Version, reverted.Name)
+		}
+
+	case "baseline":
+		version, err := strconv.Atoi(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		marked, err := migrator.Baseline(version)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, m := range marked {
+			fmt.Printf("marked %04d_%s as applied\n", m.Version, m.Name)
+		}
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
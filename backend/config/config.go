@@ -1,10 +1,20 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/goccy/go-yaml"
 	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
 )
 
 type Config struct {
@@ -12,73 +22,501 @@ type Config struct {
     Database DatabaseConfig
     JWT      JWTConfig
     CORS     CORSConfig
+    Uploads  UploadConfig
+    Mail     MailConfig
+    Auth     AuthConfig
 }
 
 type ServerConfig struct {
-    Port string
-    Env  string
+    Port            string
+    Env             string
+    ReadTimeout     time.Duration
+    WriteTimeout    time.Duration
+    IdleTimeout     time.Duration
+    ShutdownTimeout time.Duration
+    // TrustedProxies are the addresses or CIDR ranges whose
+    // X-Forwarded-For and X-Real-IP headers are believed. With none, the
+    // client address is always the connection's peer.
+    TrustedProxies  []string
 }
 
+// DatabaseConfig holds either a full URL or the discrete connection fields.
+// URL wins when both are set.
 type DatabaseConfig struct {
+    URL      string
     Host     string
     Port     string
     User     string
     Password string
     DBName   string
     SSLMode  string
+
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+    ConnMaxIdleTime time.Duration
+    ConnectTimeout  time.Duration
+    // QueryTimeout bounds every repository query unless the request's own
+    // context ends sooner.
+    QueryTimeout time.Duration
 }
 
+// JWTConfig sets how tokens are signed and how long they last. Secret is an
+// HS256 key; KeysDir holds further keys, one file each, and SigningKeyID
+// picks the one that signs. The rest only verify, which is how keys are
+// rotated. Expiration is the lifetime of an access token;
+// RefreshExpiration is how long a session may sit unused before its
+// refresh token stops working.
 type JWTConfig struct {
-    Secret     string
-    Expiration string
+    Secret            string
+    KeysDir           string
+    SigningKeyID      string
+    Issuer            string
+    Expiration        time.Duration
+    RefreshExpiration time.Duration
 }
 
 type CORSConfig struct {
     AllowedOrigins []string
+    MaxAge         time.Duration
+}
+
+// UploadConfig chooses where uploaded files are stored: "local" writes them
+// under Dir and serves them from /uploads, "s3" sends them to an
+// S3-compatible bucket.
+type UploadConfig struct {
+    Backend string
+    Dir     string
+    S3      S3Config
+}
+
+// S3Config addresses an S3-compatible bucket. PathStyle puts the bucket in
+// the path rather than the host name, which most self-hosted stores need.
+// PublicURL, when set, replaces the endpoint in the URLs handed to clients,
+// e.g. for a CDN in front of the bucket.
+type S3Config struct {
+    Endpoint        string
+    Region          string
+    Bucket          string
+    AccessKeyID     string
+    SecretAccessKey string
+    PathStyle       bool
+    PublicURL       string
+}
+
+// MailConfig chooses how email goes out: "smtp" delivers it, "file" writes
+// each message under Dir as an .eml file, and "memory" keeps it in process.
+// AppURL is the web app links in emails point into.
+type MailConfig struct {
+    Backend string
+    From    string
+    AppURL  string
+    Dir     string
+    SMTP    SMTPConfig
+}
+
+// SMTPConfig addresses the outgoing mail server. Username and Password are
+// only sent when Username is set.
+type SMTPConfig struct {
+    Host     string
+    Port     string
+    Username string
+    Password string
 }
 
+// AuthConfig holds account policy. RequireVerifiedEmail keeps organizers
+// from managing gigs, venues and artists until they verify their address.
+type AuthConfig struct {
+    RequireVerifiedEmail bool
+    Login                LoginThrottleConfig
+}
+
+// LoginThrottleConfig limits failed sign-ins. Each failure makes the
+// account wait Backoff, doubling per failure, before its next attempt, and
+// MaxFailures within Lockout lock it for Lockout. An IP address backs off
+// the same way once it has failed IPMaxFailures times within Lockout, over
+// any accounts. Store is "postgres", shared by every instance, or "memory".
+type LoginThrottleConfig struct {
+    Store         string
+    MaxFailures   int
+    Lockout       time.Duration
+    Backoff       time.Duration
+    IPMaxFailures int
+}
+
+// DSN returns the connection string for lib/pq. The fields are assembled
+// into a postgres:// URL, so characters such as spaces or quotes in a
+// password are escaped rather than read as syntax.
+func (d DatabaseConfig) DSN() string {
+    if d.URL != "" {
+        return d.URL
+    }
+    u := url.URL{
+        Scheme:   "postgres",
+        User:     url.UserPassword(d.User, d.Password),
+        Host:     net.JoinHostPort(d.Host, d.Port),
+        Path:     "/" + d.DBName,
+        RawQuery: url.Values{"sslmode": {d.SSLMode}}.Encode(),
+    }
+    return u.String()
+}
+
+func (c *Config) IsProduction() bool {
+    return c.Server.Env == "production"
+}
+
+// Load builds the configuration from, in increasing priority: defaults, the
+// YAML or TOML file named by CONFIG_FILE, a .env file, and the process
+// environment. The result is validated before it is returned.
 func Load() (*Config, error) {
-    // Load .env file if it exists
-    _ = godotenv.Load()
+    src, err := newSource()
+    if err != nil {
+        return nil, err
+    }
 
     config := &Config{
         Server: ServerConfig{
-            Port: getEnv("PORT", "8080"),
-            Env:  getEnv("ENV", "development"),
-        },
-        Database: DatabaseConfig{
-            Host:     getEnv("DB_HOST", "localhost"),
-            Port:     getEnv("DB_PORT", "5432"),
-            User:     getEnv("DB_USER", "postgres"),
-            Password: getEnv("DB_PASSWORD", ""),
-            DBName:   getEnv("DB_NAME", "sunyi_db"),
-            SSLMode:  getEnv("DB_SSLMODE", "disable"),
+            Port:            src.str("PORT", "server.port", "8080"),
+            Env:             src.str("ENV", "server.env", "development"),
+            ReadTimeout:     src.duration("SERVER_READ_TIMEOUT", "server.read_timeout", "10s"),
+            WriteTimeout:    src.duration("SERVER_WRITE_TIMEOUT", "server.write_timeout", "10s"),
+            IdleTimeout:     src.duration("SERVER_IDLE_TIMEOUT", "server.idle_timeout", "60s"),
+            ShutdownTimeout: src.duration("SERVER_SHUTDOWN_TIMEOUT", "server.shutdown_timeout", "10s"),
+            TrustedProxies:  src.list("TRUSTED_PROXIES", "server.trusted_proxies", ""),
         },
+        Database: src.database(),
         JWT: JWTConfig{
-            Secret:     getEnv("JWT_SECRET", ""),
-            Expiration: getEnv("JWT_EXPIRATION", "24h"),
+            Secret:            src.str("JWT_SECRET", "jwt.secret", ""),
+            KeysDir:           src.str("JWT_KEYS_DIR", "jwt.keys_dir", ""),
+            SigningKeyID:      src.str("JWT_SIGNING_KEY_ID", "jwt.signing_key_id", ""),
+            Issuer:            src.str("JWT_ISSUER", "jwt.issuer", "sunyi-api"),
+            Expiration:        src.duration("JWT_EXPIRATION", "jwt.expiration", "15m"),
+            RefreshExpiration: src.duration("JWT_REFRESH_EXPIRATION", "jwt.refresh_expiration", "720h"),
         },
         CORS: CORSConfig{
-            AllowedOrigins: []string{
-                getEnv("ALLOWED_ORIGINS", "http://localhost:3000"),
+            AllowedOrigins: src.list("ALLOWED_ORIGINS", "cors.allowed_origins", "http://localhost:3000"),
+            MaxAge:         src.duration("CORS_MAX_AGE", "cors.max_age", "12h"),
+        },
+        Uploads: UploadConfig{
+            Backend: src.str("UPLOAD_BACKEND", "uploads.backend", "local"),
+            Dir:     src.str("UPLOAD_DIR", "uploads.dir", "uploads"),
+            S3: S3Config{
+                Endpoint:        src.str("S3_ENDPOINT", "uploads.s3.endpoint", ""),
+                Region:          src.str("S3_REGION", "uploads.s3.region", "us-east-1"),
+                Bucket:          src.str("S3_BUCKET", "uploads.s3.bucket", ""),
+                AccessKeyID:     src.str("S3_ACCESS_KEY_ID", "uploads.s3.access_key_id", ""),
+                SecretAccessKey: src.str("S3_SECRET_ACCESS_KEY", "uploads.s3.secret_access_key", ""),
+                PathStyle:       src.bool("S3_PATH_STYLE", "uploads.s3.path_style", "false"),
+                PublicURL:       src.str("S3_PUBLIC_URL", "uploads.s3.public_url", ""),
+            },
+        },
+        Mail: MailConfig{
+            Backend: src.str("MAIL_BACKEND", "mail.backend", "file"),
+            From:    src.str("MAIL_FROM", "mail.from", "Sunyi <no-reply@localhost>"),
+            AppURL:  src.str("APP_URL", "mail.app_url", "http://localhost:3000"),
+            Dir:     src.str("MAIL_DIR", "mail.dir", "mail"),
+            SMTP: SMTPConfig{
+                Host:     src.str("SMTP_HOST", "mail.smtp.host", ""),
+                Port:     src.str("SMTP_PORT", "mail.smtp.port", "587"),
+                Username: src.str("SMTP_USERNAME", "mail.smtp.username", ""),
+                Password: src.str("SMTP_PASSWORD", "mail.smtp.password", ""),
+            },
+        },
+        Auth: AuthConfig{
+            RequireVerifiedEmail: src.bool("REQUIRE_VERIFIED_EMAIL", "auth.require_verified_email", "true"),
+            Login: LoginThrottleConfig{
+                Store:         src.str("LOGIN_ATTEMPT_STORE", "auth.login.store", "postgres"),
+                MaxFailures:   src.int("LOGIN_MAX_FAILURES", "auth.login.max_failures", "5"),
+                Lockout:       src.duration("LOGIN_LOCKOUT", "auth.login.lockout", "15m"),
+                Backoff:       src.duration("LOGIN_BACKOFF", "auth.login.backoff", "1s"),
+                IPMaxFailures: src.int("LOGIN_IP_MAX_FAILURES", "auth.login.ip_max_failures", "30"),
             },
         },
     }
 
-    // Validate required fields
-    if config.Database.Password == "" {
-        return nil, fmt.Errorf("DB_PASSWORD is required")
-    }
-    if config.JWT.Secret == "" {
-        return nil, fmt.Errorf("JWT_SECRET is required")
+    if err := errors.Join(append(src.errs, config.Validate())...); err != nil {
+        return nil, fmt.Errorf("invalid configuration: %w", err)
     }
 
     return config, nil
 }
 
-func getEnv(key, defaultValue string) string {
-    if value := os.Getenv(key); value != "" {
+// LoadDatabase reads only the database settings, from the same sources as
+// Load, for commands such as migrate that need nothing else.
+func LoadDatabase() (DatabaseConfig, error) {
+    src, err := newSource()
+    if err != nil {
+        return DatabaseConfig{}, err
+    }
+    db := src.database()
+    if err := errors.Join(append(src.errs, db.Validate())...); err != nil {
+        return DatabaseConfig{}, fmt.Errorf("invalid configuration: %w", err)
+    }
+    return db, nil
+}
+
+// newSource loads a .env file and the file named by CONFIG_FILE, if there
+// are any.
+func newSource() (*source, error) {
+    // Load .env file if it exists
+    _ = godotenv.Load()
+
+    src := &source{}
+    if path := os.Getenv("CONFIG_FILE"); path != "" {
+        file, err := readFile(path)
+        if err != nil {
+            return nil, err
+        }
+        src.file = file
+    }
+    return src, nil
+}
+
+func (s *source) database() DatabaseConfig {
+    return DatabaseConfig{
+        URL:      s.str("DATABASE_URL", "database.url", ""),
+        Host:     s.str("DB_HOST", "database.host", "localhost"),
+        Port:     s.str("DB_PORT", "database.port", "5432"),
+        User:     s.str("DB_USER", "database.user", "postgres"),
+        Password: s.str("DB_PASSWORD", "database.password", ""),
+        DBName:   s.str("DB_NAME", "database.name", "sunyi_db"),
+        SSLMode:  s.str("DB_SSLMODE", "database.sslmode", "disable"),
+
+        MaxOpenConns:    s.int("DB_MAX_OPEN_CONNS", "database.max_open_conns", "25"),
+        MaxIdleConns:    s.int("DB_MAX_IDLE_CONNS", "database.max_idle_conns", "5"),
+        ConnMaxLifetime: s.duration("DB_CONN_MAX_LIFETIME", "database.conn_max_lifetime", "5m"),
+        ConnMaxIdleTime: s.duration("DB_CONN_MAX_IDLE_TIME", "database.conn_max_idle_time", "5m"),
+        ConnectTimeout:  s.duration("DB_CONNECT_TIMEOUT", "database.connect_timeout", "5s"),
+        QueryTimeout:    s.duration("DB_QUERY_TIMEOUT", "database.query_timeout", "5s"),
+    }
+}
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+
+    port, err := strconv.Atoi(c.Server.Port)
+    check(err == nil && port > 0 && port < 65536, "PORT must be a port number, got %q", c.Server.Port)
+    check(c.Server.Env == "development" || c.Server.Env == "production" || c.Server.Env == "test",
+        "ENV must be development, production or test, got %q", c.Server.Env)
+    check(c.Server.ReadTimeout > 0, "SERVER_READ_TIMEOUT must be positive")
+    check(c.Server.WriteTimeout > 0, "SERVER_WRITE_TIMEOUT must be positive")
+    check(c.Server.IdleTimeout > 0, "SERVER_IDLE_TIMEOUT must be positive")
+    check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT must be positive")
+    for _, proxy := range c.Server.TrustedProxies {
+        _, _, cidrErr := net.ParseCIDR(proxy)
+        check(cidrErr == nil || net.ParseIP(proxy) != nil,
+            "TRUSTED_PROXIES entry %q must be an IP address or CIDR range", proxy)
+    }
+
+    if err := c.Database.Validate(); err != nil {
+        errs = append(errs, err)
+    }
+
+    check(c.JWT.Secret != "" || c.JWT.KeysDir != "", "JWT_SECRET or JWT_KEYS_DIR is required")
+    check(c.JWT.Secret != "" || c.JWT.SigningKeyID != "", "JWT_SIGNING_KEY_ID is required when JWT_SECRET is not set")
+    if c.IsProduction() && c.JWT.Secret != "" {
+        check(len(c.JWT.Secret) >= 32, "JWT_SECRET must be at least 32 bytes in production")
+    }
+    check(c.JWT.Issuer != "", "JWT_ISSUER must not be empty")
+    check(c.JWT.Expiration > 0, "JWT_EXPIRATION must be positive")
+    check(c.JWT.RefreshExpiration > c.JWT.Expiration, "JWT_REFRESH_EXPIRATION must be longer than JWT_EXPIRATION")
+
+    check(len(c.CORS.AllowedOrigins) > 0, "ALLOWED_ORIGINS must list at least one origin")
+    for _, origin := range c.CORS.AllowedOrigins {
+        // Credentials are allowed, so a wildcard origin would be rejected by browsers.
+        u, err := url.Parse(origin)
+        check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "",
+            "ALLOWED_ORIGINS entry %q must be a scheme://host origin", origin)
+    }
+    check(c.CORS.MaxAge >= 0, "CORS_MAX_AGE must not be negative")
+
+    switch c.Uploads.Backend {
+    case "local":
+        check(c.Uploads.Dir != "", "UPLOAD_DIR is required")
+    case "s3":
+        s3 := c.Uploads.S3
+        u, err := url.Parse(s3.Endpoint)
+        check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+            "S3_ENDPOINT must be an http(s) URL, got %q", s3.Endpoint)
+        check(s3.Region != "", "S3_REGION is required")
+        check(s3.Bucket != "", "S3_BUCKET is required")
+        check(s3.AccessKeyID != "" && s3.SecretAccessKey != "",
+            "S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+        if s3.PublicURL != "" {
+            u, err := url.Parse(s3.PublicURL)
+            check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+                "S3_PUBLIC_URL must be an http(s) URL, got %q", s3.PublicURL)
+        }
+    default:
+        check(false, "UPLOAD_BACKEND must be local or s3, got %q", c.Uploads.Backend)
+    }
+
+    _, err = mail.ParseAddress(c.Mail.From)
+    check(err == nil, "MAIL_FROM must be an email address, got %q", c.Mail.From)
+    u, err := url.Parse(c.Mail.AppURL)
+    check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+        "APP_URL must be an http(s) URL, got %q", c.Mail.AppURL)
+    switch c.Mail.Backend {
+    case "smtp":
+        check(c.Mail.SMTP.Host != "", "SMTP_HOST is required")
+        smtpPort, err := strconv.Atoi(c.Mail.SMTP.Port)
+        check(err == nil && smtpPort > 0 && smtpPort < 65536, "SMTP_PORT must be a port number, got %q", c.Mail.SMTP.Port)
+    case "file":
+        check(c.Mail.Dir != "", "MAIL_DIR is required")
+    case "memory":
+    default:
+        check(false, "MAIL_BACKEND must be smtp, file or memory, got %q", c.Mail.Backend)
+    }
+    // Nobody would receive a verification link.
+    check(!c.IsProduction() || c.Mail.Backend == "smtp", "MAIL_BACKEND must be smtp in production")
+
+    login := c.Auth.Login
+    check(login.Store == "postgres" || login.Store == "memory",
+        "LOGIN_ATTEMPT_STORE must be postgres or memory, got %q", login.Store)
+    check(login.MaxFailures > 0, "LOGIN_MAX_FAILURES must be positive")
+    check(login.Lockout > 0, "LOGIN_LOCKOUT must be positive")
+    check(login.Backoff >= 0, "LOGIN_BACKOFF must not be negative")
+    check(login.IPMaxFailures > 0, "LOGIN_IP_MAX_FAILURES must be positive")
+
+    return errors.Join(errs...)
+}
+
+// Validate reports every problem with the database settings at once.
+func (db DatabaseConfig) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+
+    if db.URL != "" {
+        u, err := url.Parse(db.URL)
+        check(err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql"),
+            "DATABASE_URL must be a postgres:// URL")
+    } else {
+        check(db.Host != "", "DB_HOST is required when DATABASE_URL is not set")
+        check(db.User != "", "DB_USER is required when DATABASE_URL is not set")
+        check(db.Password != "", "DB_PASSWORD is required when DATABASE_URL is not set")
+        check(db.DBName != "", "DB_NAME is required when DATABASE_URL is not set")
+        dbPort, err := strconv.Atoi(db.Port)
+        check(err == nil && dbPort > 0 && dbPort < 65536, "DB_PORT must be a port number, got %q", db.Port)
+    }
+    check(db.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be positive")
+    check(db.MaxIdleConns >= 0 && db.MaxIdleConns <= db.MaxOpenConns,
+        "DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+    check(db.ConnMaxLifetime > 0, "DB_CONN_MAX_LIFETIME must be positive")
+    check(db.ConnMaxIdleTime > 0, "DB_CONN_MAX_IDLE_TIME must be positive")
+    check(db.ConnectTimeout > 0, "DB_CONNECT_TIMEOUT must be positive")
+    check(db.QueryTimeout > 0, "DB_QUERY_TIMEOUT must be positive")
+
+    return errors.Join(errs...)
+}
+
+// source resolves a setting from the environment, then the config file,
+// then its default, collecting parse errors as it goes.
+type source struct {
+    file map[string]string
+    errs []error
+}
+
+func (s *source) str(envKey, fileKey, defaultValue string) string {
+    if value := os.Getenv(envKey); value != "" {
+        return value
+    }
+    if value, ok := s.file[fileKey]; ok && value != "" {
         return value
     }
     return defaultValue
-}
\ No newline at end of file
+}
+
+func (s *source) int(envKey, fileKey, defaultValue string) int {
+    raw := s.str(envKey, fileKey, defaultValue)
+    n, err := strconv.Atoi(raw)
+    if err != nil {
+        s.errs = append(s.errs, fmt.Errorf("%s: invalid integer %q", envKey, raw))
+    }
+    return n
+}
+
+func (s *source) duration(envKey, fileKey, defaultValue string) time.Duration {
+    raw := s.str(envKey, fileKey, defaultValue)
+    d, err := time.ParseDuration(raw)
+    if err != nil {
+        s.errs = append(s.errs, fmt.Errorf("%s: invalid duration %q", envKey, raw))
+    }
+    return d
+}
+
+func (s *source) bool(envKey, fileKey, defaultValue string) bool {
+    raw := s.str(envKey, fileKey, defaultValue)
+    b, err := strconv.ParseBool(raw)
+    if err != nil {
+        s.errs = append(s.errs, fmt.Errorf("%s: invalid boolean %q", envKey, raw))
+    }
+    return b
+}
+
+// list splits a comma-separated value, dropping blanks.
+func (s *source) list(envKey, fileKey, defaultValue string) []string {
+    var out []string
+    for _, item := range strings.Split(s.str(envKey, fileKey, defaultValue), ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            out = append(out, item)
+        }
+    }
+    return out
+}
+
+// readFile decodes a YAML or TOML file, chosen by extension, into dotted
+// keys such as "database.max_open_conns". Lists become comma-separated.
+func readFile(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("read config file: %w", err)
+    }
+
+    var tree map[string]interface{}
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, &tree)
+    case ".toml":
+        err = toml.Unmarshal(data, &tree)
+    default:
+        return nil, fmt.Errorf("config file %s: unsupported extension, use .yaml, .yml or .toml", path)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("parse config file %s: %w", path, err)
+    }
+
+    flat := map[string]string{}
+    flatten("", tree, flat)
+    return flat, nil
+}
+
+func flatten(prefix string, value interface{}, out map[string]string) {
+    switch v := value.(type) {
+    case map[string]interface{}:
+        for key, child := range v {
+            if prefix != "" {
+                key = prefix + "." + key
+            }
+            flatten(key, child, out)
+        }
+    case []interface{}:
+        items := make([]string, len(v))
+        for i, item := range v {
+            items[i] = fmt.Sprint(item)
+        }
+        out[prefix] = strings.Join(items, ",")
+    case nil:
+    default:
+        out[prefix] = fmt.Sprint(v)
+    }
+}
@@ -0,0 +1,149 @@
+// Package apperr defines the domain errors shared by repositories, handlers
+// and the error middleware. Each *Error wraps one of the sentinel kinds so
+// callers can test with errors.Is and the middleware can pick a status.
+package apperr
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+    ErrNotFound             = errors.New("not found")
+    ErrConflict             = errors.New("conflict")
+    ErrValidation           = errors.New("validation failed")
+    ErrForbidden            = errors.New("forbidden")
+    ErrUnauthorized         = errors.New("unauthorized")
+    ErrTooLarge             = errors.New("payload too large")
+    ErrUnsupported          = errors.New("unsupported media type")
+    // ErrPrecondition means a conditional request (If-Match) failed.
+    ErrPrecondition         = errors.New("precondition failed")
+    // ErrPreconditionRequired means a conditional header was missing.
+    ErrPreconditionRequired = errors.New("precondition required")
+    ErrTooManyRequests      = errors.New("too many requests")
+)
+
+// Machine-readable codes sent to clients alongside the message.
+const (
+    CodeNotFound             = "not_found"
+    CodeConflict             = "conflict"
+    CodeValidation           = "validation_failed"
+    CodeForbidden            = "forbidden"
+    CodeUnauthorized         = "unauthorized"
+    CodeTooLarge             = "payload_too_large"
+    CodeUnsupported          = "unsupported_media_type"
+    CodePrecondition         = "precondition_failed"
+    CodePreconditionRequired = "precondition_required"
+    CodeTooManyRequests      = "too_many_requests"
+    // CodeAccountLocked means too many sign-ins failed and the account is
+    // locked for a while; an admin can lift it sooner.
+    CodeAccountLocked        = "account_locked"
+    CodeInternal             = "internal_error"
+    CodeCanceled             = "request_canceled"
+    CodeTimeout              = "timeout"
+    // CodeSessionEnded tells a client its session was revoked or expired
+    // and refreshing will not help; it has to sign in again.
+    CodeSessionEnded         = "session_ended"
+    CodeRefreshTokenReused   = "refresh_token_reused"
+    // CodeEmailUnverified means the action needs a verified email address.
+    CodeEmailUnverified      = "email_unverified"
+    CodeEmailVerified        = "email_already_verified"
+    // CodeInvalidToken means an emailed link is malformed, expired or spent.
+    CodeInvalidToken         = "invalid_token"
+)
+
+type Error struct {
+    Kind    error
+    Code    string
+    Message string
+    // Field names the input field at fault, when there is exactly one.
+    Field string
+    // Fields maps each invalid input field to the rule it broke.
+    Fields map[string]string
+    // RetryAfter says how long a throttled client should wait.
+    RetryAfter time.Duration
+    // Err is the underlying cause, if any. It is never shown to clients.
+    Err error
+}
+
+func (e *Error) Error() string {
+    if e.Err != nil {
+        return e.Message + ": " + e.Err.Error()
+    }
+    return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+    if e.Err != nil {
+        return []error{e.Kind, e.Err}
+    }
+    return []error{e.Kind}
+}
+
+// NotFound reports a missing resource, e.g. NotFound("gig") reads "Gig not found".
+func NotFound(resource string) *Error {
+    return &Error{Kind: ErrNotFound, Code: CodeNotFound, Message: capitalize(resource) + " not found"}
+}
+
+// Conflict reports a clash with existing state on field.
+func Conflict(field, message string) *Error {
+    return &Error{Kind: ErrConflict, Code: CodeConflict, Field: field, Message: message}
+}
+
+func Validation(message string) *Error {
+    return &Error{Kind: ErrValidation, Code: CodeValidation, Message: message}
+}
+
+// InvalidField reports a single bad input field.
+func InvalidField(field, message string) *Error {
+    return &Error{Kind: ErrValidation, Code: CodeValidation, Field: field, Message: message}
+}
+
+func Forbidden(message string) *Error {
+    return &Error{Kind: ErrForbidden, Code: CodeForbidden, Message: message}
+}
+
+func Unauthorized(message string) *Error {
+    return &Error{Kind: ErrUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+func TooLarge(message string) *Error {
+    return &Error{Kind: ErrTooLarge, Code: CodeTooLarge, Message: message}
+}
+
+func UnsupportedMediaType(message string) *Error {
+    return &Error{Kind: ErrUnsupported, Code: CodeUnsupported, Message: message}
+}
+
+func PreconditionFailed(message string) *Error {
+    return &Error{Kind: ErrPrecondition, Code: CodePrecondition, Message: message}
+}
+
+func PreconditionRequired(message string) *Error {
+    return &Error{Kind: ErrPreconditionRequired, Code: CodePreconditionRequired, Message: message}
+}
+
+// TooManyRequests reports throttling; retryAfter becomes the Retry-After header.
+func TooManyRequests(message string, retryAfter time.Duration) *Error {
+    return &Error{Kind: ErrTooManyRequests, Code: CodeTooManyRequests, Message: message, RetryAfter: retryAfter}
+}
+
+// WithCode overrides the generic code with a more specific one.
+func (e *Error) WithCode(code string) *Error {
+    e.Code = code
+    return e
+}
+
+// Wrap records the cause of e.
+func (e *Error) Wrap(err error) *Error {
+    e.Err = err
+    return e
+}
+
+func capitalize(s string) string {
+    if s == "" {
+        return s
+    }
+    return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,299 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID keys the advisory lock that serialises concurrent
+// migrators against the same database.
+const migrationLockID = 7237104
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+    Version int
+    Name    string
+    Up      string
+    Down    string
+}
+
+type MigrationStatus struct {
+    Migration
+    AppliedAt *time.Time
+}
+
+type Migrator struct {
+    db         *sqlx.DB
+    migrations []Migration
+    settings   map[string]string
+}
+
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+    migrations, err := loadMigrations(migrationFiles)
+    if err != nil {
+        return nil, err
+    }
+    return &Migrator{db: db, migrations: migrations, settings: map[string]string{}}, nil
+}
+
+// Set gives a custom setting, such as app.default_timezone, a value for the
+// transactions migrations run in, where current_setting reads it.
+func (m *Migrator) Set(name, value string) {
+    m.settings[name] = value
+}
+
+// loadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs, sorted
+// by version. Every version needs both halves.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+    entries, err := fs.ReadDir(fsys, "migrations")
+    if err != nil {
+        return nil, err
+    }
+
+    byVersion := map[int]*Migration{}
+    for _, entry := range entries {
+        m := migrationName.FindStringSubmatch(entry.Name())
+        if m == nil {
+            return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+        }
+        version, _ := strconv.Atoi(m[1])
+        body, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+        if err != nil {
+            return nil, err
+        }
+
+        mig, ok := byVersion[version]
+        if !ok {
+            mig = &Migration{Version: version, Name: m[2]}
+            byVersion[version] = mig
+        } else if mig.Name != m[2] {
+            return nil, fmt.Errorf("migration %d has two names: %q and %q", version, mig.Name, m[2])
+        }
+        if m[3] == "up" {
+            mig.Up = string(body)
+        } else {
+            mig.Down = string(body)
+        }
+    }
+
+    migrations := make([]Migration, 0, len(byVersion))
+    for _, mig := range byVersion {
+        if mig.Up == "" || mig.Down == "" {
+            return nil, fmt.Errorf("migration %d_%s needs both up and down files", mig.Version, mig.Name)
+        }
+        migrations = append(migrations, *mig)
+    }
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Version < migrations[j].Version
+    })
+
+    return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+    _, err := m.db.Exec(`
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version    INTEGER PRIMARY KEY,
+            name       TEXT        NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )
+    `)
+    return err
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+    var rows []struct {
+        Version   int       `db:"version"`
+        AppliedAt time.Time `db:"applied_at"`
+    }
+    if err := m.db.Select(&rows, `SELECT version, applied_at FROM schema_migrations`); err != nil {
+        return nil, err
+    }
+    applied := make(map[int]time.Time, len(rows))
+    for _, row := range rows {
+        applied[row.Version] = row.AppliedAt
+    }
+    return applied, nil
+}
+
+// Status lists every known migration and when it was applied, if at all.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+    if err := m.ensureTable(); err != nil {
+        return nil, err
+    }
+    applied, err := m.applied()
+    if err != nil {
+        return nil, err
+    }
+
+    statuses := make([]MigrationStatus, len(m.migrations))
+    for i, mig := range m.migrations {
+        statuses[i] = MigrationStatus{Migration: mig}
+        if at, ok := applied[mig.Version]; ok {
+            statuses[i].AppliedAt = &at
+        }
+    }
+    return statuses, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones it applied.
+func (m *Migrator) Up() ([]Migration, error) {
+    if err := m.ensureTable(); err != nil {
+        return nil, err
+    }
+
+    var done []Migration
+    for _, mig := range m.migrations {
+        ran, err := m.run(mig, true)
+        if err != nil {
+            return done, fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+        }
+        if ran {
+            done = append(done, mig)
+        }
+    }
+    return done, nil
+}
+
+// Down reverts the most recently applied migration. It returns nil when
+// nothing is applied, and an error when the current version is one this
+// build has no down migration for, or when another migrator reverted it
+// first.
+func (m *Migrator) Down() (*Migration, error) {
+    if err := m.ensureTable(); err != nil {
+        return nil, err
+    }
+    applied, err := m.applied()
+    if err != nil {
+        return nil, err
+    }
+    if len(applied) == 0 {
+        return nil, nil
+    }
+
+    current := -1
+    for version := range applied {
+        current = max(current, version)
+    }
+    i := sort.Search(len(m.migrations), func(i int) bool {
+        return m.migrations[i].Version >= current
+    })
+    if i == len(m.migrations) || m.migrations[i].Version != current {
+        return nil, fmt.Errorf("no down migration for version %d", current)
+    }
+
+    mig := m.migrations[i]
+    ran, err := m.run(mig, false)
+    if err != nil {
+        return nil, fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+    }
+    if !ran {
+        return nil, fmt.Errorf("migration %d_%s down: already reverted by another migrator", mig.Version, mig.Name)
+    }
+    return &mig, nil
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it, for adopting a database whose schema was created
+// before migrations were tracked. It refuses once anything is recorded, and
+// returns the migrations it marked.
+func (m *Migrator) Baseline(version int) ([]Migration, error) {
+    if err := m.ensureTable(); err != nil {
+        return nil, err
+    }
+    known := false
+    for _, mig := range m.migrations {
+        known = known || mig.Version == version
+    }
+    if !known {
+        return nil, fmt.Errorf("no migration with version %d", version)
+    }
+
+    tx, err := m.db.Beginx()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+        return nil, err
+    }
+    var recorded int
+    if err := tx.Get(&recorded, `SELECT COUNT(*) FROM schema_migrations`); err != nil {
+        return nil, err
+    }
+    if recorded > 0 {
+        return nil, fmt.Errorf("database already has %d migrations recorded; baseline only adopts untracked databases", recorded)
+    }
+
+    var marked []Migration
+    for _, mig := range m.migrations {
+        if mig.Version > version {
+            break
+        }
+        if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name); err != nil {
+            return nil, err
+        }
+        marked = append(marked, mig)
+    }
+    return marked, tx.Commit()
+}
+
+// run applies or reverts one migration under the advisory lock. It reports
+// false when another migrator got there first.
+func (m *Migrator) run(mig Migration, up bool) (bool, error) {
+    tx, err := m.db.Beginx()
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+        return false, err
+    }
+    for name, value := range m.settings {
+        if _, err := tx.Exec(`SELECT set_config($1, $2, true)`, name, value); err != nil {
+            return false, err
+        }
+    }
+
+    var exists bool
+    err = tx.Get(&exists, `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)`, mig.Version)
+    if err != nil && err != sql.ErrNoRows {
+        return false, err
+    }
+    if exists == up {
+        return false, nil
+    }
+
+    if up {
+        if _, err := tx.Exec(mig.Up); err != nil {
+            return false, err
+        }
+        _, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+    } else {
+        if _, err := tx.Exec(mig.Down); err != nil {
+            return false, err
+        }
+        _, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+    }
+    if err != nil {
+        return false, err
+    }
+
+    return true, tx.Commit()
+}
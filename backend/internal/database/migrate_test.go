@@ -0,0 +1,298 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("embedded migrations: %v", err)
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Fatalf("migration %d_%s is at position %d; versions must run 1, 2, 3, ...", mig.Version, mig.Name, i+1)
+		}
+	}
+
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			"unexpected name",
+			fstest.MapFS{"migrations/create_users.sql": file("SELECT 1")},
+			"unexpected migration file",
+		},
+		{
+			"missing down",
+			fstest.MapFS{"migrations/0001_create_users.up.sql": file("SELECT 1")},
+			"needs both up and down",
+		},
+		{
+			"two names",
+			fstest.MapFS{
+				"migrations/0001_create_users.up.sql":  file("SELECT 1"),
+				"migrations/0001_add_users.down.sql":   file("SELECT 1"),
+				"migrations/0002_create_gigs.up.sql":   file("SELECT 1"),
+				"migrations/0002_create_gigs.down.sql": file("SELECT 1"),
+			},
+			"has two names",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// testMigrator returns a migrator over a fresh schema of the Postgres
+// database named by TEST_DATABASE_URL, and skips the test when it is unset.
+// The schema is dropped when the test ends.
+func testMigrator(t *testing.T) (*Migrator, *sqlx.DB) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "migrate_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema+",public")
+	u.RawQuery = query.Encode()
+	db, err := sqlx.Connect("postgres", u.String())
+	if err != nil {
+		t.Fatalf("connect to %s: %v", schema, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	return migrator, db
+}
+
+// upTo applies the migrations up to and including version only.
+func upTo(t *testing.T, m *Migrator, version int) {
+	t.Helper()
+	partial := *m
+	partial.migrations = m.migrations[:version]
+	if _, err := partial.Up(); err != nil {
+		t.Fatalf("up to %d: %v", version, err)
+	}
+}
+
+func TestMigratorRoundTrip(t *testing.T) {
+	m, _ := testMigrator(t)
+
+	done, err := m.Up()
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(done) != len(m.migrations) {
+		t.Fatalf("up applied %d migrations, want %d", len(done), len(m.migrations))
+	}
+	if done, err := m.Up(); err != nil || len(done) != 0 {
+		t.Fatalf("second up applied %d migrations (%v), want none", len(done), err)
+	}
+
+	for want := len(m.migrations); want > 0; want-- {
+		mig, err := m.Down()
+		if err != nil {
+			t.Fatalf("down: %v", err)
+		}
+		if mig == nil || mig.Version != want {
+			t.Fatalf("down reverted %v, want version %d", mig, want)
+		}
+	}
+	if mig, err := m.Down(); mig != nil || err != nil {
+		t.Fatalf("down on an empty database reverted %v (%v), want nothing", mig, err)
+	}
+
+	if done, err := m.Up(); err != nil || len(done) != len(m.migrations) {
+		t.Fatalf("up after down applied %d migrations (%v), want %d", len(done), err, len(m.migrations))
+	}
+}
+
+func TestMigratorBaseline(t *testing.T) {
+	m, db := testMigrator(t)
+
+	// A database from before migrations: the first two schemas, untracked.
+	upTo(t, m, 2)
+	db.MustExec(`DROP TABLE schema_migrations`)
+
+	if _, err := m.Up(); err == nil {
+		t.Fatal("up on an untracked database succeeded, want it to fail creating users")
+	}
+	marked, err := m.Baseline(2)
+	if err != nil {
+		t.Fatalf("baseline: %v", err)
+	}
+	if len(marked) != 2 {
+		t.Fatalf("baseline marked %d migrations, want 2", len(marked))
+	}
+	if _, err := m.Baseline(2); err == nil {
+		t.Fatal("second baseline succeeded, want it refused")
+	}
+	if done, err := m.Up(); err != nil || len(done) != len(m.migrations)-2 {
+		t.Fatalf("up after baseline applied %d migrations (%v), want %d", len(done), err, len(m.migrations)-2)
+	}
+}
+
+// seedLegacyGig inserts a gig in the version 2 schema and returns its id.
+func seedLegacyGig(t *testing.T, db *sqlx.DB, organizer, venue, date, start, end, genres string) string {
+	t.Helper()
+	var endTime *string
+	if end != "" {
+		endTime = &end
+	}
+	var id string
+	err := db.Get(&id, `
+		INSERT INTO gigs (title, description, venue_name, venue_address, latitude, longitude,
+		                  date, start_time, end_time, organizer_id, genres)
+		VALUES ('Gig', 'A gig', $1, 'Jl. Kemang Raya 8', -6.2607, 106.8136, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		venue, date, start, endTime, organizer, genres)
+	if err != nil {
+		t.Fatalf("seed gig: %v", err)
+	}
+	return id
+}
+
+func seedOrganizer(t *testing.T, db *sqlx.DB) string {
+	t.Helper()
+	var id string
+	err := db.Get(&id, `
+		INSERT INTO users (username, email, password_hash, role)
+		VALUES ('organizer', 'organizer@example.com', 'x', 'organizer')
+		RETURNING id`)
+	if err != nil {
+		t.Fatalf("seed organizer: %v", err)
+	}
+	return id
+}
+
+func TestMigratorLegacyGigs(t *testing.T) {
+	m, db := testMigrator(t)
+	upTo(t, m, 2)
+	organizer := seedOrganizer(t, db)
+
+	overnight := seedLegacyGig(t, db, organizer, "The Rossi Club", "2024-03-01", "19:30", "01:00", `["Indie Rock", "rock", "Vaporwave"]`)
+	badTimes := seedLegacyGig(t, db, organizer, "The Rossi Club", "2024-03-02", "25:00", "19:75", `["Jazz"]`)
+	respelled := seedLegacyGig(t, db, organizer, "rossi club", "2024-03-03", "20:00", "", `null`)
+
+	if _, err := m.Up(); err == nil || !strings.Contains(err.Error(), "need a timezone") {
+		t.Fatalf("up without a timezone: got %v, want it to stop", err)
+	}
+
+	m.Set("app.default_timezone", "Asia/Jakarta")
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	// 0003: wall-clock times read in the given zone, invalid ones dropped.
+	instants := []struct {
+		gig    string
+		starts time.Time
+		ends   *time.Time
+	}{
+		{overnight, time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), ptr(time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC))},
+		{badTimes, time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC), nil},
+		{respelled, time.Date(2024, 3, 3, 13, 0, 0, 0, time.UTC), nil},
+	}
+	for _, want := range instants {
+		var got struct {
+			StartsAt time.Time  `db:"starts_at"`
+			EndsAt   *time.Time `db:"ends_at"`
+			Timezone string     `db:"timezone"`
+		}
+		if err := db.Get(&got, `SELECT starts_at, ends_at, timezone FROM gigs WHERE id = $1`, want.gig); err != nil {
+			t.Fatalf("gig %s: %v", want.gig, err)
+		}
+		if !got.StartsAt.Equal(want.starts) || got.Timezone != "Asia/Jakarta" {
+			t.Fatalf("gig %s starts %v in %s, want %v in Asia/Jakarta", want.gig, got.StartsAt, got.Timezone, want.starts)
+		}
+		if (got.EndsAt == nil) != (want.ends == nil) || got.EndsAt != nil && !got.EndsAt.Equal(*want.ends) {
+			t.Fatalf("gig %s ends %v, want %v", want.gig, got.EndsAt, want.ends)
+		}
+	}
+
+	// 0008: both spellings of one club at one place become one venue,
+	// named after the spelling most gigs used.
+	var venues []string
+	if err := db.Select(&venues, `SELECT DISTINCT venue_name FROM gig_listings`); err != nil {
+		t.Fatalf("venues: %v", err)
+	}
+	if len(venues) != 1 || venues[0] != "The Rossi Club" {
+		t.Fatalf("got venues %q, want only \"The Rossi Club\"", venues)
+	}
+
+	// 0010: genres resolve through aliases in order, unknown ones become
+	// genres of their own.
+	var slugs []string
+	err := db.Select(&slugs, `SELECT genre_slug FROM gig_genres WHERE gig_id = $1 ORDER BY position`, overnight)
+	if err != nil {
+		t.Fatalf("gig genres: %v", err)
+	}
+	if strings.Join(slugs, ",") != "indie,rock,vaporwave" {
+		t.Fatalf("got genres %q, want indie, rock, vaporwave", slugs)
+	}
+	var name string
+	if err := db.Get(&name, `SELECT name FROM genres WHERE slug = 'vaporwave'`); err != nil || name != "Vaporwave" {
+		t.Fatalf("new genre named %q (%v), want \"Vaporwave\"", name, err)
+	}
+}
+
+func TestMigratorUnreadableDate(t *testing.T) {
+	m, db := testMigrator(t)
+	upTo(t, m, 2)
+	organizer := seedOrganizer(t, db)
+	seedLegacyGig(t, db, organizer, "The Rossi Club", "2024-02-30", "19:30", "", `null`)
+
+	m.Set("app.default_timezone", "Asia/Jakarta")
+	if _, err := m.Up(); err == nil || !strings.Contains(err.Error(), "unreadable dates") {
+		t.Fatalf("up: got %v, want it to stop on the unreadable date", err)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if statuses[2].AppliedAt != nil {
+		t.Fatal("0003 is recorded as applied after it failed")
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,27 @@
+CREATE TABLE gigs (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title         VARCHAR(200)     NOT NULL,
+    description   TEXT             NOT NULL,
+    venue_name    VARCHAR(200)     NOT NULL,
+    venue_address TEXT             NOT NULL,
+    latitude      DOUBLE PRECISION NOT NULL,
+    longitude     DOUBLE PRECISION NOT NULL,
+    -- date (YYYY-MM-DD) and times (HH:MM) are stored as entered.
+    date          VARCHAR(10)      NOT NULL,
+    start_time    VARCHAR(8)       NOT NULL,
+    end_time      VARCHAR(8),
+    price         NUMERIC(10, 2),
+    image_url     TEXT,
+    organizer_id  UUID             NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    genres        JSONB,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT gigs_latitude_check CHECK (latitude BETWEEN -90 AND 90),
+    CONSTRAINT gigs_longitude_check CHECK (longitude BETWEEN -180 AND 180)
+);
+
+CREATE INDEX gigs_listing_idx ON gigs (date DESC, start_time DESC, id DESC);
+CREATE INDEX gigs_organizer_id_idx ON gigs (organizer_id);
+CREATE INDEX gigs_location_idx ON gigs (latitude, longitude);
+CREATE INDEX gigs_genres_idx ON gigs USING GIN (genres);
@@ -0,0 +1,20 @@
+ALTER TABLE gigs
+    ADD COLUMN date       VARCHAR(10),
+    ADD COLUMN start_time VARCHAR(8),
+    ADD COLUMN end_time   VARCHAR(8);
+
+UPDATE gigs
+SET date       = to_char(starts_at AT TIME ZONE timezone, 'YYYY-MM-DD'),
+    start_time = to_char(starts_at AT TIME ZONE timezone, 'HH24:MI'),
+    end_time   = to_char(ends_at AT TIME ZONE timezone, 'HH24:MI');
+
+DROP INDEX gigs_listing_idx;
+ALTER TABLE gigs
+    ALTER COLUMN date SET NOT NULL,
+    ALTER COLUMN start_time SET NOT NULL,
+    DROP CONSTRAINT gigs_ends_after_start_check,
+    DROP COLUMN starts_at,
+    DROP COLUMN ends_at,
+    DROP COLUMN timezone;
+
+CREATE INDEX gigs_listing_idx ON gigs (date DESC, start_time DESC, id DESC);
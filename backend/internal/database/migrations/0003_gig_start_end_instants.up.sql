@@ -0,0 +1,78 @@
+-- Replace the free-form date/start_time/end_time strings with instants and
+-- an IANA timezone per gig.
+--
+-- Existing rows carry no timezone. They are read in the zone named by the
+-- app.default_timezone setting, which `api migrate up --default-timezone
+-- Asia/Jakarta` sets; with gigs in the table and no zone given, the
+-- migration stops rather than guess. A row whose date is not a real
+-- YYYY-MM-DD stops it too, so it can be fixed by hand; a start time that is
+-- not a valid HH:MM[:SS] falls back to midnight and such an end time is
+-- dropped.
+
+ALTER TABLE gigs
+    ADD COLUMN starts_at TIMESTAMPTZ,
+    ADD COLUMN ends_at   TIMESTAMPTZ,
+    ADD COLUMN timezone  TEXT NOT NULL DEFAULT 'UTC';
+
+-- valid_date reports whether s is a YYYY-MM-DD date that exists, such that
+-- s::date cannot fail below.
+CREATE FUNCTION pg_temp.valid_date(s TEXT) RETURNS BOOLEAN AS $$
+BEGIN
+    RETURN s ~ '^\d{4}-\d{2}-\d{2}$' AND s::date IS NOT NULL;
+EXCEPTION WHEN others THEN
+    RETURN false;
+END
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    bad TEXT;
+BEGIN
+    SELECT string_agg(id::text || ' (' || date || ')', ', ')
+    INTO bad
+    FROM gigs
+    WHERE NOT pg_temp.valid_date(date);
+
+    IF bad IS NOT NULL THEN
+        RAISE EXCEPTION 'gigs with unreadable dates: %', bad;
+    END IF;
+
+    IF COALESCE(current_setting('app.default_timezone', true), '') = ''
+       AND EXISTS (SELECT 1 FROM gigs) THEN
+        RAISE EXCEPTION 'existing gigs need a timezone: run migrate up with --default-timezone, e.g. Asia/Jakarta';
+    END IF;
+END
+$$;
+
+UPDATE gigs
+SET timezone = current_setting('app.default_timezone', true);
+
+UPDATE gigs
+SET starts_at = (
+    date::date + CASE
+        WHEN start_time ~ '^([01]?\d|2[0-3]):[0-5]\d(:[0-5]\d)?$' THEN start_time::time
+        ELSE TIME '00:00'
+    END
+) AT TIME ZONE timezone;
+
+-- An end time at or before the start time means the show ran past midnight.
+UPDATE gigs
+SET ends_at = (date::date + end_time::time) AT TIME ZONE timezone
+WHERE end_time ~ '^([01]?\d|2[0-3]):[0-5]\d(:[0-5]\d)?$';
+
+UPDATE gigs
+SET ends_at = ends_at + INTERVAL '1 day'
+WHERE ends_at <= starts_at;
+
+ALTER TABLE gigs
+    ALTER COLUMN starts_at SET NOT NULL,
+    ALTER COLUMN timezone DROP DEFAULT,
+    ADD CONSTRAINT gigs_ends_after_start_check CHECK (ends_at > starts_at);
+
+DROP INDEX gigs_listing_idx;
+ALTER TABLE gigs
+    DROP COLUMN date,
+    DROP COLUMN start_time,
+    DROP COLUMN end_time;
+
+CREATE INDEX gigs_listing_idx ON gigs (starts_at DESC, id DESC);
@@ -0,0 +1,12 @@
+-- Without a status every row is public, so drafts cannot survive the
+-- rollback.
+DELETE FROM gigs WHERE status = 'draft';
+
+DROP INDEX IF EXISTS gigs_status_idx;
+
+ALTER TABLE gigs
+    DROP CONSTRAINT gigs_status_check,
+    DROP COLUMN status,
+    DROP COLUMN status_reason,
+    DROP COLUMN status_changed_at,
+    DROP COLUMN rescheduled_from;
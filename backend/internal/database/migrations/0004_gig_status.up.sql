@@ -0,0 +1,13 @@
+-- Gigs already in the table were public, so they start out published; new
+-- gigs default to draft.
+ALTER TABLE gigs
+    ADD COLUMN status            VARCHAR(20) NOT NULL DEFAULT 'published',
+    ADD COLUMN status_reason     TEXT,
+    ADD COLUMN status_changed_at TIMESTAMPTZ,
+    ADD COLUMN rescheduled_from  TIMESTAMPTZ,
+    ADD CONSTRAINT gigs_status_check
+        CHECK (status IN ('draft', 'published', 'cancelled', 'postponed', 'rescheduled'));
+
+ALTER TABLE gigs ALTER COLUMN status SET DEFAULT 'draft';
+
+CREATE INDEX gigs_status_idx ON gigs (status);
@@ -0,0 +1 @@
+ALTER TABLE gigs DROP COLUMN version;
@@ -0,0 +1,3 @@
+-- version is the optimistic concurrency token behind a gig's ETag. Every
+-- write bumps it and conditional writes compare it in their WHERE clause.
+ALTER TABLE gigs ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
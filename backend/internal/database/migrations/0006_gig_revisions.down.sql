@@ -0,0 +1 @@
+DROP TABLE IF EXISTS gig_revisions;
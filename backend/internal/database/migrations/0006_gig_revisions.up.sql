@@ -0,0 +1,41 @@
+-- gig_revisions records every write to a gig: the editable fields and status
+-- after the write (snapshot) and the fields that changed from the previous
+-- revision (changes). version matches gigs.version after the write.
+CREATE TABLE gig_revisions (
+    id            UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    gig_id        UUID        NOT NULL REFERENCES gigs (id) ON DELETE CASCADE,
+    version       INTEGER     NOT NULL,
+    action        VARCHAR(20) NOT NULL,
+    editor_id     UUID        REFERENCES users (id) ON DELETE SET NULL,
+    restored_from INTEGER,
+    snapshot      JSONB       NOT NULL,
+    changes       JSONB       NOT NULL DEFAULT '[]',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT gig_revisions_gig_id_version_key UNIQUE (gig_id, version)
+);
+
+CREATE INDEX gig_revisions_editor_id_idx ON gig_revisions (editor_id);
+
+-- Existing gigs have no history, so each starts with one revision of its
+-- current state. The snapshot matches models.GigSnapshot: local wall-clock
+-- times and numbers as JSON numbers.
+INSERT INTO gig_revisions (gig_id, version, action, editor_id, snapshot, created_at)
+SELECT
+    id, version, 'created', organizer_id,
+    jsonb_build_object(
+        'title',         title,
+        'description',   description,
+        'venue_name',    venue_name,
+        'venue_address', venue_address,
+        'latitude',      latitude::float8,
+        'longitude',     longitude::float8,
+        'starts_at',     to_char(starts_at AT TIME ZONE timezone, 'YYYY-MM-DD"T"HH24:MI:SS'),
+        'ends_at',       to_char(ends_at AT TIME ZONE timezone, 'YYYY-MM-DD"T"HH24:MI:SS'),
+        'timezone',      timezone,
+        'price',         price::float8,
+        'genres',        COALESCE(genres, '[]'),
+        'status',        status,
+        'status_reason', status_reason
+    ),
+    updated_at
+FROM gigs;
@@ -0,0 +1,10 @@
+-- image_thumbnails maps each resized copy of image_url to its URL, e.g.
+-- {"small": "...", "medium": "..."}.
+ALTER TABLE gigs ADD COLUMN image_thumbnails JSONB;
+
+-- Revision snapshots now include image_url. Add it to each gig's latest
+-- snapshot so the next revision does not report it as a change.
+UPDATE gig_revisions r
+SET snapshot = r.snapshot || jsonb_build_object('image_url', g.image_url)
+FROM gigs g
+WHERE r.gig_id = g.id AND r.version = g.version AND g.image_url IS NOT NULL;
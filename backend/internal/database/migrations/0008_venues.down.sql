@@ -0,0 +1,48 @@
+DROP VIEW IF EXISTS gig_listings;
+
+ALTER TABLE gigs
+    ADD COLUMN venue_name    VARCHAR(200),
+    ADD COLUMN venue_address TEXT,
+    ADD COLUMN latitude      DOUBLE PRECISION,
+    ADD COLUMN longitude     DOUBLE PRECISION;
+
+UPDATE gigs g
+SET venue_name = v.name,
+    venue_address = v.address,
+    latitude = v.latitude,
+    longitude = v.longitude
+FROM venues v
+WHERE v.id = g.venue_id;
+
+ALTER TABLE gigs
+    ALTER COLUMN venue_name SET NOT NULL,
+    ALTER COLUMN venue_address SET NOT NULL,
+    ALTER COLUMN latitude SET NOT NULL,
+    ALTER COLUMN longitude SET NOT NULL,
+    ADD CONSTRAINT gigs_latitude_check CHECK (latitude BETWEEN -90 AND 90),
+    ADD CONSTRAINT gigs_longitude_check CHECK (longitude BETWEEN -180 AND 180);
+
+CREATE INDEX gigs_location_idx ON gigs (latitude, longitude);
+
+-- Put the venue fields back into snapshots, from the venue each one names
+-- or, should it be gone, the gig's own.
+UPDATE gig_revisions r
+SET snapshot = (r.snapshot - 'venue_id') || (
+    SELECT jsonb_build_object(
+        'venue_name',    v.name,
+        'venue_address', v.address,
+        'latitude',      v.latitude,
+        'longitude',     v.longitude
+    )
+    FROM venues v
+    WHERE v.id = COALESCE(
+        (SELECT id FROM venues WHERE id::text = r.snapshot->>'venue_id'),
+        g.venue_id
+    )
+)
+FROM gigs g
+WHERE r.gig_id = g.id;
+
+ALTER TABLE gigs DROP COLUMN venue_id;
+
+DROP TABLE IF EXISTS venues;
@@ -0,0 +1,138 @@
+-- venues replaces the venue name, address and coordinates each gig used to
+-- carry. created_by is the organizer who added the venue and may edit it.
+CREATE TABLE venues (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       VARCHAR(200)     NOT NULL,
+    address    TEXT             NOT NULL,
+    latitude   DOUBLE PRECISION NOT NULL,
+    longitude  DOUBLE PRECISION NOT NULL,
+    created_by UUID             REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT venues_latitude_check CHECK (latitude BETWEEN -90 AND 90),
+    CONSTRAINT venues_longitude_check CHECK (longitude BETWEEN -180 AND 180)
+);
+
+CREATE INDEX venues_location_idx ON venues (latitude, longitude);
+CREATE INDEX venues_created_by_idx ON venues (created_by);
+
+ALTER TABLE gigs ADD COLUMN venue_id UUID;
+
+-- normalize_venue_name mirrors models.NormalizeVenueName: lower case, "&"
+-- read as "and", punctuation dropped and the word "the" ignored.
+CREATE FUNCTION pg_temp.normalize_venue_name(name TEXT) RETURNS TEXT AS $$
+    SELECT COALESCE(string_agg(word, ' ' ORDER BY n), '')
+    FROM regexp_split_to_table(lower(replace(name, '&', ' and ')), '[^[:alnum:]]+')
+        WITH ORDINALITY AS words (word, n)
+    WHERE word NOT IN ('', 'the')
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- venue_spellings records which venue each distinct spelling of a gig's
+-- venue was folded into, for rewriting revision snapshots below.
+CREATE TEMPORARY TABLE venue_spellings (
+    venue_name    VARCHAR(200),
+    venue_address TEXT,
+    latitude      DOUBLE PRECISION,
+    longitude     DOUBLE PRECISION,
+    venue_id      UUID
+) ON COMMIT DROP;
+
+-- Cluster the existing gigs into venues. Spellings are visited from the most
+-- used, so a venue takes the name most gigs gave it; each later spelling
+-- joins the closest venue within 300 m whose name normalizes the same way,
+-- or starts a new venue. Unlike the API, no typo tolerance is applied here:
+-- a near miss becomes its own venue rather than risk merging two clubs.
+DO $$
+DECLARE
+    spelling RECORD;
+    match    UUID;
+BEGIN
+    FOR spelling IN
+        SELECT
+            venue_name, venue_address, latitude, longitude,
+            (array_agg(organizer_id ORDER BY created_at))[1] AS created_by,
+            MIN(created_at) AS created_at
+        FROM gigs
+        GROUP BY venue_name, venue_address, latitude, longitude
+        ORDER BY COUNT(*) DESC, MIN(created_at)
+    LOOP
+        SELECT v.id INTO match
+        FROM venues v
+        WHERE pg_temp.normalize_venue_name(v.name) = pg_temp.normalize_venue_name(spelling.venue_name)
+          AND (2 * 6371 * ASIN(LEAST(1, SQRT(
+                POWER(SIN(RADIANS(v.latitude - spelling.latitude) / 2), 2) +
+                COS(RADIANS(spelling.latitude)) * COS(RADIANS(v.latitude)) *
+                POWER(SIN(RADIANS(v.longitude - spelling.longitude) / 2), 2))))) <= 0.3
+        ORDER BY
+            POWER(v.latitude - spelling.latitude, 2) + POWER(v.longitude - spelling.longitude, 2),
+            v.created_at
+        LIMIT 1;
+
+        IF match IS NULL THEN
+            INSERT INTO venues (name, address, latitude, longitude, created_by, created_at, updated_at)
+            VALUES (
+                spelling.venue_name, spelling.venue_address, spelling.latitude, spelling.longitude,
+                spelling.created_by, spelling.created_at, spelling.created_at
+            )
+            RETURNING id INTO match;
+        END IF;
+
+        INSERT INTO venue_spellings
+        VALUES (spelling.venue_name, spelling.venue_address, spelling.latitude, spelling.longitude, match);
+    END LOOP;
+END
+$$;
+
+UPDATE gigs g
+SET venue_id = s.venue_id
+FROM venue_spellings s
+WHERE g.venue_name = s.venue_name
+  AND g.venue_address = s.venue_address
+  AND g.latitude = s.latitude
+  AND g.longitude = s.longitude;
+
+-- Gigs keep their venue; a venue can only go once no gig refers to it.
+ALTER TABLE gigs
+    ALTER COLUMN venue_id SET NOT NULL,
+    ADD CONSTRAINT gigs_venue_id_fkey FOREIGN KEY (venue_id) REFERENCES venues (id) ON DELETE RESTRICT;
+
+CREATE INDEX gigs_venue_id_idx ON gigs (venue_id);
+
+-- Snapshots now hold venue_id in place of the venue fields. A snapshot
+-- whose spelling no current gig uses any more falls back to its gig's venue.
+UPDATE gig_revisions r
+SET snapshot = (r.snapshot - 'venue_name' - 'venue_address' - 'latitude' - 'longitude')
+    || jsonb_build_object('venue_id', COALESCE(
+        (
+            SELECT s.venue_id
+            FROM venue_spellings s
+            WHERE s.venue_name = r.snapshot->>'venue_name'
+              AND s.venue_address = r.snapshot->>'venue_address'
+              AND s.latitude = (r.snapshot->>'latitude')::float8
+              AND s.longitude = (r.snapshot->>'longitude')::float8
+        ),
+        g.venue_id
+    ))
+FROM gigs g
+WHERE r.gig_id = g.id;
+
+ALTER TABLE gigs
+    DROP COLUMN venue_name,
+    DROP COLUMN venue_address,
+    DROP COLUMN latitude,
+    DROP COLUMN longitude;
+
+-- gig_listings is what gigs are read from: each gig with its venue's name,
+-- address and location under the names the gig columns used to have.
+-- g.* is expanded when the view is created, so a migration that adds a
+-- column to gigs must recreate the view for reads to see it.
+CREATE VIEW gig_listings AS
+SELECT
+    g.*,
+    v.name    AS venue_name,
+    v.address AS venue_address,
+    v.latitude,
+    v.longitude
+FROM gigs g
+JOIN venues v ON v.id = g.venue_id;
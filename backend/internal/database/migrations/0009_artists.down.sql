@@ -0,0 +1,4 @@
+UPDATE gig_revisions SET snapshot = snapshot - 'lineup';
+
+DROP TABLE IF EXISTS gig_lineups;
+DROP TABLE IF EXISTS artists;
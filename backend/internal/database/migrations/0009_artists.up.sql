@@ -0,0 +1,33 @@
+-- artists are the performers gigs bill. created_by is the organizer who
+-- added the artist and may edit it.
+CREATE TABLE artists (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       VARCHAR(200) NOT NULL,
+    bio        TEXT,
+    created_by UUID         REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX artists_name_idx ON artists (name);
+CREATE INDEX artists_created_by_idx ON artists (created_by);
+
+-- gig_lineups is each gig's bill. position 1 tops it; set times are
+-- optional. An artist on a lineup cannot be deleted.
+CREATE TABLE gig_lineups (
+    gig_id        UUID        NOT NULL REFERENCES gigs (id) ON DELETE CASCADE,
+    artist_id     UUID        NOT NULL REFERENCES artists (id) ON DELETE RESTRICT,
+    position      INTEGER     NOT NULL,
+    set_starts_at TIMESTAMPTZ,
+    set_ends_at   TIMESTAMPTZ,
+
+    CONSTRAINT gig_lineups_pkey PRIMARY KEY (gig_id, artist_id),
+    CONSTRAINT gig_lineups_gig_id_position_key UNIQUE (gig_id, position),
+    CONSTRAINT gig_lineups_set_ends_check CHECK (set_ends_at > set_starts_at)
+);
+
+CREATE INDEX gig_lineups_artist_id_idx ON gig_lineups (artist_id);
+
+-- Revision snapshots now include the lineup. Existing gigs have none, so
+-- add an empty one everywhere and the next revision does not report it.
+UPDATE gig_revisions SET snapshot = snapshot || '{"lineup": []}';
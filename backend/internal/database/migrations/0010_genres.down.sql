@@ -0,0 +1,36 @@
+DROP VIEW IF EXISTS gig_listings;
+
+ALTER TABLE gigs ADD COLUMN genres JSONB;
+
+-- Put genre names back where slugs were, in the order they were given.
+UPDATE gigs g
+SET genres = (
+    SELECT COALESCE(jsonb_agg(ge.name ORDER BY gg.position), '[]')
+    FROM gig_genres gg
+    JOIN genres ge ON ge.slug = gg.genre_slug
+    WHERE gg.gig_id = g.id
+);
+
+CREATE INDEX gigs_genres_idx ON gigs USING GIN (genres);
+
+UPDATE gig_revisions r
+SET snapshot = jsonb_set(r.snapshot, '{genres}', (
+    SELECT COALESCE(jsonb_agg(COALESCE(ge.name, s.slug) ORDER BY s.n), '[]')
+    FROM jsonb_array_elements_text(r.snapshot->'genres') WITH ORDINALITY AS s (slug, n)
+    LEFT JOIN genres ge ON ge.slug = s.slug
+))
+WHERE jsonb_typeof(r.snapshot->'genres') = 'array';
+
+CREATE VIEW gig_listings AS
+SELECT
+    g.*,
+    v.name    AS venue_name,
+    v.address AS venue_address,
+    v.latitude,
+    v.longitude
+FROM gigs g
+JOIN venues v ON v.id = g.venue_id;
+
+DROP TABLE IF EXISTS gig_genres;
+DROP TABLE IF EXISTS genre_aliases;
+DROP TABLE IF EXISTS genres;
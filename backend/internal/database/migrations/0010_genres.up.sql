@@ -0,0 +1,155 @@
+-- genres is the canonical genre taxonomy. A genre may belong to a broader
+-- one, and filtering by a genre includes everything beneath it.
+CREATE TABLE genres (
+    slug        VARCHAR(100) PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL,
+    parent_slug VARCHAR(100) REFERENCES genres (slug) ON DELETE SET NULL
+);
+
+CREATE INDEX genres_parent_slug_idx ON genres (parent_slug);
+
+-- genre_aliases maps every spelling a genre answers to, reduced to its key
+-- as models.GenreKey does, to the genre. A genre's slug and name are
+-- aliases of it too.
+CREATE TABLE genre_aliases (
+    alias      VARCHAR(100) PRIMARY KEY,
+    genre_slug VARCHAR(100) NOT NULL REFERENCES genres (slug) ON DELETE CASCADE
+);
+
+CREATE INDEX genre_aliases_genre_slug_idx ON genre_aliases (genre_slug);
+
+-- gig_genres replaces the free-text genres column on gigs. position keeps
+-- the order the organizer gave; a genre in use cannot be deleted.
+CREATE TABLE gig_genres (
+    gig_id     UUID         NOT NULL REFERENCES gigs (id) ON DELETE CASCADE,
+    genre_slug VARCHAR(100) NOT NULL,
+    position   INTEGER      NOT NULL,
+
+    CONSTRAINT gig_genres_pkey PRIMARY KEY (gig_id, genre_slug),
+    CONSTRAINT gig_genres_genre_slug_fkey FOREIGN KEY (genre_slug) REFERENCES genres (slug) ON DELETE RESTRICT
+);
+
+CREATE INDEX gig_genres_genre_slug_idx ON gig_genres (genre_slug);
+
+-- The starting taxonomy. The memory store seeds the same one.
+INSERT INTO genres (slug, name, parent_slug) VALUES
+    ('rock',          'Rock',        NULL),
+    ('pop',           'Pop',         NULL),
+    ('hip-hop',       'Hip Hop',     NULL),
+    ('r-and-b',       'R&B',         NULL),
+    ('soul',          'Soul',        NULL),
+    ('electronic',    'Electronic',  NULL),
+    ('jazz',          'Jazz',        NULL),
+    ('blues',         'Blues',       NULL),
+    ('folk',          'Folk',        NULL),
+    ('reggae',        'Reggae',      NULL),
+    ('classical',     'Classical',   NULL),
+    ('dangdut',       'Dangdut',     NULL),
+    ('indie',         'Indie',       'rock'),
+    ('punk',          'Punk',        'rock'),
+    ('metal',         'Metal',       'rock'),
+    ('shoegaze',      'Shoegaze',    'rock'),
+    ('post-rock',     'Post-Rock',   'rock'),
+    ('techno',        'Techno',      'electronic'),
+    ('house',         'House',       'electronic'),
+    ('ambient',       'Ambient',     'electronic'),
+    ('drum-and-bass', 'Drum & Bass', 'electronic');
+
+-- genre_key mirrors models.GenreKey: lower case, "&" read as "and",
+-- everything but letters and digits dropped.
+CREATE FUNCTION pg_temp.genre_key(name TEXT) RETURNS TEXT AS $$
+    SELECT regexp_replace(replace(lower(name), '&', 'and'), '[^[:alnum:]]+', '', 'g')
+$$ LANGUAGE SQL IMMUTABLE;
+
+INSERT INTO genre_aliases (alias, genre_slug) VALUES
+    ('indierock',      'indie'),
+    ('punkrock',       'punk'),
+    ('heavymetal',     'metal'),
+    ('rap',            'hip-hop'),
+    ('rnb',            'r-and-b'),
+    ('rhythmandblues', 'r-and-b'),
+    ('electronica',    'electronic'),
+    ('edm',            'electronic'),
+    ('dnb',            'drum-and-bass');
+
+INSERT INTO genre_aliases (alias, genre_slug)
+SELECT pg_temp.genre_key(slug), slug FROM genres
+UNION
+SELECT pg_temp.genre_key(name), slug FROM genres
+ON CONFLICT (alias) DO NOTHING;
+
+-- Genres organizers used that the taxonomy lacks become top-level genres
+-- of their own, named after their most used spelling, so no tag is lost.
+-- Revision snapshots count too, for restoring an old revision to work.
+CREATE TEMPORARY TABLE genre_spellings ON COMMIT DROP AS
+SELECT trim(spelling) AS spelling, pg_temp.genre_key(spelling) AS alias
+FROM (
+    SELECT jsonb_array_elements_text(genres) AS spelling
+    FROM gigs
+    WHERE jsonb_typeof(genres) = 'array'
+    UNION ALL
+    SELECT jsonb_array_elements_text(snapshot->'genres')
+    FROM gig_revisions
+    WHERE jsonb_typeof(snapshot->'genres') = 'array'
+) spellings;
+
+-- new_genres picks each unknown key's slug and name from its most used
+-- spelling. Keys longer than an alias can be are junk and dropped.
+CREATE TEMPORARY TABLE new_genres ON COMMIT DROP AS
+SELECT DISTINCT ON (alias)
+    alias,
+    left(trim(BOTH '-' FROM regexp_replace(replace(lower(spelling), '&', ' and '), '[^[:alnum:]]+', '-', 'g')), 100) AS slug,
+    left(spelling, 100) AS name
+FROM genre_spellings
+WHERE alias <> ''
+  AND length(alias) <= 100
+  AND alias NOT IN (SELECT alias FROM genre_aliases)
+GROUP BY alias, spelling
+ORDER BY alias, COUNT(*) DESC, spelling;
+
+INSERT INTO genres (slug, name)
+SELECT slug, name FROM new_genres
+ON CONFLICT (slug) DO NOTHING;
+
+-- A slug spells its key with dashes between words, so two new genres only
+-- share one when cut to length; both keys then alias the first.
+INSERT INTO genre_aliases (alias, genre_slug)
+SELECT alias, slug FROM new_genres;
+
+-- genre_slugs resolves a JSON array of genre names to the slugs they stand
+-- for, in order and without repeats, as the API does on write.
+CREATE FUNCTION pg_temp.genre_slugs(names JSONB) RETURNS JSONB AS $$
+    SELECT COALESCE(jsonb_agg(slug ORDER BY n), '[]')
+    FROM (
+        SELECT a.genre_slug AS slug, MIN(e.n) AS n
+        FROM jsonb_array_elements_text(CASE WHEN jsonb_typeof(names) = 'array' THEN names ELSE '[]' END)
+            WITH ORDINALITY AS e (name, n)
+        JOIN genre_aliases a ON a.alias = pg_temp.genre_key(e.name)
+        GROUP BY a.genre_slug
+    ) slugs
+$$ LANGUAGE SQL STABLE;
+
+INSERT INTO gig_genres (gig_id, genre_slug, position)
+SELECT g.id, s.slug, s.n
+FROM gigs g,
+     jsonb_array_elements_text(pg_temp.genre_slugs(g.genres)) WITH ORDINALITY AS s (slug, n);
+
+-- Snapshots hold slugs from now on.
+UPDATE gig_revisions
+SET snapshot = jsonb_set(snapshot, '{genres}', pg_temp.genre_slugs(snapshot->'genres'));
+
+-- gig_listings selects g.*, so it goes before the column does.
+DROP VIEW gig_listings;
+
+DROP INDEX IF EXISTS gigs_genres_idx;
+ALTER TABLE gigs DROP COLUMN genres;
+
+CREATE VIEW gig_listings AS
+SELECT
+    g.*,
+    v.name    AS venue_name,
+    v.address AS venue_address,
+    v.latitude,
+    v.longitude
+FROM gigs g
+JOIN venues v ON v.id = g.venue_id;
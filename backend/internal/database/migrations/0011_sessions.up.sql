@@ -0,0 +1,31 @@
+-- sessions are signed-in devices. Access tokens carry the session id and
+-- stop working once it is revoked or expires; expires_at moves forward
+-- every time the session refreshes.
+CREATE TABLE sessions (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID        NOT NULL,
+    user_agent   TEXT        NOT NULL DEFAULT '',
+    ip_address   TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ,
+
+    CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id, last_used_at DESC);
+
+-- refresh_tokens holds the SHA-256 of every refresh token a session has
+-- been issued. Only the one with no rotated_at is valid; presenting a
+-- rotated one means it was copied, and revokes the session.
+CREATE TABLE refresh_tokens (
+    token_hash CHAR(64)    NOT NULL,
+    session_id UUID        NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    rotated_at TIMESTAMPTZ,
+
+    CONSTRAINT refresh_tokens_pkey PRIMARY KEY (token_hash)
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
@@ -0,0 +1,8 @@
+-- email_verified_at is set once the user follows the link mailed to them.
+-- email_verification_sent_at throttles how often that link is resent.
+-- Accounts that existed before verification are trusted as they are.
+ALTER TABLE users
+    ADD COLUMN email_verified_at          TIMESTAMPTZ,
+    ADD COLUMN email_verification_sent_at TIMESTAMPTZ;
+
+UPDATE users SET email_verified_at = created_at;
@@ -0,0 +1,15 @@
+-- password_resets holds the SHA-256 of every password reset token mailed
+-- out. A token works once, before expires_at; resetting spends every
+-- outstanding token of the user.
+CREATE TABLE password_resets (
+    token_hash CHAR(64)    NOT NULL,
+    user_id    UUID        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+
+    CONSTRAINT password_resets_pkey PRIMARY KEY (token_hash),
+    CONSTRAINT password_resets_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id, created_at DESC);
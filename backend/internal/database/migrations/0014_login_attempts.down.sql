@@ -0,0 +1,5 @@
+UPDATE users SET role = 'user' WHERE role = 'admin';
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'organizer'));
+
+DROP TABLE IF EXISTS login_attempts;
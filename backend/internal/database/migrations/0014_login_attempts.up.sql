@@ -0,0 +1,24 @@
+-- login_attempts records every sign-in attempt that was let through under
+-- each key it counts against: "account:<email>" and "ip:<address>". An
+-- attempt is recorded before its password is checked, so concurrent
+-- attempts count against each other, and is deleted again if it succeeds.
+-- Accounts that do not exist are keyed the same way, so throttling does not
+-- reveal which do. Clearing a lock sets cleared_at rather than deleting the
+-- record. Records older than twice the lockout can no longer count and are
+-- pruned as new attempts come in.
+CREATE TABLE login_attempts (
+    id           BIGSERIAL PRIMARY KEY,
+    attempt_id   UUID        NOT NULL,
+    key          TEXT        NOT NULL,
+    ip_address   TEXT        NOT NULL DEFAULT '',
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    cleared_at   TIMESTAMPTZ
+);
+
+CREATE INDEX login_attempts_key_idx ON login_attempts (key, attempted_at DESC) WHERE cleared_at IS NULL;
+CREATE INDEX login_attempts_attempt_id_idx ON login_attempts (attempt_id);
+CREATE INDEX login_attempts_attempted_at_idx ON login_attempts (attempted_at);
+
+-- Admins may clear login locks. They are made with `api grant-admin`.
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'organizer', 'admin'));
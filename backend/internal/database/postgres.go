@@ -1,37 +1,34 @@
 package database
 
 import (
+    "context"
     "fmt"
     "log"
+    "sunyi-api/config"
+
     "github.com/jmoiron/sqlx"
     _ "github.com/lib/pq"
 )
 
-type Config struct {
-    Host     string
-    Port     string
-    User     string
-    Password string
-    DBName   string
-    SSLMode  string
-}
-
-func NewPostgresDB(cfg Config) (*sqlx.DB, error) {
-    dsn := fmt.Sprintf(
-        "host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-        cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
-    )
-
-    db, err := sqlx.Connect("postgres", dsn)
+func NewPostgresDB(cfg config.DatabaseConfig) (*sqlx.DB, error) {
+    db, err := sqlx.Open("postgres", cfg.DSN())
     if err != nil {
-        return nil, fmt.Errorf("failed to connect to database: %w", err)
+        return nil, fmt.Errorf("failed to open database: %w", err)
     }
 
+    db.SetMaxOpenConns(cfg.MaxOpenConns)
+    db.SetMaxIdleConns(cfg.MaxIdleConns)
+    db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+    db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
     // Test connection
-    if err := db.Ping(); err != nil {
+    ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+    defer cancel()
+    if err := db.PingContext(ctx); err != nil {
+        db.Close()
         return nil, fmt.Errorf("failed to ping database: %w", err)
     }
 
     log.Println("Postgres: ✅")
     return db, nil
-}
\ No newline at end of file
+}
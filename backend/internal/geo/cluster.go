@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+    tileSize = 256
+
+    // MaxZoom is the deepest zoom level accepted from map clients.
+    MaxZoom = 22
+
+    // MaxClusterZoom is the first zoom level at which every point is
+    // returned on its own.
+    MaxClusterZoom = 16
+
+    // ClusterRadiusPx is the width of a grid cell, in screen pixels, that
+    // points are grouped into.
+    ClusterRadiusPx = 60
+)
+
+type Point struct {
+    Lat float64
+    Lng float64
+}
+
+// Cluster is a group of points that fall into the same grid cell at a given
+// zoom. Members holds indexes into the slice passed to ClusterPoints.
+type Cluster struct {
+    Lat     float64
+    Lng     float64
+    Box     Box
+    Members []int
+}
+
+func (c Cluster) Count() int {
+    return len(c.Members)
+}
+
+// ClusterPoints groups points on a Web Mercator pixel grid for the given
+// zoom. Below MaxClusterZoom nearby points collapse into one cluster; at or
+// above it every point becomes its own single-member cluster. The output
+// order is deterministic for a given input.
+func ClusterPoints(points []Point, zoom int) []Cluster {
+    if zoom >= MaxClusterZoom {
+        clusters := make([]Cluster, len(points))
+        for i, p := range points {
+            clusters[i] = Cluster{
+                Lat:     p.Lat,
+                Lng:     p.Lng,
+                Box:     Box{MinLat: p.Lat, MaxLat: p.Lat, MinLng: p.Lng, MaxLng: p.Lng},
+                Members: []int{i},
+            }
+        }
+        return clusters
+    }
+
+    type cell struct{ x, y int }
+    worldPx := float64(tileSize) * math.Exp2(float64(zoom))
+    byCell := map[cell]*Cluster{}
+    var order []cell
+
+    for i, p := range points {
+        x, y := project(p.Lat, p.Lng, worldPx)
+        key := cell{int(x / ClusterRadiusPx), int(y / ClusterRadiusPx)}
+
+        c, ok := byCell[key]
+        if !ok {
+            c = &Cluster{Box: Box{MinLat: p.Lat, MaxLat: p.Lat, MinLng: p.Lng, MaxLng: p.Lng}}
+            byCell[key] = c
+            order = append(order, key)
+        }
+        c.Members = append(c.Members, i)
+        c.Lat += p.Lat
+        c.Lng += p.Lng
+        c.Box.MinLat = math.Min(c.Box.MinLat, p.Lat)
+        c.Box.MaxLat = math.Max(c.Box.MaxLat, p.Lat)
+        c.Box.MinLng = math.Min(c.Box.MinLng, p.Lng)
+        c.Box.MaxLng = math.Max(c.Box.MaxLng, p.Lng)
+    }
+
+    sort.Slice(order, func(i, j int) bool {
+        if order[i].y != order[j].y {
+            return order[i].y < order[j].y
+        }
+        return order[i].x < order[j].x
+    })
+
+    clusters := make([]Cluster, 0, len(order))
+    for _, key := range order {
+        c := byCell[key]
+        n := float64(len(c.Members))
+        c.Lat /= n
+        c.Lng /= n
+        clusters = append(clusters, *c)
+    }
+    return clusters
+}
+
+// project converts a coordinate to Web Mercator pixels for a world of the
+// given width.
+func project(lat, lng, worldPx float64) (float64, float64) {
+    lat = math.Max(math.Min(lat, 85.05112878), -85.05112878)
+    x := (lng + 180) / 360 * worldPx
+    sinLat := math.Sin(radians(lat))
+    y := (0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)) * worldPx
+    return x, y
+}
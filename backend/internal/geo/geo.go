@@ -0,0 +1,77 @@
+package geo
+
+import "math"
+
+const EarthRadiusKm = 6371.0
+
+// Box is a latitude/longitude rectangle. MinLng is greater than MaxLng when
+// the box crosses the antimeridian.
+type Box struct {
+    MinLat float64
+    MaxLat float64
+    MinLng float64
+    MaxLng float64
+}
+
+func (b Box) CrossesAntimeridian() bool {
+    return b.MinLng > b.MaxLng
+}
+
+func (b Box) Contains(lat, lng float64) bool {
+    if lat < b.MinLat || lat > b.MaxLat {
+        return false
+    }
+    if b.CrossesAntimeridian() {
+        return lng >= b.MinLng || lng <= b.MaxLng
+    }
+    return lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// HaversineKm returns the great-circle distance between two points.
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+    dLat := radians(lat2 - lat1)
+    dLng := radians(lng2 - lng1)
+    a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+        math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+    return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BoundingBox returns a box that contains every point within radiusKm of the
+// centre. It is a cheap prefilter; callers still check the exact distance.
+func BoundingBox(lat, lng, radiusKm float64) Box {
+    dLat := degrees(radiusKm / EarthRadiusKm)
+    box := Box{MinLat: lat - dLat, MaxLat: lat + dLat, MinLng: -180, MaxLng: 180}
+
+    // The box reaches a pole, so every longitude is in range.
+    if box.MinLat <= -90 || box.MaxLat >= 90 {
+        box.MinLat = math.Max(box.MinLat, -90)
+        box.MaxLat = math.Min(box.MaxLat, 90)
+        return box
+    }
+
+    dLng := degrees(math.Asin(math.Min(1, math.Sin(radiusKm/EarthRadiusKm)/math.Cos(radians(lat)))))
+    if dLng >= 180 {
+        return box
+    }
+    box.MinLng = normalizeLng(lng - dLng)
+    box.MaxLng = normalizeLng(lng + dLng)
+    return box
+}
+
+func normalizeLng(lng float64) float64 {
+    for lng < -180 {
+        lng += 360
+    }
+    for lng > 180 {
+        lng -= 360
+    }
+    return lng
+}
+
+func radians(deg float64) float64 {
+    return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+    return rad * 180 / math.Pi
+}
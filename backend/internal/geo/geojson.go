@@ -0,0 +1,45 @@
+package geo
+
+const (
+    TypeFeatureCollection = "FeatureCollection"
+    TypeFeature           = "Feature"
+    TypePoint             = "Point"
+)
+
+type FeatureCollection struct {
+    Type      string    `json:"type"`
+    Features  []Feature `json:"features"`
+    // Truncated is a foreign member saying the features do not cover
+    // everything that matched.
+    Truncated bool      `json:"truncated"`
+}
+
+type Feature struct {
+    Type       string                 `json:"type"`
+    ID         string                 `json:"id,omitempty"`
+    BBox       []float64              `json:"bbox,omitempty"`
+    Geometry   Geometry               `json:"geometry"`
+    Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry only covers points; coordinates are [longitude, latitude].
+type Geometry struct {
+    Type        string    `json:"type"`
+    Coordinates []float64 `json:"coordinates"`
+}
+
+func NewFeatureCollection(features []Feature) FeatureCollection {
+    if features == nil {
+        features = []Feature{}
+    }
+    return FeatureCollection{Type: TypeFeatureCollection, Features: features}
+}
+
+func PointGeometry(lat, lng float64) Geometry {
+    return Geometry{Type: TypePoint, Coordinates: []float64{lng, lat}}
+}
+
+// GeoJSON returns the box as a GeoJSON bbox: [west, south, east, north].
+func (b Box) GeoJSON() []float64 {
+    return []float64{b.MinLng, b.MinLat, b.MaxLng, b.MaxLat}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/loginguard"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+    guard *loginguard.Guard
+}
+
+func NewAdminHandler(guard *loginguard.Guard) *AdminHandler {
+    return &AdminHandler{guard: guard}
+}
+
+// ClearLoginLock lifts the sign-in lock or backoff on ?email=, ?ip= or both,
+// e.g. for a user locked out by someone guessing their password. It says
+// how many failures were forgiven, which is zero for an email no account
+// uses.
+func (h *AdminHandler) ClearLoginLock(c *gin.Context) {
+    email, ip := c.Query("email"), c.Query("ip")
+    if email == "" && ip == "" {
+        c.Error(apperr.Validation("Give the email or ip to unlock"))
+        return
+    }
+
+    cleared, err := h.guard.Unlock(c.Request.Context(), email, ip)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"cleared": cleared})
+}
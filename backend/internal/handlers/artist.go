@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ArtistHandler struct {
+    artistRepo repository.ArtistStore
+    gigRepo    repository.GigStore
+}
+
+func NewArtistHandler(artistRepo repository.ArtistStore, gigRepo repository.GigStore) *ArtistHandler {
+    return &ArtistHandler{artistRepo: artistRepo, gigRepo: gigRepo}
+}
+
+// GetArtists searches artists by name, for fans and for organizers
+// building a lineup.
+func (h *ArtistHandler) GetArtists(c *gin.Context) {
+    var filter models.ArtistFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    artists, err := h.artistRepo.List(c.Request.Context(), filter)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, artists)
+}
+
+func (h *ArtistHandler) GetArtistByID(c *gin.Context) {
+    artist, err := h.artistRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, artist)
+}
+
+// GetArtistGigs lists the gigs an artist plays, with the same filters and
+// paging as GET /api/gigs.
+func (h *ArtistHandler) GetArtistGigs(c *gin.Context) {
+    artist, err := h.artistRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    var filter models.GigFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    filter.ArtistID = artist.ID
+    filter.ViewerID = viewerID(c)
+
+    page, err := h.gigRepo.List(c.Request.Context(), filter)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, page)
+}
+
+func (h *ArtistHandler) CreateArtist(c *gin.Context) {
+    var input models.ArtistInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    creatorID := viewerID(c)
+    artist := &models.Artist{
+        Name:      input.Name,
+        Bio:       input.Bio,
+        CreatedBy: &creatorID,
+    }
+    if err := h.artistRepo.Create(c.Request.Context(), artist); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusCreated, artist)
+}
+
+// UpdateArtist edits an artist. Every lineup they are on shows the change.
+func (h *ArtistHandler) UpdateArtist(c *gin.Context) {
+    artist, ok := h.ownArtist(c, "update")
+    if !ok {
+        return
+    }
+
+    var input models.ArtistInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    artist.Name = input.Name
+    artist.Bio = input.Bio
+    if err := h.artistRepo.Update(c.Request.Context(), artist); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, artist)
+}
+
+// DeleteArtist removes an artist no gig bills.
+func (h *ArtistHandler) DeleteArtist(c *gin.Context) {
+    artist, ok := h.ownArtist(c, "delete")
+    if !ok {
+        return
+    }
+
+    if err := h.artistRepo.Delete(c.Request.Context(), artist.ID); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Artist deleted successfully"})
+}
+
+// ownArtist loads the artist in the path and checks that the caller added
+// them. On failure it has already recorded the error on c.
+func (h *ArtistHandler) ownArtist(c *gin.Context, action string) (*models.Artist, bool) {
+    artist, err := h.artistRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return nil, false
+    }
+
+    if artist.CreatedBy == nil || *artist.CreatedBy != viewerID(c) {
+        c.Error(apperr.Forbidden("You can only " + action + " artists you added"))
+        return nil, false
+    }
+
+    return artist, true
+}
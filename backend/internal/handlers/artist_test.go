@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+)
+
+// createArtist posts an artist as the given organizer and returns it.
+func (a *testAPI) createArtist(token, name string) models.Artist {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/api/artists", models.ArtistInput{Name: name}, token)
+	expectStatus(a.t, rec, http.StatusCreated)
+	var artist models.Artist
+	decode(a.t, rec, &artist)
+	return artist
+}
+
+func TestGigLineup(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	headliner := api.createArtist(token, "The Headliners")
+	support := api.createArtist(token, "Support Act")
+
+	setStart, setEnd := "2030-01-01T21:00", "2030-01-01T22:30"
+	input := gigInput("Double bill", "2030-01-01")
+	input.Lineup = []models.LineupSlotInput{
+		{ArtistID: headliner.ID, SetStartsAt: &setStart, SetEndsAt: &setEnd},
+		{ArtistID: support.ID},
+	}
+	gig := api.createGig(token, input)
+	if len(gig.Lineup) != 2 || gig.Lineup[0].ArtistName != "The Headliners" || gig.Lineup[0].Position != 1 ||
+		gig.Lineup[1].ArtistID != support.ID || gig.Lineup[1].Position != 2 {
+		t.Fatalf("lineup = %+v", gig.Lineup)
+	}
+
+	rec := api.do(http.MethodGet, "/api/gigs/"+gig.ID, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Lineup []struct {
+			ArtistName  string  `json:"artist_name"`
+			SetStartsAt *string `json:"set_starts_at"`
+		} `json:"lineup"`
+	}
+	decode(t, rec, &body)
+	if len(body.Lineup) != 2 || body.Lineup[0].SetStartsAt == nil || *body.Lineup[0].SetStartsAt != "2030-01-01T21:00:00+07:00" {
+		t.Fatalf("lineup as served = %+v", body.Lineup)
+	}
+
+	// Reordering the bill through a merge patch is recorded as a change.
+	patch := `{"lineup":[{"artist_id":"` + support.ID + `"},{"artist_id":"` + headliner.ID + `"}]}`
+	rec = api.patch("/api/gigs/"+gig.ID, patch, token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusOK)
+	var patched models.GigPatchResponse
+	decode(t, rec, &patched)
+	if patched.Gig.Lineup[0].ArtistID != support.ID || len(patched.Changes) != 1 || patched.Changes[0].Field != "lineup" {
+		t.Fatalf("patched = %+v", patched)
+	}
+
+	duplicate := gigInput("Twice", "2030-01-02")
+	duplicate.Lineup = []models.LineupSlotInput{{ArtistID: support.ID}, {ArtistID: support.ID}}
+	rec = api.do(http.MethodPost, "/api/gigs", duplicate, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "lineup[1].artist_id")
+
+	backwards := gigInput("Backwards", "2030-01-02")
+	backwards.Lineup = []models.LineupSlotInput{{ArtistID: support.ID, SetStartsAt: &setEnd, SetEndsAt: &setStart}}
+	rec = api.do(http.MethodPost, "/api/gigs", backwards, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "lineup[0].set_ends_at")
+
+	unknown := gigInput("Unknown", "2030-01-02")
+	unknown.Lineup = []models.LineupSlotInput{{ArtistID: "00000000-0000-0000-0000-000000000000"}}
+	rec = api.do(http.MethodPost, "/api/gigs", unknown, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "lineup[0].artist_id")
+
+	rec = api.do(http.MethodDelete, "/api/artists/"+support.ID, nil, token)
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, apperr.CodeConflict, "artist")
+}
+
+func TestFindGigsByArtist(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	band := api.createArtist(token, "Sonic Youth Orchestra")
+	other := api.createArtist(token, "Quiet Folk")
+
+	withBand := gigInput("Friday night", "2030-01-01")
+	withBand.Lineup = []models.LineupSlotInput{{ArtistID: band.ID}}
+	gig := api.createGig(token, withBand)
+	withOther := gigInput("Saturday night", "2030-01-02")
+	withOther.Lineup = []models.LineupSlotInput{{ArtistID: other.ID}}
+	api.createGig(token, withOther)
+	api.createGig(token, gigInput("Open mic", "2030-01-03"))
+
+	for _, path := range []string{
+		"/api/artists/" + band.ID + "/gigs",
+		"/api/gigs?artist=sonic+youth",
+		"/api/gigs?artist_id=" + band.ID,
+	} {
+		rec := api.do(http.MethodGet, path, nil, "")
+		expectStatus(t, rec, http.StatusOK)
+		var page models.GigListResponse
+		decode(t, rec, &page)
+		if page.Total != 1 || page.Data[0].ID != gig.ID {
+			t.Fatalf("%s = %+v", path, page)
+		}
+	}
+
+	expectStatus(t, api.do(http.MethodGet, "/api/artists/00000000-0000-0000-0000-000000000000/gigs", nil, ""), http.StatusNotFound)
+}
+
+func TestArtistCRUD(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	fanToken, _ := api.register("fan", models.RoleUser)
+
+	expectStatus(t, api.do(http.MethodPost, "/api/artists", models.ArtistInput{Name: "Nope"}, fanToken), http.StatusForbidden)
+	api.createArtist(token, "Jazz Trio Deluxe")
+	exact := api.createArtist(token, "Jazz Trio")
+
+	rec := api.do(http.MethodGet, "/api/artists?q=jazz+trio", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var artists []models.Artist
+	decode(t, rec, &artists)
+	if len(artists) != 2 || artists[0].ID != exact.ID {
+		t.Fatalf("search = %+v", artists)
+	}
+
+	bio := "Three of them"
+	update := models.ArtistInput{Name: "The Jazz Trio", Bio: &bio}
+	expectStatus(t, api.do(http.MethodPut, "/api/artists/"+exact.ID, update, otherToken), http.StatusForbidden)
+	rec = api.do(http.MethodPut, "/api/artists/"+exact.ID, update, token)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Artist
+	decode(t, rec, &updated)
+	if updated.Name != "The Jazz Trio" || updated.Bio == nil || *updated.Bio != bio {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	expectStatus(t, api.do(http.MethodDelete, "/api/artists/"+exact.ID, nil, otherToken), http.StatusForbidden)
+	expectStatus(t, api.do(http.MethodDelete, "/api/artists/"+exact.ID, nil, token), http.StatusOK)
+	expectStatus(t, api.do(http.MethodGet, "/api/artists/"+exact.ID, nil, ""), http.StatusNotFound)
+}
@@ -1,10 +1,18 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/jwtkeys"
+	"sunyi-api/internal/loginguard"
+	"sunyi-api/internal/mail"
 	"sunyi-api/internal/middleware"
 	"sunyi-api/internal/models"
 	"sunyi-api/internal/repository"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,52 +21,54 @@ import (
 )
 
 type AuthHandler struct {
-    userRepo  *repository.UserRepository
-    jwtSecret string
-    jwtExp    string
+    userRepo    repository.UserStore
+    sessionRepo repository.SessionStore
+    resetRepo   repository.PasswordResetStore
+    guard       *loginguard.Guard
+    keys        *jwtkeys.Keyring
+    mailer      mail.Mailer
+    appURL      string
+    jwtExp      time.Duration
+    refreshExp  time.Duration
+    background  *sync.WaitGroup
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository, jwtSecret, jwtExp string) *AuthHandler {
+func NewAuthHandler(
+    userRepo repository.UserStore,
+    sessionRepo repository.SessionStore,
+    resetRepo repository.PasswordResetStore,
+    guard *loginguard.Guard,
+    keys *jwtkeys.Keyring,
+    mailer mail.Mailer,
+    appURL string,
+    jwtExp, refreshExp time.Duration,
+    background *sync.WaitGroup,
+) *AuthHandler {
     return &AuthHandler{
-        userRepo:  userRepo,
-        jwtSecret: jwtSecret,
-        jwtExp:    jwtExp,
+        userRepo:    userRepo,
+        sessionRepo: sessionRepo,
+        resetRepo:   resetRepo,
+        guard:       guard,
+        keys:        keys,
+        mailer:      mailer,
+        appURL:      strings.TrimSuffix(appURL, "/"),
+        jwtExp:      jwtExp,
+        refreshExp:  refreshExp,
+        background:  background,
     }
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
     var input models.RegisterInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    // Check if email already exists
-    exists, err := h.userRepo.EmailExists(input.Email)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
-        return
-    }
-    if exists {
-        c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
-        return
-    }
-
-    // Check if username already exists
-    exists, err = h.userRepo.UsernameExists(input.Username)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check username"})
-        return
-    }
-    if exists {
-        c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+        c.Error(err).SetType(gin.ErrorTypeBind)
         return
     }
 
     // Hash password
     hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+        c.Error(err)
         return
     }
 
@@ -70,94 +80,118 @@ func (h *AuthHandler) Register(c *gin.Context) {
         Role:         input.Role,
     }
 
-    if err := h.userRepo.Create(user); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+    // The unique constraints on email and username decide conflicts, so
+    // concurrent registrations cannot both succeed.
+    if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
+        c.Error(err)
         return
     }
 
-    // Generate JWT token
-    token, err := h.generateToken(user)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-        return
+    // The account works without the email; the user can ask for another.
+    if err := h.sendVerificationEmail(c.Request.Context(), user); err != nil {
+        log.Printf("register: sending verification email to user %s: %v", user.ID, err)
     }
 
-    c.JSON(http.StatusCreated, models.AuthResponse{
-        Token: token,
-        User:  *user,
-    })
+    h.startSession(c, http.StatusCreated, user)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
     var input models.LoginInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        c.Error(err).SetType(gin.ErrorTypeBind)
         return
     }
 
-    // Get user by email
-    user, err := h.userRepo.GetByEmail(input.Email)
+    ctx := c.Request.Context()
+    attempt, err := h.guard.Begin(ctx, input.Email, c.ClientIP())
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+        c.Error(err)
         return
     }
-    if user == nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+
+    // Get user by email
+    user, err := h.userRepo.GetByEmail(ctx, input.Email)
+    if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+        if err := h.guard.Abandon(ctx, attempt); err != nil {
+            log.Printf("login: forgiving attempt %s: %v", attempt, err)
+        }
+        c.Error(err)
         return
     }
 
-    // Check password
-    if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+    // Check password. A missing account costs the same bcrypt comparison
+    // and counts as a failure the same way, so neither the response nor its
+    // timing tells whether the email is registered. The attempt is already
+    // recorded as a failure.
+    hash := dummyPasswordHash()
+    if user != nil {
+        hash = []byte(user.PasswordHash)
+    }
+    err = bcrypt.CompareHashAndPassword(hash, []byte(input.Password))
+    if user == nil || err != nil {
+        c.Error(apperr.Unauthorized("Invalid email or password"))
         return
     }
 
-    // Generate JWT token
-    token, err := h.generateToken(user)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+    if err := h.guard.Succeeded(ctx, input.Email, attempt); err != nil {
+        c.Error(err)
         return
     }
-
-    c.JSON(http.StatusOK, models.AuthResponse{
-        Token: token,
-        User:  *user,
-    })
+    h.startSession(c, http.StatusOK, user)
 }
 
+// dummyPasswordHash is what Login compares against when no account has the
+// email. It is made on first use, at the same cost as real hashes.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+    hash, err := bcrypt.GenerateFromPassword([]byte("no account has this password"), bcrypt.DefaultCost)
+    if err != nil {
+        panic(err)
+    }
+    return hash
+})
+
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
     userID, exists := c.Get("user_id")
     if !exists {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+        c.Error(apperr.Unauthorized("User not authenticated"))
         return
     }
 
-    user, err := h.userRepo.GetByID(userID.(string))
+    user, err := h.userRepo.GetByID(c.Request.Context(), userID.(string))
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-        return
-    }
-    if user == nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        c.Error(err)
         return
     }
 
     c.JSON(http.StatusOK, user)
 }
 
-func (h *AuthHandler) generateToken(user *models.User) (string, error) {
-    expirationTime, _ := time.ParseDuration(h.jwtExp)
-    
+// generateToken issues an access token for the user's session.
+func (h *AuthHandler) generateToken(user *models.User, sessionID string) (string, time.Time, error) {
+    now := time.Now()
+    expiresAt := now.Add(h.jwtExp)
     claims := &middleware.Claims{
-        UserID: user.ID,
-        Email:  user.Email,
-        Role:   user.Role,
+        UserID:        user.ID,
+        Email:         user.Email,
+        Role:          user.Role,
+        EmailVerified: user.IsEmailVerified(),
+        SessionID:     sessionID,
         RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(expirationTime)),
-            IssuedAt:  jwt.NewNumericDate(time.Now()),
+            Issuer:    h.keys.Issuer(),
+            Subject:   user.ID,
+            ExpiresAt: jwt.NewNumericDate(expiresAt),
+            IssuedAt:  jwt.NewNumericDate(now),
         },
     }
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(h.jwtSecret))
-}
\ No newline at end of file
+    signed, err := h.keys.Sign(claims)
+    return signed, expiresAt, err
+}
+
+// GetJWKS publishes the public keys tokens may be signed with, for other
+// services to verify them. Caches may keep it for a few minutes, so a new
+// key is published well before it starts signing.
+func (h *AuthHandler) GetJWKS(c *gin.Context) {
+    c.Header("Cache-Control", "public, max-age=300")
+    c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,773 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/jwtkeys"
+	"sunyi-api/internal/mail"
+	"sunyi-api/internal/middleware"
+	"sunyi-api/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	api := newTestAPI(t)
+	token, user := api.register("alice", models.RoleUser)
+	if token == "" || user.ID == "" {
+		t.Fatalf("register returned token %q, user %+v", token, user)
+	}
+
+	rec := api.do(http.MethodPost, "/api/auth/login", models.LoginInput{
+		Email:    "alice@example.com",
+		Password: "password123",
+	}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = api.do(http.MethodPost, "/api/auth/login", models.LoginInput{
+		Email:    "alice@example.com",
+		Password: "wrong-password",
+	}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = api.do(http.MethodPost, "/api/auth/login", models.LoginInput{
+		Email:    "nobody@example.com",
+		Password: "password123",
+	}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestRegisterDuplicates(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+
+	rec := api.do(http.MethodPost, "/api/auth/register", models.RegisterInput{
+		Username: "alice2",
+		Email:    "alice@example.com",
+		Password: "password123",
+		Role:     models.RoleUser,
+	}, "")
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, apperr.CodeConflict, "email")
+
+	rec = api.do(http.MethodPost, "/api/auth/register", models.RegisterInput{
+		Username: "alice",
+		Email:    "other@example.com",
+		Password: "password123",
+		Role:     models.RoleUser,
+	}, "")
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, apperr.CodeConflict, "username")
+}
+
+func TestRegisterValidation(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.do(http.MethodPost, "/api/auth/register", models.RegisterInput{
+		Username: "alice",
+		Email:    "not-an-email",
+		Password: "password123",
+		Role:     models.RoleUser,
+	}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	var body middleware.ErrorResponse
+	decode(t, rec, &body)
+	if body.Code != apperr.CodeValidation || body.Field != "email" || body.Fields["email"] != "email" {
+		t.Fatalf("error body = %+v", body)
+	}
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	api := newTestAPI(t)
+	token, user := api.register("alice", models.RoleUser)
+
+	rec := api.do(http.MethodGet, "/api/auth/me", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var me models.User
+	decode(t, rec, &me)
+	if me.ID != user.ID || me.Email != "alice@example.com" {
+		t.Fatalf("me = %+v, want %+v", me, user)
+	}
+
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, ""), http.StatusUnauthorized)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, "not-a-token"), http.StatusUnauthorized)
+}
+
+// login signs in again as a user created by register, starting a new
+// session.
+func (a *testAPI) login(username string) models.AuthResponse {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/api/auth/login", models.LoginInput{
+		Email:    username + "@example.com",
+		Password: "password123",
+	}, "")
+	expectStatus(a.t, rec, http.StatusOK)
+	var resp models.AuthResponse
+	decode(a.t, rec, &resp)
+	return resp
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+	first := api.login("alice")
+	if first.RefreshToken == "" || first.ExpiresAt.IsZero() {
+		t.Fatalf("login response = %+v", first)
+	}
+
+	rec := api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: first.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusOK)
+	var second models.AuthResponse
+	decode(t, rec, &second)
+	if second.RefreshToken == first.RefreshToken || second.User.Username != "alice" {
+		t.Fatalf("refresh response = %+v", second)
+	}
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, second.Token), http.StatusOK)
+
+	// Replaying the spent token revokes the session, so neither the thief
+	// nor the rightful holder can use it any longer.
+	rec = api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: first.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+	expectError(t, rec, apperr.CodeRefreshTokenReused, "")
+
+	rec = api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: second.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+	expectError(t, rec, apperr.CodeSessionEnded, "")
+	rec = api.do(http.MethodGet, "/api/auth/me", nil, second.Token)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	expectError(t, rec, apperr.CodeSessionEnded, "")
+
+	rec = api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: "made-up"}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+	expectError(t, rec, apperr.CodeUnauthorized, "")
+}
+
+func TestLogoutAndSessions(t *testing.T) {
+	api := newTestAPI(t)
+	registered, _ := api.register("alice", models.RoleUser)
+	laptop := api.login("alice")
+	phone := api.login("alice")
+	bobToken, _ := api.register("bob", models.RoleUser)
+
+	rec := api.do(http.MethodGet, "/api/auth/sessions", nil, laptop.Token)
+	expectStatus(t, rec, http.StatusOK)
+	var sessions []models.Session
+	decode(t, rec, &sessions)
+	// Registering started a session too.
+	if len(sessions) != 3 {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	var current, phoneID string
+	for _, session := range sessions {
+		if session.Current {
+			current = session.ID
+		}
+	}
+	if current == "" {
+		t.Fatalf("no current session in %+v", sessions)
+	}
+
+	rec = api.do(http.MethodGet, "/api/auth/sessions", nil, phone.Token)
+	decode(t, rec, &sessions)
+	for _, session := range sessions {
+		if session.Current {
+			phoneID = session.ID
+		}
+	}
+
+	// Only the owner can revoke a session.
+	expectStatus(t, api.do(http.MethodDelete, "/api/auth/sessions/"+phoneID, nil, bobToken), http.StatusNotFound)
+	expectStatus(t, api.do(http.MethodDelete, "/api/auth/sessions/"+phoneID, nil, laptop.Token), http.StatusNoContent)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, phone.Token), http.StatusUnauthorized)
+	expectStatus(t, api.do(http.MethodDelete, "/api/auth/sessions/"+phoneID, nil, laptop.Token), http.StatusNotFound)
+
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/logout", nil, laptop.Token), http.StatusNoContent)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, laptop.Token), http.StatusUnauthorized)
+	rec = api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: laptop.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// Signing out everywhere ends the session registering started too.
+	tablet := api.login("alice")
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/logout?all=true", nil, tablet.Token), http.StatusNoContent)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, tablet.Token), http.StatusUnauthorized)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, registered), http.StatusUnauthorized)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, bobToken), http.StatusOK)
+}
+
+// sessionClaims signs in and returns the claims of the access token issued,
+// for forging tokens for a live session.
+func (a *testAPI) sessionClaims(username string) middleware.Claims {
+	a.t.Helper()
+	var claims middleware.Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(a.login(username).Token, &claims); err != nil {
+		a.t.Fatal(err)
+	}
+	return claims
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.Claims, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestTokensAreVerifiableWithJWKS(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+	issued := api.login("alice").Token
+
+	rec := api.do(http.MethodGet, "/.well-known/jwks.json", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var set jwtkeys.JWKSet
+	decode(t, rec, &set)
+	// The retired HMAC key is secret and stays out of the set.
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != testSigningKeyID || set.Keys[0].KeyType != "OKP" ||
+		set.Keys[0].Algorithm != "EdDSA" || set.Keys[0].Curve != "Ed25519" {
+		t.Fatalf("jwks = %+v", set)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(set.Keys[0].X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims middleware.Claims
+	token, err := jwt.ParseWithClaims(issued, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != testSigningKeyID {
+			return nil, fmt.Errorf("kid = %v", token.Header["kid"])
+		}
+		return ed25519.PublicKey(x), nil
+	}, jwt.WithValidMethods([]string{"EdDSA"}), jwt.WithIssuer("sunyi-test"))
+	if err != nil || !token.Valid || claims.SessionID == "" {
+		t.Fatalf("verify with JWKS key: %v, claims %+v", err, claims)
+	}
+}
+
+func TestRetiredKeyStillVerifies(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+	claims := api.sessionClaims("alice")
+
+	token := signToken(t, jwt.SigningMethodHS256, testRetiredKeyID, claims, api.retiredSecret)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, token), http.StatusOK)
+}
+
+func TestForgedTokensAreRejected(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+	claims := api.sessionClaims("alice")
+	public := api.signingKey.Public().(ed25519.PublicKey)
+	_, stranger, _ := ed25519.GenerateKey(rand.Reader)
+
+	foreignIssuer := claims
+	foreignIssuer.Issuer = "someone-else"
+	noExpiry := claims
+	noExpiry.ExpiresAt = nil
+
+	for name, token := range map[string]string{
+		"alg none":             signToken(t, jwt.SigningMethodNone, testSigningKeyID, claims, jwt.UnsafeAllowNoneSignatureType),
+		"public key as secret": signToken(t, jwt.SigningMethodHS256, testSigningKeyID, claims, []byte(public)),
+		"wrong alg for kid":    signToken(t, jwt.SigningMethodEdDSA, testRetiredKeyID, claims, stranger),
+		"unknown kid":          signToken(t, jwt.SigningMethodHS256, "nope", claims, api.retiredSecret),
+		"no kid":               signToken(t, jwt.SigningMethodHS256, "", claims, api.retiredSecret),
+		"other key":            signToken(t, jwt.SigningMethodEdDSA, testSigningKeyID, claims, stranger),
+		"foreign issuer":       signToken(t, jwt.SigningMethodEdDSA, testSigningKeyID, foreignIssuer, api.signingKey),
+		"no expiry":            signToken(t, jwt.SigningMethodEdDSA, testSigningKeyID, noExpiry, api.signingKey),
+	} {
+		rec := api.do(http.MethodGet, "/api/auth/me", nil, token)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, rec.Code)
+		}
+	}
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil,
+		signToken(t, jwt.SigningMethodEdDSA, testSigningKeyID, claims, api.signingKey)), http.StatusOK)
+}
+
+func TestKeysLoadedFromDirectory(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+	before := api.login("alice")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	publicDER, err := x509.MarshalPKIXPublicKey(retiredPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"2026-10.pem":     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		"2026-01.pem":     pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		"previous.secret": append(api.retiredSecret, '\n'),
+		"README":          []byte("not a key"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := api.cfg.JWT
+	cfg.KeysDir = dir
+	cfg.SigningKeyID = "2026-10"
+	keys, err := jwtkeys.Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.useKeys(keys)
+
+	// Sessions outlive the signing key: the refresh token is not a JWT.
+	rec := api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: before.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusOK)
+	var refreshed models.AuthResponse
+	decode(t, rec, &refreshed)
+	token, _, err := jwt.NewParser().ParseUnverified(refreshed.Token, &middleware.Claims{})
+	if err != nil || token.Header["kid"] != "2026-10" || token.Method.Alg() != "RS256" {
+		t.Fatalf("refreshed token header = %v (%v)", token.Header, err)
+	}
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, refreshed.Token), http.StatusOK)
+
+	rec = api.do(http.MethodGet, "/.well-known/jwks.json", nil, "")
+	var set jwtkeys.JWKSet
+	decode(t, rec, &set)
+	if len(set.Keys) != 2 || set.Keys[0].KeyID != "2026-10" || set.Keys[0].KeyType != "RSA" || set.Keys[1].KeyID != "2026-01" {
+		t.Fatalf("jwks = %+v", set)
+	}
+
+	// A public key cannot sign, and a short secret is refused.
+	cfg.SigningKeyID = "2026-01"
+	if _, err := jwtkeys.Load(cfg); err == nil {
+		t.Error("loaded a keyring signing with a public key")
+	}
+	os.WriteFile(filepath.Join(dir, "short.secret"), []byte("too short"), 0o600)
+	cfg.SigningKeyID = "2026-10"
+	if _, err := jwtkeys.Load(cfg); err == nil {
+		t.Error("loaded a short HMAC secret")
+	}
+}
+
+// mailedToken returns the token in the link of the last email sent to the
+// address.
+func (a *testAPI) mailedToken(email string) string {
+	a.t.Helper()
+	sent := a.mailer.Sent(email)
+	if len(sent) == 0 {
+		a.t.Fatalf("no email sent to %s", email)
+	}
+	body := sent[len(sent)-1].Body
+	start := strings.Index(body, "token=")
+	if start < 0 {
+		a.t.Fatalf("no link with a token in %q", body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(body[start+len("token="):])[0])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return token
+}
+
+func TestEmailVerification(t *testing.T) {
+	api := newTestAPI(t)
+	api.configure(func(cfg *config.Config) { cfg.Auth.RequireVerifiedEmail = true })
+	now := time.Now()
+	api.store.SetClock(func() time.Time { return now })
+
+	token, user := api.register("alice", models.RoleOrganizer)
+	if user.EmailVerifiedAt != nil {
+		t.Fatalf("new user is verified: %+v", user)
+	}
+	rec := api.do(http.MethodPost, "/api/gigs", gigInput("Unverified", "2030-06-01"), token)
+	expectStatus(t, rec, http.StatusForbidden)
+	expectError(t, rec, apperr.CodeEmailUnverified, "")
+
+	// Register mailed a link a moment ago, so a resend has to wait.
+	rec = api.do(http.MethodPost, "/api/auth/verify-email/resend", nil, token)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	expectError(t, rec, apperr.CodeTooManyRequests, "")
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Fatalf("Retry-After = %q, want 60", got)
+	}
+	now = now.Add(2 * time.Minute)
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/verify-email/resend", nil, token), http.StatusNoContent)
+	if sent := api.mailer.Sent("alice@example.com"); len(sent) != 2 {
+		t.Fatalf("sent %d emails, want 2", len(sent))
+	}
+
+	// Access tokens are signed by the same keys but are not verification
+	// tokens.
+	rec = api.do(http.MethodPost, "/api/auth/verify-email", models.VerifyEmailInput{Token: token}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeInvalidToken, "token")
+
+	link := api.mailedToken("alice@example.com")
+	rec = api.do(http.MethodPost, "/api/auth/verify-email", models.VerifyEmailInput{Token: link}, "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &user)
+	if user.EmailVerifiedAt == nil {
+		t.Fatalf("verified user = %+v", user)
+	}
+
+	rec = api.do(http.MethodPost, "/api/auth/verify-email", models.VerifyEmailInput{Token: link}, "")
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, apperr.CodeEmailVerified, "email")
+	rec = api.do(http.MethodPost, "/api/auth/verify-email/resend", nil, token)
+	expectStatus(t, rec, http.StatusConflict)
+
+	// The old access token still says unverified; a fresh one does not.
+	fresh := api.login("alice")
+	api.createGig(fresh.Token, gigInput("Verified", "2030-06-01"))
+}
+
+func TestPasswordReset(t *testing.T) {
+	api := newTestAPI(t)
+	now := time.Now()
+	api.store.SetClock(func() time.Time { return now })
+	api.register("alice", models.RoleUser)
+	signedIn := api.login("alice")
+	mailed := len(api.mailer.Sent("alice@example.com"))
+
+	// Unknown and known addresses get the same answer.
+	unknown := api.do(http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordInput{Email: "nobody@example.com"}, "")
+	expectStatus(t, unknown, http.StatusOK)
+	rec := api.do(http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordInput{Email: "alice@example.com"}, "")
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != unknown.Body.String() {
+		t.Fatalf("responses differ: %s vs %s", rec.Body.String(), unknown.Body.String())
+	}
+	if sent := api.mailer.Sent("alice@example.com"); len(sent) != mailed+1 {
+		t.Fatalf("sent %d emails, want %d", len(sent), mailed+1)
+	}
+	if sent := api.mailer.Sent("nobody@example.com"); len(sent) != 0 {
+		t.Fatalf("mailed an unknown address: %+v", sent)
+	}
+	token := api.mailedToken("alice@example.com")
+
+	// Asking again right away is answered the same but sends nothing.
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordInput{Email: "alice@example.com"}, ""), http.StatusOK)
+	if sent := api.mailer.Sent("alice@example.com"); len(sent) != mailed+1 {
+		t.Fatalf("sent %d emails, want %d", len(sent), mailed+1)
+	}
+
+	rec = api.do(http.MethodPost, "/api/auth/reset-password", models.ResetPasswordInput{Token: "made-up", Password: "new-password"}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeInvalidToken, "token")
+
+	reset := models.ResetPasswordInput{Token: token, Password: "new-password"}
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/reset-password", reset, ""), http.StatusNoContent)
+	rec = api.do(http.MethodPost, "/api/auth/reset-password", reset, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeInvalidToken, "token")
+
+	// Every session ended with the reset.
+	rec = api.do(http.MethodGet, "/api/auth/me", nil, signedIn.Token)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	expectError(t, rec, apperr.CodeSessionEnded, "")
+	rec = api.do(http.MethodPost, "/api/auth/refresh", models.RefreshInput{RefreshToken: signedIn.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	login := models.LoginInput{Email: "alice@example.com", Password: "password123"}
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/login", login, ""), http.StatusUnauthorized)
+	login.Password = "new-password"
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/login", login, ""), http.StatusOK)
+
+	// Links expire.
+	now = now.Add(2 * time.Minute)
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/forgot-password", models.ForgotPasswordInput{Email: "alice@example.com"}, ""), http.StatusOK)
+	token = api.mailedToken("alice@example.com")
+	now = now.Add(2 * time.Hour)
+	rec = api.do(http.MethodPost, "/api/auth/reset-password", models.ResetPasswordInput{Token: token, Password: "another-password"}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeInvalidToken, "token")
+}
+
+// blockingMailer holds every send until release is closed.
+type blockingMailer struct {
+	*mail.MemoryMailer
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	<-m.release
+	return m.MemoryMailer.Send(ctx, msg)
+}
+
+func TestForgotPasswordDoesNotWaitForMail(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("alice", models.RoleUser)
+	mailer := blockingMailer{MemoryMailer: mail.NewMemoryMailer(), release: make(chan struct{})}
+	api.stores.Mail = mailer
+	api.configure(func(*config.Config) {})
+
+	// A registered address answers as soon as an unknown one, while its
+	// link is still being sent.
+	body := strings.NewReader(`{"email":"alice@example.com"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/forgot-password", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	answered := make(chan struct{})
+	go func() {
+		api.router.ServeHTTP(rec, req)
+		close(answered)
+	}()
+	select {
+	case <-answered:
+	case <-time.After(5 * time.Second):
+		close(mailer.release)
+		t.Fatal("forgot-password waited for the mail to be sent")
+	}
+	expectStatus(t, rec, http.StatusOK)
+
+	close(mailer.release)
+	api.stores.Background.Wait()
+	if sent := mailer.Sent("alice@example.com"); len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("alice", models.RoleUser)
+	other := api.login("alice")
+
+	rec := api.do(http.MethodPost, "/api/auth/change-password", models.ChangePasswordInput{
+		CurrentPassword: "wrong-password",
+		NewPassword:     "new-password",
+	}, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "current_password")
+
+	rec = api.do(http.MethodPost, "/api/auth/change-password", models.ChangePasswordInput{
+		CurrentPassword: "password123",
+		NewPassword:     "short",
+	}, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "new_password")
+
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/change-password", nil, ""), http.StatusUnauthorized)
+
+	rec = api.do(http.MethodPost, "/api/auth/change-password", models.ChangePasswordInput{
+		CurrentPassword: "password123",
+		NewPassword:     "new-password",
+	}, token)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	// The session that changed it stays signed in; the others do not.
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, token), http.StatusOK)
+	expectStatus(t, api.do(http.MethodGet, "/api/auth/me", nil, other.Token), http.StatusUnauthorized)
+
+	login := models.LoginInput{Email: "alice@example.com", Password: "password123"}
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/login", login, ""), http.StatusUnauthorized)
+	login.Password = "new-password"
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/login", login, ""), http.StatusOK)
+}
+
+func TestLoginBackoffAndLock(t *testing.T) {
+	api := newTestAPI(t)
+	api.configure(func(cfg *config.Config) {
+		cfg.Auth.Login = config.LoginThrottleConfig{MaxFailures: 3, Lockout: 15 * time.Minute, Backoff: time.Second, IPMaxFailures: 50}
+	})
+	now := time.Now()
+	api.store.SetClock(func() time.Time { return now })
+	api.register("alice", models.RoleUser)
+
+	attempt := func(email, password string) *httptest.ResponseRecorder {
+		return api.do(http.MethodPost, "/api/auth/login", models.LoginInput{Email: email, Password: password}, "")
+	}
+	expectThrottled := func(rec *httptest.ResponseRecorder, code, retryAfter string) {
+		t.Helper()
+		expectStatus(t, rec, http.StatusTooManyRequests)
+		expectError(t, rec, code, "")
+		if got := rec.Header().Get("Retry-After"); got != retryAfter {
+			t.Fatalf("Retry-After = %q, want %q", got, retryAfter)
+		}
+	}
+
+	// An account that exists and one that does not are throttled alike.
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		expectStatus(t, attempt(email, "wrong-password"), http.StatusUnauthorized)
+		expectThrottled(attempt(email, "wrong-password"), apperr.CodeTooManyRequests, "1")
+		now = now.Add(time.Second)
+		expectStatus(t, attempt(email, "wrong-password"), http.StatusUnauthorized)
+		expectThrottled(attempt(email, "wrong-password"), apperr.CodeTooManyRequests, "2")
+		now = now.Add(2 * time.Second)
+		expectStatus(t, attempt(email, "wrong-password"), http.StatusUnauthorized)
+		expectThrottled(attempt(email, "password123"), apperr.CodeAccountLocked, "900")
+	}
+
+	// Case variants of the address share its lock, which has run 3s.
+	expectThrottled(attempt("Alice@Example.com", "password123"), apperr.CodeAccountLocked, "897")
+
+	now = now.Add(15 * time.Minute)
+	expectStatus(t, attempt("alice@example.com", "password123"), http.StatusOK)
+
+	// Signing in forgave the earlier failures.
+	expectStatus(t, attempt("alice@example.com", "wrong-password"), http.StatusUnauthorized)
+	expectThrottled(attempt("alice@example.com", "wrong-password"), apperr.CodeTooManyRequests, "1")
+}
+
+func TestLoginThrottledByAddress(t *testing.T) {
+	api := newTestAPI(t)
+	api.configure(func(cfg *config.Config) {
+		cfg.Auth.Login = config.LoginThrottleConfig{MaxFailures: 10, Lockout: 15 * time.Minute, Backoff: time.Second, IPMaxFailures: 2}
+	})
+	now := time.Now()
+	api.store.SetClock(func() time.Time { return now })
+	api.register("alice", models.RoleUser)
+
+	// Guessing one password across accounts trips the address's limit.
+	for _, email := range []string{"bob@example.com", "carol@example.com"} {
+		rec := api.do(http.MethodPost, "/api/auth/login", models.LoginInput{Email: email, Password: "password123"}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	}
+	rec := api.do(http.MethodPost, "/api/auth/login", models.LoginInput{Email: "alice@example.com", Password: "password123"}, "")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+
+	now = now.Add(time.Second)
+	rec = api.do(http.MethodPost, "/api/auth/login", models.LoginInput{Email: "alice@example.com", Password: "password123"}, "")
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestLoginBurstIsThrottled(t *testing.T) {
+	api := newTestAPI(t)
+	api.configure(func(cfg *config.Config) {
+		cfg.Auth.Login = config.LoginThrottleConfig{MaxFailures: 3, Lockout: 15 * time.Minute, IPMaxFailures: 50}
+	})
+	api.register("alice", models.RoleUser)
+
+	// Guesses sent all at once must not all be checked before any of them
+	// is counted.
+	const burst = 20
+	statuses := make(chan int, burst)
+	var wg sync.WaitGroup
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := api.do(http.MethodPost, "/api/auth/login", models.LoginInput{Email: "alice@example.com", Password: "wrong-password"}, "")
+			statuses <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != 3 || counts[http.StatusTooManyRequests] != burst-3 {
+		t.Fatalf("statuses = %v, want 3 x 401 and %d x 429", counts, burst-3)
+	}
+}
+
+func TestLoginLockRunsFromLastFailure(t *testing.T) {
+	api := newTestAPI(t)
+	api.configure(func(cfg *config.Config) {
+		cfg.Auth.Login = config.LoginThrottleConfig{MaxFailures: 3, Lockout: 15 * time.Minute, IPMaxFailures: 50}
+	})
+	start := time.Now()
+	now := start
+	api.store.SetClock(func() time.Time { return now })
+	api.register("alice", models.RoleUser)
+
+	wrong := models.LoginInput{Email: "alice@example.com", Password: "wrong-password"}
+	for _, at := range []time.Duration{0, 10 * time.Minute, 12 * time.Minute} {
+		now = start.Add(at)
+		expectStatus(t, api.do(http.MethodPost, "/api/auth/login", wrong, ""), http.StatusUnauthorized)
+	}
+
+	// The first failure has left the window, but the lock is measured from
+	// the third, which set it.
+	now = start.Add(16 * time.Minute)
+	right := models.LoginInput{Email: "alice@example.com", Password: "password123"}
+	rec := api.do(http.MethodPost, "/api/auth/login", right, "")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	expectError(t, rec, apperr.CodeAccountLocked, "")
+	if got := rec.Header().Get("Retry-After"); got != "660" {
+		t.Fatalf("Retry-After = %q, want 660", got)
+	}
+
+	now = start.Add(27 * time.Minute)
+	expectStatus(t, api.do(http.MethodPost, "/api/auth/login", right, ""), http.StatusOK)
+}
+
+func TestLoginIgnoresForgedForwardedFor(t *testing.T) {
+	api := newTestAPI(t)
+	api.configure(func(cfg *config.Config) {
+		cfg.Auth.Login = config.LoginThrottleConfig{MaxFailures: 10, Lockout: 15 * time.Minute, Backoff: time.Second, IPMaxFailures: 2}
+	})
+	now := time.Now()
+	api.store.SetClock(func() time.Time { return now })
+
+	// No proxies are trusted, so a new claimed address on each request
+	// does not get the attacker a fresh allowance.
+	for i, email := range []string{"bob@example.com", "carol@example.com", "dave@example.com"} {
+		rec := api.do(http.MethodPost, "/api/auth/login", models.LoginInput{Email: email, Password: "password123"}, "",
+			"X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1),
+			"X-Real-IP", fmt.Sprintf("198.51.100.%d", i+1))
+		want := http.StatusUnauthorized
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		expectStatus(t, rec, want)
+	}
+}
+
+func TestAdminClearsLoginLock(t *testing.T) {
+	api := newTestAPI(t)
+	userToken, _ := api.register("alice", models.RoleUser)
+	_, root := api.register("root", models.RoleUser)
+	root.Role = models.RoleAdmin
+	if err := api.store.Users.Update(context.Background(), &root); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := api.login("root").Token
+
+	wrong := models.LoginInput{Email: "alice@example.com", Password: "wrong-password"}
+	for i := 0; i < api.cfg.Auth.Login.MaxFailures; i++ {
+		expectStatus(t, api.do(http.MethodPost, "/api/auth/login", wrong, ""), http.StatusUnauthorized)
+	}
+	rec := api.do(http.MethodPost, "/api/auth/login", wrong, "")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	expectError(t, rec, apperr.CodeAccountLocked, "")
+
+	expectStatus(t, api.do(http.MethodDelete, "/api/admin/login-locks?email=alice@example.com", nil, userToken), http.StatusForbidden)
+	expectStatus(t, api.do(http.MethodDelete, "/api/admin/login-locks", nil, adminToken), http.StatusBadRequest)
+
+	rec = api.do(http.MethodDelete, "/api/admin/login-locks?email=alice@example.com", nil, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Cleared int `json:"cleared"`
+	}
+	decode(t, rec, &body)
+	if body.Cleared != api.cfg.Auth.Login.MaxFailures {
+		t.Fatalf("cleared = %d, want %d", body.Cleared, api.cfg.Auth.Login.MaxFailures)
+	}
+	api.login("alice")
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+	"sunyi-api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GenreHandler struct {
+    genreRepo repository.GenreStore
+}
+
+func NewGenreHandler(genreRepo repository.GenreStore) *GenreHandler {
+    return &GenreHandler{genreRepo: genreRepo}
+}
+
+// GetGenres lists the genre taxonomy, each genre with its parent and how
+// many upcoming gigs it and its sub-genres have.
+func (h *GenreHandler) GetGenres(c *gin.Context) {
+    genres, err := h.genreRepo.List(c.Request.Context())
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, genres)
+}
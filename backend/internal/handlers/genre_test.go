@@ -0,0 +1,67 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+)
+
+func TestGigGenresResolveToSlugs(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+
+	input := gigInput("Crossover", "2030-01-01")
+	input.Genres = []string{"Hip-Hop", "R & B", "hiphop", "Shoegaze"}
+	gig := api.createGig(token, input)
+	if len(gig.Genres) != 3 || gig.Genres[0] != "hip-hop" || gig.Genres[1] != "r-and-b" || gig.Genres[2] != "shoegaze" {
+		t.Fatalf("genres = %v", gig.Genres)
+	}
+
+	input = gigInput("Mystery", "2030-01-02")
+	input.Genres = []string{"jazz", "space polka"}
+	rec := api.do(http.MethodPost, "/api/gigs", input, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "genres[1]")
+}
+
+func TestGenreFilterIncludesSubGenres(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+
+	for _, g := range []struct{ title, genre string }{
+		{"Wall of sound", "shoegaze"},
+		{"Riffs", "rock"},
+		{"Four to the floor", "techno"},
+	} {
+		input := gigInput(g.title, "2030-01-01")
+		input.Genres = []string{g.genre}
+		api.createGig(token, input)
+	}
+
+	for query, want := range map[string]int{"rock": 2, "Shoegaze": 1, "EDM": 1, "polka": 0} {
+		rec := api.do(http.MethodGet, "/api/gigs?genre="+query, nil, "")
+		expectStatus(t, rec, http.StatusOK)
+		var resp models.GigListResponse
+		decode(t, rec, &resp)
+		if resp.Total != want {
+			t.Errorf("genre=%s: total = %d, want %d", query, resp.Total, want)
+		}
+	}
+
+	rec := api.do(http.MethodGet, "/api/genres", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var genres []models.Genre
+	decode(t, rec, &genres)
+	counts := map[string]int{}
+	for _, genre := range genres {
+		counts[genre.Slug] = genre.UpcomingGigs
+		if genre.Slug == "shoegaze" && (genre.Parent == nil || *genre.Parent != "rock") {
+			t.Errorf("shoegaze parent = %v", genre.Parent)
+		}
+	}
+	if counts["rock"] != 2 || counts["shoegaze"] != 1 || counts["electronic"] != 1 || counts["jazz"] != 0 {
+		t.Fatalf("upcoming counts = %v", counts)
+	}
+}
@@ -1,169 +1,985 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/geo"
+	"sunyi-api/internal/imaging"
+	"sunyi-api/internal/mergepatch"
 	"sunyi-api/internal/models"
 	"sunyi-api/internal/repository"
+	"sunyi-api/internal/storage"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// codeInvalidTransition marks a status change the gig's current status does
+// not allow.
+const codeInvalidTransition = "invalid_status_transition"
+
+const maxPatchSize = 1 << 20 // 1 mb
+
+const maxGigImageSize = 10 << 20 // 10 mb
+
+// gigThumbnails are the resized copies made of every gig image, by name and
+// width in pixels.
+var gigThumbnails = []struct {
+    name  string
+    width int
+}{
+    {"small", 320},
+    {"medium", 960},
+}
+
 type GigHandler struct {
-    gigRepo *repository.GigRepository
+    gigRepo    repository.GigStore
+    venueRepo  repository.VenueStore
+    artistRepo repository.ArtistStore
+    genreRepo  repository.GenreStore
+    blobs      storage.BlobStore
 }
 
-func NewGigHandler(gigRepo *repository.GigRepository) *GigHandler {
-    return &GigHandler{gigRepo: gigRepo}
+func NewGigHandler(
+    gigRepo repository.GigStore,
+    venueRepo repository.VenueStore,
+    artistRepo repository.ArtistStore,
+    genreRepo repository.GenreStore,
+    blobs storage.BlobStore,
+) *GigHandler {
+    return &GigHandler{
+        gigRepo:    gigRepo,
+        venueRepo:  venueRepo,
+        artistRepo: artistRepo,
+        genreRepo:  genreRepo,
+        blobs:      blobs,
+    }
 }
 
 func (h *GigHandler) CreateGig(c *gin.Context) {
     var input models.CreateGigInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        c.Error(err).SetType(gin.ErrorTypeBind)
         return
     }
 
     // Get organizer ID from JWT token
     organizerID, exists := c.Get("user_id")
     if !exists {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+        c.Error(apperr.Unauthorized("User not authenticated"))
+        return
+    }
+
+    startsAt, endsAt, err := gigSchedule(input.StartsAt, input.EndsAt, input.Timezone)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    venue, err := h.resolveNewGigVenue(c.Request.Context(), input, organizerID.(string))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    genres, err := h.gigGenres(c.Request.Context(), input.Genres)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    lineup, err := h.gigLineup(c.Request.Context(), input.Lineup, input.Timezone)
+    if err != nil {
+        c.Error(err)
         return
     }
 
+    status := input.Status
+    if status == "" {
+        status = models.GigStatusDraft
+    }
+
     gig := &models.Gig{
-        Title:        input.Title,
-        Description:  input.Description,
-        VenueName:    input.VenueName,
-        VenueAddress: input.VenueAddress,
-        Latitude:     input.Latitude,
-        Longitude:    input.Longitude,
-        Date:         input.Date,
-        StartTime:    input.StartTime,
-        EndTime:      input.EndTime,
-        Price:        input.Price,
-        OrganizerID:  organizerID.(string),
-        Genres:       input.Genres,
+        Title:       input.Title,
+        Description: input.Description,
+        StartsAt:    startsAt,
+        EndsAt:      endsAt,
+        Timezone:    input.Timezone,
+        Price:       input.Price,
+        OrganizerID: organizerID.(string),
+        Genres:      genres,
+        Status:      status,
+        Lineup:      lineup,
     }
+    gig.SetVenue(venue)
 
-    if err := h.gigRepo.Create(gig); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create gig"})
+    if err := h.gigRepo.Create(c.Request.Context(), gig); err != nil {
+        c.Error(err)
         return
     }
 
+    c.Header("ETag", gigETag(gig))
     c.JSON(http.StatusCreated, gig)
 }
 
+// resolveNewGigVenue finds the venue a new gig takes place at: the one
+// named by venue_id, or else an existing venue close to the inline venue
+// with a similar name, so the same club is not added once per spelling.
+// Only when nothing matches is a new venue created.
+func (h *GigHandler) resolveNewGigVenue(ctx context.Context, input models.CreateGigInput, organizerID string) (*models.Venue, error) {
+    switch {
+    case input.VenueID != "" && input.Venue != nil:
+        return nil, apperr.InvalidField("venue", "Give either venue_id or venue, not both")
+    case input.VenueID != "":
+        return h.gigVenue(ctx, input.VenueID)
+    case input.Venue == nil:
+        return nil, apperr.InvalidField("venue_id", "Venue is required")
+    }
+
+    nearby, err := h.venueRepo.List(ctx, models.VenueFilter{
+        Latitude:  &input.Venue.Latitude,
+        Longitude: &input.Venue.Longitude,
+        RadiusKm:  models.VenueMatchRadiusKm,
+        Limit:     repository.MaxGigPageSize,
+    })
+    if err != nil {
+        return nil, err
+    }
+    if match := models.MatchVenue(nearby, input.Venue.Name); match != nil {
+        match.DistanceKm = nil
+        return match, nil
+    }
+
+    venue := &models.Venue{
+        Name:      input.Venue.Name,
+        Address:   input.Venue.Address,
+        Latitude:  input.Venue.Latitude,
+        Longitude: input.Venue.Longitude,
+        CreatedBy: &organizerID,
+    }
+    if err := h.venueRepo.Create(ctx, venue); err != nil {
+        return nil, err
+    }
+    return venue, nil
+}
+
+// gigVenue loads the venue a gig input refers to, reporting a missing one
+// against venue_id rather than as a missing resource.
+func (h *GigHandler) gigVenue(ctx context.Context, id string) (*models.Venue, error) {
+    if id == "" {
+        return nil, apperr.InvalidField("venue_id", "Venue is required")
+    }
+    venue, err := h.venueRepo.GetByID(ctx, id)
+    if errors.Is(err, apperr.ErrNotFound) {
+        return nil, apperr.InvalidField("venue_id", "Venue does not exist")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return venue, nil
+}
+
+// gigGenres resolves genre names as organizers typed them to canonical
+// slugs, in the given order and without repeats, so "Hip Hop" and "hiphop"
+// both become hip-hop. Names no genre answers to are rejected.
+func (h *GigHandler) gigGenres(ctx context.Context, names []string) (models.StringArray, error) {
+    keys := make([]string, len(names))
+    for i, name := range names {
+        keys[i] = models.GenreKey(name)
+    }
+    slugs, err := h.genreRepo.Resolve(ctx, keys)
+    if err != nil {
+        return nil, err
+    }
+
+    genres := make(models.StringArray, 0, len(names))
+    tagged := make(map[string]bool, len(names))
+    for i, key := range keys {
+        slug, ok := slugs[key]
+        if !ok {
+            return nil, apperr.InvalidField(fmt.Sprintf("genres[%d]", i), fmt.Sprintf("Unknown genre %q; GET /api/genres lists them", names[i]))
+        }
+        if !tagged[slug] {
+            tagged[slug] = true
+            genres = append(genres, slug)
+        }
+    }
+    return genres, nil
+}
+
+// gigLineup resolves a lineup as sent into the gig's bill, in the given
+// order, with set times read in timezone. Errors name the offending entry,
+// such as lineup[2].artist_id.
+func (h *GigHandler) gigLineup(ctx context.Context, inputs []models.LineupSlotInput, timezone string) ([]models.LineupSlot, error) {
+    loc, err := models.LoadTimezone(timezone)
+    if err != nil {
+        return nil, apperr.InvalidField("timezone", "Unknown timezone")
+    }
+
+    lineup := make([]models.LineupSlot, 0, len(inputs))
+    billed := make(map[string]bool, len(inputs))
+    for i, input := range inputs {
+        field := fmt.Sprintf("lineup[%d]", i)
+        if billed[input.ArtistID] {
+            return nil, apperr.InvalidField(field+".artist_id", "Artist is already on the lineup")
+        }
+        billed[input.ArtistID] = true
+
+        artist, err := h.artistRepo.GetByID(ctx, input.ArtistID)
+        if errors.Is(err, apperr.ErrNotFound) {
+            return nil, apperr.InvalidField(field+".artist_id", "Artist does not exist")
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        slot := models.LineupSlot{ArtistID: artist.ID, ArtistName: artist.Name, Position: i + 1}
+        if input.SetStartsAt != nil && *input.SetStartsAt != "" {
+            t, err := models.ParseLocalTime(*input.SetStartsAt, loc)
+            if err != nil {
+                return nil, apperr.InvalidField(field+".set_starts_at", "Set start must be a date and time such as 2024-06-01T21:00")
+            }
+            slot.SetStartsAt = &t
+        }
+        if input.SetEndsAt != nil && *input.SetEndsAt != "" {
+            t, err := models.ParseLocalTime(*input.SetEndsAt, loc)
+            if err != nil {
+                return nil, apperr.InvalidField(field+".set_ends_at", "Set end must be a date and time such as 2024-06-01T22:00")
+            }
+            if slot.SetStartsAt != nil && !t.After(*slot.SetStartsAt) {
+                return nil, apperr.InvalidField(field+".set_ends_at", "Set end must be after its start")
+            }
+            slot.SetEndsAt = &t
+        }
+        lineup = append(lineup, slot)
+    }
+    return lineup, nil
+}
+
+// gigSchedule resolves a wall-clock start and optional end in timezone.
+// The end must come after the start; an overnight show simply ends on the
+// following date.
+func gigSchedule(startsAtInput string, endsAtInput *string, timezone string) (time.Time, *time.Time, error) {
+    loc, err := models.LoadTimezone(timezone)
+    if err != nil {
+        return time.Time{}, nil, apperr.InvalidField("timezone", "Unknown timezone")
+    }
+
+    startsAt, err := models.ParseLocalTime(startsAtInput, loc)
+    if err != nil {
+        return time.Time{}, nil, apperr.InvalidField("starts_at", "Start must be a date and time such as 2024-06-01T20:00")
+    }
+    if endsAtInput == nil || *endsAtInput == "" {
+        return startsAt, nil, nil
+    }
+
+    endsAt, err := models.ParseLocalTime(*endsAtInput, loc)
+    if err != nil {
+        return time.Time{}, nil, apperr.InvalidField("ends_at", "End must be a date and time such as 2024-06-01T23:00")
+    }
+    if !endsAt.After(startsAt) {
+        return time.Time{}, nil, apperr.InvalidField("ends_at", "End must be after the start")
+    }
+    return startsAt, &endsAt, nil
+}
+
 func (h *GigHandler) GetAllGigs(c *gin.Context) {
-    gigs, err := h.gigRepo.GetAll()
+    var filter models.GigFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    filter.ViewerID = viewerID(c)
+
+    page, err := h.gigRepo.List(c.Request.Context(), filter)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, page)
+}
+
+func (h *GigHandler) GetNearbyGigs(c *gin.Context) {
+    var filter models.NearbyGigFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    filter.ViewerID = viewerID(c)
+
+    gigs, err := h.gigRepo.Nearby(c.Request.Context(), filter)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gigs"})
+        c.Error(err)
         return
     }
 
     c.JSON(http.StatusOK, gigs)
 }
 
+// GetMapGigs returns the gigs in a map viewport as a GeoJSON
+// FeatureCollection, grouping nearby gigs into clusters when zoomed out.
+// Past repository.MaxViewportGigs the latest are kept and the collection is
+// marked truncated, so the client can ask the user to zoom in.
+func (h *GigHandler) GetMapGigs(c *gin.Context) {
+    var filter models.MapGigFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    filter.ViewerID = viewerID(c)
+
+    gigs, truncated, err := h.gigRepo.InViewport(c.Request.Context(), filter)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    points := make([]geo.Point, len(gigs))
+    for i, gig := range gigs {
+        points[i] = geo.Point{Lat: gig.Latitude, Lng: gig.Longitude}
+    }
+
+    clusters := geo.ClusterPoints(points, *filter.Zoom)
+    features := make([]geo.Feature, 0, len(clusters))
+    for i, cluster := range clusters {
+        if cluster.Count() == 1 {
+            features = append(features, gigFeature(gigs[cluster.Members[0]]))
+            continue
+        }
+        features = append(features, geo.Feature{
+            Type:     geo.TypeFeature,
+            ID:       fmt.Sprintf("cluster-%d", i),
+            BBox:     cluster.Box.GeoJSON(),
+            Geometry: geo.PointGeometry(cluster.Lat, cluster.Lng),
+            Properties: map[string]interface{}{
+                "cluster":     true,
+                "point_count": cluster.Count(),
+            },
+        })
+    }
+
+    fc := geo.NewFeatureCollection(features)
+    fc.Truncated = truncated
+    c.JSON(http.StatusOK, fc)
+}
+
+func gigFeature(gig models.Gig) geo.Feature {
+    start := gig.StartsAt.In(gig.Location())
+    return geo.Feature{
+        Type:     geo.TypeFeature,
+        ID:       gig.ID,
+        Geometry: geo.PointGeometry(gig.Latitude, gig.Longitude),
+        Properties: map[string]interface{}{
+            "cluster":    false,
+            "id":         gig.ID,
+            "title":      gig.Title,
+            "venue_name": gig.VenueName,
+            "starts_at":  start.Format(time.RFC3339),
+            "timezone":   gig.Timezone,
+            "date":       start.Format(models.LocalDateLayout),
+            "start_time": start.Format(models.LocalTimeLayout),
+            "status":     gig.Status,
+            "price":      gig.Price,
+            "image_url":  gig.ImageURL,
+            "genres":     gig.Genres,
+        },
+    }
+}
+
 func (h *GigHandler) GetGigByID(c *gin.Context) {
     id := c.Param("id")
 
-    gig, err := h.gigRepo.GetByID(id)
+    gig, err := h.gigRepo.GetByID(c.Request.Context(), id)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gig"})
+        c.Error(err)
         return
     }
-    if gig == nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Gig not found"})
+    // Someone else's draft does not exist as far as the caller can tell.
+    if !gig.Status.IsPublic() && gig.OrganizerID != viewerID(c) {
+        c.Error(apperr.NotFound("gig"))
         return
     }
 
+    etag := gigETag(gig)
+    c.Header("ETag", etag)
+    if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && etagListMatches(ifNoneMatch, etag, true) {
+        c.Status(http.StatusNotModified)
+        return
+    }
     c.JSON(http.StatusOK, gig)
 }
 
 func (h *GigHandler) GetGigsByOrganizer(c *gin.Context) {
     organizerID := c.Param("organizerId")
 
-    gigs, err := h.gigRepo.GetByOrganizerID(organizerID)
+    gigs, err := h.gigRepo.GetByOrganizerID(c.Request.Context(), organizerID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gigs"})
+        c.Error(err)
         return
     }
 
+    if organizerID != viewerID(c) {
+        visible := gigs[:0]
+        for _, gig := range gigs {
+            if gig.Status.IsPublic() {
+                visible = append(visible, gig)
+            }
+        }
+        gigs = visible
+    }
+
     c.JSON(http.StatusOK, gigs)
 }
 
+// UpdateGig replaces the gig's editable fields. Like PATCH and DELETE it
+// requires If-Match with the gig's current ETag.
 func (h *GigHandler) UpdateGig(c *gin.Context) {
-    id := c.Param("id")
-    userID, _ := c.Get("user_id")
+    existingGig, ok := h.editableGig(c)
+    if !ok || !checkIfMatch(c, existingGig) {
+        return
+    }
+
+    var input models.GigInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    if err := h.applyGigInput(c.Request.Context(), existingGig, input); err != nil {
+        c.Error(err)
+        return
+    }
+
+    if err := h.gigRepo.Update(c.Request.Context(), existingGig, viewerID(c)); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.Header("ETag", gigETag(existingGig))
+    c.JSON(http.StatusOK, existingGig)
+}
+
+// PatchGig applies an RFC 7396 merge patch to the gig's editable fields. An
+// absent member is left alone and null clears the field; the merged result
+// is validated as a whole, exactly like a PUT body, before it is saved.
+func (h *GigHandler) PatchGig(c *gin.Context) {
+    existingGig, ok := h.editableGig(c)
+    if !ok || !checkIfMatch(c, existingGig) {
+        return
+    }
 
-    // Get existing gig
-    existingGig, err := h.gigRepo.GetByID(id)
+    if ct := c.ContentType(); ct != mergepatch.ContentType && ct != "application/json" {
+        c.Error(apperr.UnsupportedMediaType("PATCH bodies must be " + mergepatch.ContentType))
+        return
+    }
+    body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchSize))
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gig"})
+        c.Error(apperr.TooLarge("Patch is too large"))
         return
     }
-    if existingGig == nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Gig not found"})
+    patch, err := mergepatch.Decode(body)
+    if err != nil {
+        c.Error(apperr.Validation("Patch must be a JSON object"))
         return
     }
 
-    // Check if user is the organizer
-    if existingGig.OrganizerID != userID.(string) {
-        c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own gigs"})
+    before, err := mergepatch.FromValue(existingGig.Input())
+    if err != nil {
+        c.Error(err)
         return
     }
+    for field := range patch {
+        if _, ok := before[field]; !ok {
+            c.Error(apperr.InvalidField(field, "Unknown or read-only field"))
+            return
+        }
+    }
 
-    var input models.CreateGigInput
+    var input models.GigInput
+    if err := mergepatch.Apply(before, patch).Into(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+    if err := binding.Validator.ValidateStruct(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    after, err := mergepatch.FromValue(input)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    changes := mergepatch.Diff(before, after)
+
+    if len(changes) > 0 {
+        if err := h.applyGigInput(c.Request.Context(), existingGig, input); err != nil {
+            c.Error(err)
+            return
+        }
+        if err := h.gigRepo.Update(c.Request.Context(), existingGig, viewerID(c)); err != nil {
+            c.Error(err)
+            return
+        }
+    }
+
+    c.Header("ETag", gigETag(existingGig))
+    c.JSON(http.StatusOK, models.GigPatchResponse{Gig: existingGig, Changes: changes})
+}
+
+// editableGig is ownGig for edits, which a cancelled gig no longer accepts.
+func (h *GigHandler) editableGig(c *gin.Context) (*models.Gig, bool) {
+    gig, ok := h.ownGig(c, "update")
+    if !ok {
+        return nil, false
+    }
+    if gig.Status == models.GigStatusCancelled {
+        c.Error(apperr.Conflict("status", "A cancelled gig can no longer be edited"))
+        return nil, false
+    }
+    return gig, true
+}
+
+// applyGigInput copies the editable fields onto gig, loading the venue when
+// it changes, canonical genres and the lineup's artists.
+func (h *GigHandler) applyGigInput(ctx context.Context, gig *models.Gig, input models.GigInput) error {
+    startsAt, endsAt, err := gigSchedule(input.StartsAt, input.EndsAt, input.Timezone)
+    if err != nil {
+        return err
+    }
+    genres, err := h.gigGenres(ctx, input.Genres)
+    if err != nil {
+        return err
+    }
+    lineup, err := h.gigLineup(ctx, input.Lineup, input.Timezone)
+    if err != nil {
+        return err
+    }
+    if input.VenueID != gig.VenueID {
+        venue, err := h.gigVenue(ctx, input.VenueID)
+        if err != nil {
+            return err
+        }
+        gig.SetVenue(venue)
+    }
+
+    gig.Title = input.Title
+    gig.Description = input.Description
+    gig.StartsAt = startsAt
+    gig.EndsAt = endsAt
+    gig.Timezone = input.Timezone
+    gig.Price = input.Price
+    gig.Genres = genres
+    gig.Lineup = lineup
+    return nil
+}
+
+// DeleteGig removes a draft. Once a gig has been public it stays, so fans
+// can still see that it was cancelled; use CancelGig instead.
+func (h *GigHandler) DeleteGig(c *gin.Context) {
+    existingGig, ok := h.ownGig(c, "delete")
+    if !ok || !checkIfMatch(c, existingGig) {
+        return
+    }
+    if existingGig.Status != models.GigStatusDraft {
+        c.Error(apperr.Conflict("status", "Only drafts can be deleted; cancel the gig instead"))
+        return
+    }
+
+    if err := h.gigRepo.Delete(c.Request.Context(), existingGig.ID, existingGig.Version); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Gig deleted successfully"})
+}
+
+// UploadGigImage stores the multipart "image" field as the gig's image,
+// together with its thumbnails, and points image_url and image_thumbnails at
+// them. Earlier images are kept since revisions still refer to them. Like
+// PUT it requires If-Match.
+func (h *GigHandler) UploadGigImage(c *gin.Context) {
+    gig, ok := h.editableGig(c)
+    if !ok || !checkIfMatch(c, gig) {
+        return
+    }
+
+    data, img, format, ok := readImageUpload(c, maxGigImageSize)
+    if !ok {
+        return
+    }
+
+    name, err := randomName(8)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    prefix := "gigs/" + gig.ID + "/" + name + "/"
+
+    var stored []string
+    put := func(key string, data []byte, format imaging.Format) (string, error) {
+        url, err := h.blobs.Put(c.Request.Context(), key, data, format.ContentType())
+        if err == nil {
+            stored = append(stored, key)
+        }
+        return url, err
+    }
+    // Best effort: an upload that is not saved on the gig should not linger.
+    cleanup := func() {
+        ctx := context.WithoutCancel(c.Request.Context())
+        for _, key := range stored {
+            _ = h.blobs.Delete(ctx, key)
+        }
+    }
+
+    imageURL, err := put(prefix+"original"+format.Ext(), data, format)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    thumbnails := models.ImageVariants{}
+    for _, size := range gigThumbnails {
+        encoded, encodedFormat, err := imaging.Encode(imaging.Resize(img, size.width), format)
+        if err == nil {
+            thumbnails[size.name], err = put(prefix+size.name+encodedFormat.Ext(), encoded, encodedFormat)
+        }
+        if err != nil {
+            cleanup()
+            c.Error(err)
+            return
+        }
+    }
+
+    gig.ImageURL = &imageURL
+    gig.ImageThumbnails = thumbnails
+    if err := h.gigRepo.Update(c.Request.Context(), gig, viewerID(c)); err != nil {
+        cleanup()
+        c.Error(err)
+        return
+    }
+
+    c.Header("ETag", gigETag(gig))
+    c.JSON(http.StatusOK, gig)
+}
+
+// PublishGig makes a draft visible to everyone.
+func (h *GigHandler) PublishGig(c *gin.Context) {
+    gig, ok := h.ownGig(c, "publish")
+    if !ok {
+        return
+    }
+
+    h.transition(c, gig, models.GigStatusPublished, nil)
+}
+
+// CancelGig marks a gig as cancelled. The gig stays listed with its status
+// and reason so fans learn what happened.
+func (h *GigHandler) CancelGig(c *gin.Context) {
+    var input models.CancelGigInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    gig, ok := h.ownGig(c, "cancel")
+    if !ok {
         return
     }
 
-    // Update gig fields
-    existingGig.Title = input.Title
-    existingGig.Description = input.Description
-    existingGig.VenueName = input.VenueName
-    existingGig.VenueAddress = input.VenueAddress
-    existingGig.Latitude = input.Latitude
-    existingGig.Longitude = input.Longitude
-    existingGig.Date = input.Date
-    existingGig.StartTime = input.StartTime
-    existingGig.EndTime = input.EndTime
-    existingGig.Price = input.Price
-    existingGig.Genres = input.Genres
+    h.transition(c, gig, models.GigStatusCancelled, &input.Reason)
+}
 
-    if err := h.gigRepo.Update(existingGig); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update gig"})
+// PostponeGig marks a gig as postponed until a new date is known.
+func (h *GigHandler) PostponeGig(c *gin.Context) {
+    var input models.PostponeGigInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
         return
     }
 
-    c.JSON(http.StatusOK, existingGig)
+    gig, ok := h.ownGig(c, "postpone")
+    if !ok {
+        return
+    }
+
+    h.transition(c, gig, models.GigStatusPostponed, input.Reason)
 }
 
-func (h *GigHandler) DeleteGig(c *gin.Context) {
-    id := c.Param("id")
-    userID, _ := c.Get("user_id")
+// RescheduleGig moves a gig to new times, remembering the old start.
+func (h *GigHandler) RescheduleGig(c *gin.Context) {
+    var input models.RescheduleGigInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    gig, ok := h.ownGig(c, "reschedule")
+    if !ok {
+        return
+    }
 
-    // Get existing gig
-    existingGig, err := h.gigRepo.GetByID(id)
+    timezone := input.Timezone
+    if timezone == "" {
+        timezone = gig.Timezone
+    }
+    startsAt, endsAt, err := gigSchedule(input.StartsAt, input.EndsAt, timezone)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve gig"})
+        c.Error(err)
         return
     }
-    if existingGig == nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Gig not found"})
+
+    previous := gig.StartsAt
+    gig.RescheduledFrom = &previous
+    gig.StartsAt = startsAt
+    gig.EndsAt = endsAt
+    gig.Timezone = timezone
+
+    h.transition(c, gig, models.GigStatusRescheduled, input.Reason)
+}
+
+// transition moves gig to status next if its current status allows it and
+// responds with the updated gig. If-Match is optional here, since the
+// status itself guards the change, but is honoured when sent.
+func (h *GigHandler) transition(c *gin.Context, gig *models.Gig, next models.GigStatus, reason *string) {
+    if c.GetHeader("If-Match") != "" && !checkIfMatch(c, gig) {
         return
     }
 
-    // Check if user is the organizer
-    if existingGig.OrganizerID != userID.(string) {
-        c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own gigs"})
+    from := gig.Status
+    if !from.CanTransitionTo(next) {
+        c.Error(apperr.Conflict("status", fmt.Sprintf("A %s gig cannot become %s", from, next)).
+            WithCode(codeInvalidTransition))
         return
     }
 
-    if err := h.gigRepo.Delete(id); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete gig"})
+    gig.Status = next
+    gig.StatusReason = reason
+    if err := h.gigRepo.Transition(c.Request.Context(), gig, from, viewerID(c)); err != nil {
+        c.Error(err)
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"message": "Gig deleted successfully"})
-}
\ No newline at end of file
+    c.Header("ETag", gigETag(gig))
+    c.JSON(http.StatusOK, gig)
+}
+
+// GetGigRevisions lists every recorded change to the gig, newest first,
+// with who made it and which fields it changed.
+func (h *GigHandler) GetGigRevisions(c *gin.Context) {
+    gig, ok := h.ownGig(c, "view the history of")
+    if !ok {
+        return
+    }
+
+    revisions, err := h.gigRepo.Revisions(c.Request.Context(), gig.ID)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, revisions)
+}
+
+// GetGigRevision returns one revision with its full snapshot.
+func (h *GigHandler) GetGigRevision(c *gin.Context) {
+    gig, ok := h.ownGig(c, "view the history of")
+    if !ok {
+        return
+    }
+    version, ok := revisionVersion(c)
+    if !ok {
+        return
+    }
+
+    revision, err := h.gigRepo.Revision(c.Request.Context(), gig.ID, version)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, revision)
+}
+
+// DiffGigRevisions compares the snapshots of two revisions. from may be
+// newer than to, in which case the changes read backwards.
+func (h *GigHandler) DiffGigRevisions(c *gin.Context) {
+    gig, ok := h.ownGig(c, "view the history of")
+    if !ok {
+        return
+    }
+
+    var query models.GigDiffQuery
+    if err := c.ShouldBindQuery(&query); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    from, err := h.gigRepo.Revision(c.Request.Context(), gig.ID, query.From)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    to, err := h.gigRepo.Revision(c.Request.Context(), gig.ID, query.To)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, models.GigDiff{
+        From:    from.Version,
+        To:      to.Version,
+        Changes: mergepatch.Diff(mergepatch.Document(from.Snapshot), mergepatch.Document(to.Snapshot)),
+    })
+}
+
+// RestoreGigRevision copies a revision's editable fields back onto the gig
+// as a new revision. The status is left alone: it only changes through the
+// lifecycle endpoints. Like PUT it requires If-Match.
+func (h *GigHandler) RestoreGigRevision(c *gin.Context) {
+    existingGig, ok := h.editableGig(c)
+    if !ok || !checkIfMatch(c, existingGig) {
+        return
+    }
+    version, ok := revisionVersion(c)
+    if !ok {
+        return
+    }
+
+    revision, err := h.gigRepo.Revision(c.Request.Context(), existingGig.ID, version)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    // Snapshots written before a field existed lack it, so decode leniently
+    // and let validation catch anything the current rules reject.
+    var snapshot models.GigSnapshot
+    data, err := json.Marshal(revision.Snapshot)
+    if err == nil {
+        err = json.Unmarshal(data, &snapshot)
+    }
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    if err := binding.Validator.ValidateStruct(&snapshot.GigInput); err != nil {
+        c.Error(apperr.Validation(fmt.Sprintf("Revision %d no longer passes validation", version)).Wrap(err))
+        return
+    }
+
+    before, err := mergepatch.FromValue(existingGig.Input())
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    if err := h.applyGigInput(c.Request.Context(), existingGig, snapshot.GigInput); err != nil {
+        c.Error(err)
+        return
+    }
+    after, err := mergepatch.FromValue(existingGig.Input())
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    changes := mergepatch.Diff(before, after)
+
+    // As with PATCH, restoring what is already there records nothing.
+    if len(changes) > 0 {
+        if err := h.gigRepo.Restore(c.Request.Context(), existingGig, version, viewerID(c)); err != nil {
+            c.Error(err)
+            return
+        }
+    }
+
+    c.Header("ETag", gigETag(existingGig))
+    c.JSON(http.StatusOK, models.GigPatchResponse{Gig: existingGig, Changes: changes})
+}
+
+// revisionVersion parses the :version path parameter. On failure it has
+// already recorded the error on c.
+func revisionVersion(c *gin.Context) (int, bool) {
+    version, err := strconv.Atoi(c.Param("version"))
+    if err != nil || version < 1 {
+        c.Error(apperr.InvalidField("version", "Version must be a positive integer"))
+        return 0, false
+    }
+    return version, true
+}
+
+// ownGig loads the gig in the path and checks that the caller organizes it.
+// Another organizer's draft is reported as missing rather than forbidden.
+// On failure it has already recorded the error on c.
+func (h *GigHandler) ownGig(c *gin.Context, action string) (*models.Gig, bool) {
+    gig, err := h.gigRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return nil, false
+    }
+
+    if gig.OrganizerID != viewerID(c) {
+        if !gig.Status.IsPublic() {
+            c.Error(apperr.NotFound("gig"))
+        } else {
+            c.Error(apperr.Forbidden("You can only " + action + " your own gigs"))
+        }
+        return nil, false
+    }
+
+    return gig, true
+}
+
+// gigETag is the strong entity tag of the gig's current version.
+func gigETag(gig *models.Gig) string {
+    return `"` + strconv.Itoa(gig.Version) + `"`
+}
+
+// checkIfMatch requires an If-Match header that names the gig's current
+// ETag, or "*". The repository repeats the comparison atomically, so this
+// only saves work when the client is already stale. On failure it has
+// already recorded the error on c.
+func checkIfMatch(c *gin.Context, gig *models.Gig) bool {
+    ifMatch := c.GetHeader("If-Match")
+    if ifMatch == "" {
+        c.Error(apperr.PreconditionRequired("If-Match with the gig's ETag is required"))
+        return false
+    }
+    if !etagListMatches(ifMatch, gigETag(gig), false) {
+        c.Header("ETag", gigETag(gig))
+        c.Error(repository.ErrStaleGig)
+        return false
+    }
+    return true
+}
+
+// etagListMatches reports whether a comma-separated If-Match or
+// If-None-Match value contains etag or "*". If-Match compares strongly, so
+// weak tags never match it; If-None-Match compares weakly.
+func etagListMatches(header, etag string, weak bool) bool {
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimSpace(candidate)
+        if weak {
+            candidate = strings.TrimPrefix(candidate, "W/")
+        }
+        if candidate == "*" || candidate == etag {
+            return true
+        }
+    }
+    return false
+}
+
+// viewerID returns the authenticated caller's id, or "" for anonymous
+// requests.
+func viewerID(c *gin.Context) string {
+    return c.GetString("user_id")
+}
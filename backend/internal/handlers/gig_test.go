@@ -0,0 +1,725 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/geo"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+	"sunyi-api/internal/storage"
+)
+
+func TestCreateGigRequiresOrganizer(t *testing.T) {
+	api := newTestAPI(t)
+	fanToken, _ := api.register("fan", models.RoleUser)
+
+	expectStatus(t, api.do(http.MethodPost, "/api/gigs", gigInput("Show", "2030-01-01"), ""), http.StatusUnauthorized)
+	expectStatus(t, api.do(http.MethodPost, "/api/gigs", gigInput("Show", "2030-01-01"), fanToken), http.StatusForbidden)
+}
+
+func TestCreateAndGetGig(t *testing.T) {
+	api := newTestAPI(t)
+	token, organizer := api.register("organizer", models.RoleOrganizer)
+
+	input := gigInput("Show", "2030-01-01")
+	input.Genres = []string{"rock"}
+	gig := api.createGig(token, input)
+	if gig.ID == "" || gig.OrganizerID != organizer.ID {
+		t.Fatalf("created gig = %+v", gig)
+	}
+
+	rec := api.do(http.MethodGet, "/api/gigs/"+gig.ID, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var got models.Gig
+	decode(t, rec, &got)
+	if got.Title != "Show" || got.Organizer == nil || got.Organizer.Username != "organizer" {
+		t.Fatalf("got gig = %+v", got)
+	}
+	if strings.Contains(rec.Body.String(), "organizer@example.com") {
+		t.Fatalf("gig response leaks organizer email: %s", rec.Body.String())
+	}
+
+	rec = api.do(http.MethodGet, "/api/gigs/does-not-exist", nil, "")
+	expectStatus(t, rec, http.StatusNotFound)
+	expectError(t, rec, apperr.CodeNotFound, "")
+}
+
+func TestListGigsPaginatesAndFilters(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	for day := 1; day <= 5; day++ {
+		input := gigInput(fmt.Sprintf("Show %d", day), fmt.Sprintf("2030-01-%02d", day))
+		if day%2 == 0 {
+			input.Genres = []string{"jazz"}
+		}
+		api.createGig(token, input)
+	}
+
+	var titles []string
+	path := "/api/gigs?limit=2"
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		rec := api.do(http.MethodGet, path, nil, "")
+		expectStatus(t, rec, http.StatusOK)
+		var resp models.GigListResponse
+		decode(t, rec, &resp)
+		if resp.Total != 5 {
+			t.Fatalf("total = %d, want 5", resp.Total)
+		}
+		for _, gig := range resp.Data {
+			titles = append(titles, gig.Title)
+		}
+		if resp.NextCursor == nil {
+			break
+		}
+		path = "/api/gigs?limit=2&cursor=" + *resp.NextCursor
+	}
+	want := "Show 5,Show 4,Show 3,Show 2,Show 1"
+	if got := strings.Join(titles, ","); got != want {
+		t.Fatalf("titles = %s, want %s", got, want)
+	}
+
+	rec := api.do(http.MethodGet, "/api/gigs?genre=jazz&date_from=2030-01-03", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var resp models.GigListResponse
+	decode(t, rec, &resp)
+	if resp.Total != 1 || resp.Data[0].Title != "Show 4" {
+		t.Fatalf("filtered = %+v", resp)
+	}
+
+	rec = api.do(http.MethodGet, "/api/gigs?cursor=garbage", nil, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "cursor")
+	expectStatus(t, api.do(http.MethodGet, "/api/gigs?date_from=tomorrow", nil, ""), http.StatusBadRequest)
+	rec = api.do(http.MethodGet, "/api/gigs?organizer_id=not-a-uuid", nil, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "organizer_id")
+}
+
+func TestNearbyGigs(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+
+	near := gigInput("Near", "2030-01-01")
+	near.Venue.Latitude, near.Venue.Longitude = -6.2, 106.8
+	far := gigInput("Far", "2030-01-02")
+	far.Venue.Latitude, far.Venue.Longitude = -6.9, 107.6
+	api.createGig(token, near)
+	api.createGig(token, far)
+
+	rec := api.do(http.MethodGet, "/api/gigs/nearby?lat=-6.21&lng=106.81&radius_km=5", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var gigs []models.Gig
+	decode(t, rec, &gigs)
+	if len(gigs) != 1 || gigs[0].Title != "Near" || gigs[0].DistanceKm == nil {
+		t.Fatalf("nearby = %+v", gigs)
+	}
+
+	rec = api.do(http.MethodGet, "/api/gigs/nearby?lat=-6.21&lng=106.81&radius_km=200", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &gigs)
+	if len(gigs) != 2 || gigs[0].Title != "Near" || *gigs[0].DistanceKm > *gigs[1].DistanceKm {
+		t.Fatalf("nearby by distance = %+v", gigs)
+	}
+
+	expectStatus(t, api.do(http.MethodGet, "/api/gigs/nearby?lng=106.81", nil, ""), http.StatusBadRequest)
+}
+
+func TestMapGigsClusters(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	for i := 0; i < 3; i++ {
+		input := gigInput(fmt.Sprintf("Show %d", i), "2030-01-01")
+		// Far enough apart not to be matched to the same venue.
+		input.Venue.Latitude = -6.2 + float64(i)*0.005
+		api.createGig(token, input)
+	}
+
+	bounds := "min_lat=-7&min_lng=106&max_lat=-6&max_lng=107"
+	rec := api.do(http.MethodGet, "/api/gigs/map?"+bounds+"&zoom=5", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var fc geo.FeatureCollection
+	decode(t, rec, &fc)
+	if len(fc.Features) != 1 || fc.Features[0].Properties["point_count"] != float64(3) {
+		t.Fatalf("zoomed out = %+v", fc)
+	}
+
+	rec = api.do(http.MethodGet, "/api/gigs/map?"+bounds+"&zoom=18", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &fc)
+	if len(fc.Features) != 3 || fc.Features[0].Properties["cluster"] != false || fc.Truncated {
+		t.Fatalf("zoomed in = %+v", fc)
+	}
+}
+
+func TestMapGigsReportsTruncation(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+
+	// Fill the viewport past the cap straight through the store.
+	for i := 0; i < repository.MaxViewportGigs; i++ {
+		clone := gig
+		clone.Lineup = nil
+		if err := api.store.Gigs.Create(context.Background(), &clone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := api.do(http.MethodGet, "/api/gigs/map?min_lat=-7&min_lng=106&max_lat=-6&max_lng=107&zoom=5", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var fc geo.FeatureCollection
+	decode(t, rec, &fc)
+	if !fc.Truncated || len(fc.Features) != 1 || fc.Features[0].Properties["point_count"] != float64(repository.MaxViewportGigs) {
+		t.Fatalf("truncated = %v, features = %d", fc.Truncated, len(fc.Features))
+	}
+}
+
+func TestUpdateAndDeleteGig(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+
+	update := gigInput("Renamed", "2030-01-02").GigInput
+	update.VenueID = gig.VenueID
+	expectStatus(t, api.do(http.MethodPut, "/api/gigs/"+gig.ID, update, otherToken), http.StatusForbidden)
+
+	rec := api.do(http.MethodPut, "/api/gigs/"+gig.ID, update, token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Gig
+	decode(t, rec, &updated)
+	if updated.Title != "Renamed" || updated.StartsAt.Format("2006-01-02") != "2030-01-02" {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	expectStatus(t, api.do(http.MethodDelete, "/api/gigs/"+gig.ID, nil, otherToken), http.StatusForbidden)
+	// Published gigs are cancelled, not deleted.
+	expectStatus(t, api.do(http.MethodDelete, "/api/gigs/"+gig.ID, nil, token, ifMatch(updated)...), http.StatusConflict)
+
+	draftInput := gigInput("Draft", "2030-01-03")
+	draftInput.Status = models.GigStatusDraft
+	draft := api.createGig(token, draftInput)
+	expectStatus(t, api.do(http.MethodDelete, "/api/gigs/"+draft.ID, nil, token, ifMatch(draft)...), http.StatusOK)
+	expectStatus(t, api.do(http.MethodGet, "/api/gigs/"+draft.ID, nil, token), http.StatusNotFound)
+}
+
+func TestDraftsAreVisibleOnlyToTheirOrganizer(t *testing.T) {
+	api := newTestAPI(t)
+	token, organizer := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+
+	input := gigInput("Secret", "2030-01-01")
+	input.Status = ""
+	draft := api.createGig(token, input)
+	if draft.Status != models.GigStatusDraft {
+		t.Fatalf("status = %q, want draft", draft.Status)
+	}
+
+	for _, viewer := range []string{"", otherToken} {
+		expectStatus(t, api.do(http.MethodGet, "/api/gigs/"+draft.ID, nil, viewer), http.StatusNotFound)
+		rec := api.do(http.MethodGet, "/api/gigs", nil, viewer)
+		var page models.GigListResponse
+		decode(t, rec, &page)
+		if page.Total != 0 {
+			t.Fatalf("listing shows a draft to another viewer: %+v", page.Data)
+		}
+		rec = api.do(http.MethodGet, "/api/gigs/organizer/"+organizer.ID, nil, viewer)
+		var gigs []models.Gig
+		decode(t, rec, &gigs)
+		if len(gigs) != 0 {
+			t.Fatalf("organizer listing shows a draft to another viewer: %+v", gigs)
+		}
+	}
+	expectStatus(t, api.do(http.MethodPost, "/api/gigs/"+draft.ID+"/publish", nil, otherToken), http.StatusNotFound)
+
+	expectStatus(t, api.do(http.MethodGet, "/api/gigs/"+draft.ID, nil, token), http.StatusOK)
+	rec := api.do(http.MethodGet, "/api/gigs", nil, token)
+	var page models.GigListResponse
+	decode(t, rec, &page)
+	if page.Total != 1 {
+		t.Fatalf("organizer listing total = %d, want 1", page.Total)
+	}
+
+	rec = api.do(http.MethodPost, "/api/gigs/"+draft.ID+"/publish", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, api.do(http.MethodGet, "/api/gigs/"+draft.ID, nil, ""), http.StatusOK)
+}
+
+func TestGigLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+	path := "/api/gigs/" + gig.ID
+
+	// A published gig cannot be published again.
+	rec := api.do(http.MethodPost, path+"/publish", nil, token)
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, "invalid_status_transition", "status")
+
+	expectStatus(t, api.do(http.MethodPost, path+"/postpone", map[string]string{}, otherToken), http.StatusForbidden)
+	rec = api.do(http.MethodPost, path+"/postpone", map[string]string{"reason": "Singer is ill"}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = api.do(http.MethodPost, path+"/reschedule", models.RescheduleGigInput{StartsAt: "2030-02-01T21:00"}, token)
+	expectStatus(t, rec, http.StatusOK)
+	var moved map[string]interface{}
+	decode(t, rec, &moved)
+	if moved["status"] != "rescheduled" || moved["starts_at"] != "2030-02-01T21:00:00+07:00" ||
+		moved["rescheduled_from"] != "2030-01-01T20:00:00+07:00" || moved["status_reason"] != nil {
+		t.Fatalf("rescheduled gig = %v", moved)
+	}
+
+	expectStatus(t, api.do(http.MethodPost, path+"/cancel", map[string]string{}, token), http.StatusBadRequest)
+	rec = api.do(http.MethodPost, path+"/cancel", models.CancelGigInput{Reason: "Venue closed"}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	// Cancelled gigs stay listed, with the reason, and are final.
+	rec = api.do(http.MethodGet, "/api/gigs", nil, "")
+	var page models.GigListResponse
+	decode(t, rec, &page)
+	if len(page.Data) != 1 || page.Data[0].Status != models.GigStatusCancelled ||
+		page.Data[0].StatusReason == nil || *page.Data[0].StatusReason != "Venue closed" ||
+		page.Data[0].StatusChangedAt == nil {
+		t.Fatalf("listing = %+v", page.Data)
+	}
+	rec = api.do(http.MethodGet, "/api/gigs?status=published", nil, "")
+	decode(t, rec, &page)
+	if page.Total != 0 {
+		t.Fatalf("status filter returned %+v", page.Data)
+	}
+
+	expectStatus(t, api.do(http.MethodPost, path+"/reschedule", models.RescheduleGigInput{StartsAt: "2030-03-01T21:00"}, token), http.StatusConflict)
+	anyVersion := []string{"If-Match", "*"}
+	expectStatus(t, api.do(http.MethodPut, path, gigInput("Renamed", "2030-01-01"), token, anyVersion...), http.StatusConflict)
+	expectStatus(t, api.do(http.MethodDelete, path, nil, token, anyVersion...), http.StatusConflict)
+}
+
+func TestGigTimes(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+
+	input := gigInput("Late show", "2030-01-01")
+	input.StartsAt = "2030-01-01T22:00"
+	endsAt := "2030-01-02T02:00"
+	input.EndsAt = &endsAt
+	rec := api.do(http.MethodPost, "/api/gigs", input, token)
+	expectStatus(t, rec, http.StatusCreated)
+	var body map[string]interface{}
+	decode(t, rec, &body)
+	want := map[string]interface{}{
+		"starts_at":     "2030-01-01T22:00:00+07:00",
+		"starts_at_utc": "2030-01-01T15:00:00Z",
+		"ends_at":       "2030-01-02T02:00:00+07:00",
+		"ends_at_utc":   "2030-01-01T19:00:00Z",
+		"timezone":      "Asia/Jakarta",
+		"date":          "2030-01-01",
+		"start_time":    "22:00",
+		"end_time":      "02:00",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+
+	// The local date, not the UTC one, decides date filters.
+	early := gigInput("Early hours", "2030-01-05")
+	early.StartsAt = "2030-01-05T01:00"
+	api.createGig(token, early)
+	rec = api.do(http.MethodGet, "/api/gigs?date_from=2030-01-05&date_to=2030-01-05", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var page models.GigListResponse
+	decode(t, rec, &page)
+	if len(page.Data) != 1 || page.Data[0].Title != "Early hours" {
+		t.Fatalf("date filter returned %+v", page.Data)
+	}
+
+	backwards := gigInput("Backwards", "2030-01-01")
+	before := "2030-01-01T19:00"
+	backwards.EndsAt = &before
+	rec = api.do(http.MethodPost, "/api/gigs", backwards, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "ends_at")
+
+	badStart := gigInput("Bad start", "2030-01-01")
+	badStart.StartsAt = "8pm"
+	rec = api.do(http.MethodPost, "/api/gigs", badStart, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "starts_at")
+
+	badZone := gigInput("Bad zone", "2030-01-01")
+	badZone.Timezone = "Mars/Olympus_Mons"
+	expectStatus(t, api.do(http.MethodPost, "/api/gigs", badZone, token), http.StatusBadRequest)
+}
+
+func TestUpcomingIncludesGigsInProgress(t *testing.T) {
+	api := newTestAPI(t)
+	api.store.SetClock(func() time.Time {
+		return time.Date(2030, 1, 1, 17, 0, 0, 0, time.UTC) // 00:00 on Jan 2 in Jakarta
+	})
+	token, _ := api.register("organizer", models.RoleOrganizer)
+
+	running := gigInput("Running", "2030-01-01")
+	until := "2030-01-02T03:00"
+	running.EndsAt = &until
+	api.createGig(token, running)
+	api.createGig(token, gigInput("Finished", "2030-01-01"))
+
+	rec := api.do(http.MethodGet, "/api/gigs?upcoming=true", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var page models.GigListResponse
+	decode(t, rec, &page)
+	if len(page.Data) != 1 || page.Data[0].Title != "Running" {
+		t.Fatalf("upcoming = %+v", page.Data)
+	}
+}
+
+func TestPatchGig(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	input := gigInput("Show", "2030-01-01")
+	endsAt := "2030-01-01T23:00"
+	price := 50000.0
+	input.EndsAt = &endsAt
+	input.Price = &price
+	input.Genres = []string{"rock"}
+	gig := api.createGig(token, input)
+	path := "/api/gigs/" + gig.ID
+
+	expectStatus(t, api.patch(path, `{"title":"Other"}`, otherToken), http.StatusForbidden)
+
+	// Absent fields are kept; null clears a field.
+	rec := api.patch(path, `{"title":"Renamed","price":null}`, token, "If-Match", "*")
+	expectStatus(t, rec, http.StatusOK)
+	var resp models.GigPatchResponse
+	decode(t, rec, &resp)
+	if resp.Gig.Title != "Renamed" || resp.Gig.Price != nil || resp.Gig.EndsAt == nil ||
+		len(resp.Gig.Genres) != 1 || resp.Gig.Description != "A night of music" {
+		t.Fatalf("patched gig = %+v", resp.Gig)
+	}
+	if len(resp.Changes) != 2 || resp.Changes[0].Field != "price" || resp.Changes[1].Field != "title" ||
+		resp.Changes[1].From != "Show" || resp.Changes[1].To != "Renamed" {
+		t.Fatalf("changes = %+v", resp.Changes)
+	}
+
+	// An end time that would now precede the start is caught on the merged gig.
+	rec = api.patch(path, `{"starts_at":"2030-01-02T00:30:00"}`, token, "If-Match", "*")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "ends_at")
+
+	rec = api.patch(path, `{"title":null}`, token, "If-Match", "*")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "title")
+
+	rec = api.patch(path, `{"status":"cancelled"}`, token, "If-Match", "*")
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "status")
+
+	expectStatus(t, api.patch(path, `[{"op":"replace"}]`, token, "If-Match", "*"), http.StatusBadRequest)
+	expectStatus(t, api.patch(path, `{"title":5}`, token, "If-Match", "*"), http.StatusBadRequest)
+
+	rec = api.patch(path, `{}`, token, "If-Match", "*")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &resp)
+	if len(resp.Changes) != 0 {
+		t.Fatalf("empty patch changes = %+v", resp.Changes)
+	}
+
+	rec = api.do(http.MethodPatch, path, map[string]string{"title": "Plain JSON"}, token, "If-Match", "*")
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestGigVersionPreconditions(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+	path := "/api/gigs/" + gig.ID
+
+	rec := api.do(http.MethodGet, path, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+	expectStatus(t, api.do(http.MethodGet, path, nil, "", "If-None-Match", etag), http.StatusNotModified)
+
+	// Writes without If-Match are refused outright.
+	rec = api.patch(path, `{"title":"A"}`, token)
+	expectStatus(t, rec, http.StatusPreconditionRequired)
+	expectError(t, rec, apperr.CodePreconditionRequired, "")
+	expectStatus(t, api.do(http.MethodPut, path, gigInput("A", "2030-01-01"), token), http.StatusPreconditionRequired)
+	expectStatus(t, api.do(http.MethodDelete, path, nil, token), http.StatusPreconditionRequired)
+
+	// Two tabs read version 1; the first write wins, the second is stale.
+	rec = api.patch(path, `{"title":"First tab"}`, token, "If-Match", etag)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("ETag after write = %q, want \"2\"", got)
+	}
+	rec = api.patch(path, `{"title":"Second tab"}`, token, "If-Match", etag)
+	expectStatus(t, rec, http.StatusPreconditionFailed)
+	expectError(t, rec, apperr.CodePrecondition, "")
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("ETag on 412 = %q, want the current one", got)
+	}
+	expectStatus(t, api.do(http.MethodPut, path, gigInput("Second tab", "2030-01-01"), token, "If-Match", etag), http.StatusPreconditionFailed)
+	expectStatus(t, api.do(http.MethodPut, path, gigInput("Weak", "2030-01-01"), token, "If-Match", `W/"2"`), http.StatusPreconditionFailed)
+
+	rec = api.do(http.MethodGet, path, nil, "")
+	var current models.Gig
+	decode(t, rec, &current)
+	if current.Title != "First tab" || current.Version != 2 {
+		t.Fatalf("current gig = %+v", current)
+	}
+
+	// Status changes bump the version too and honour If-Match when sent.
+	expectStatus(t, api.do(http.MethodPost, path+"/postpone", map[string]string{}, token, "If-Match", etag), http.StatusPreconditionFailed)
+	rec = api.do(http.MethodPost, path+"/postpone", map[string]string{}, token, ifMatch(current)...)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != `"3"` {
+		t.Fatalf("ETag after postpone = %q, want \"3\"", got)
+	}
+}
+
+func TestStaleWriteIsRejectedByTheStore(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+
+	// Simulate a write landing between the handler's read and its update.
+	stale, err := api.store.Gigs.GetByID(context.Background(), gig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, api.patch("/api/gigs/"+gig.ID, `{"title":"Other"}`, token, ifMatch(gig)...), http.StatusOK)
+	stale.Title = "Lost update"
+	if err := api.store.Gigs.Update(context.Background(), stale, stale.OrganizerID); !errors.Is(err, apperr.ErrPrecondition) {
+		t.Fatalf("stale Update error = %v, want ErrPrecondition", err)
+	}
+	if err := api.store.Gigs.Delete(context.Background(), gig.ID, stale.Version); !errors.Is(err, apperr.ErrPrecondition) {
+		t.Fatalf("stale Delete error = %v, want ErrPrecondition", err)
+	}
+}
+
+func TestGigRevisions(t *testing.T) {
+	api := newTestAPI(t)
+	token, organizer := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+	path := "/api/gigs/" + gig.ID
+
+	rec := api.patch(path, `{"starts_at":"2030-01-01T21:30"}`, token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusOK)
+	var patched models.GigPatchResponse
+	decode(t, rec, &patched)
+	rec = api.do(http.MethodPost, path+"/postpone", map[string]string{}, token)
+	expectStatus(t, rec, http.StatusOK)
+	var postponed models.Gig
+	decode(t, rec, &postponed)
+
+	rec = api.do(http.MethodGet, path+"/revisions", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var revisions []models.GigRevision
+	decode(t, rec, &revisions)
+	if len(revisions) != 3 || revisions[0].Version != 3 || revisions[0].Action != "postponed" ||
+		revisions[1].Action != models.RevisionUpdated || revisions[2].Action != models.RevisionCreated {
+		t.Fatalf("revisions = %+v", revisions)
+	}
+	edit := revisions[1]
+	if edit.Editor == nil || edit.Editor.ID != organizer.ID || len(edit.Changes) != 1 ||
+		edit.Changes[0].Field != "starts_at" || edit.Changes[0].From != "2030-01-01T20:00:00" ||
+		edit.Changes[0].To != "2030-01-01T21:30:00" {
+		t.Fatalf("edit revision = %+v", edit)
+	}
+
+	rec = api.do(http.MethodGet, path+"/revisions/diff?from=1&to=3", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var diff models.GigDiff
+	decode(t, rec, &diff)
+	if diff.From != 1 || diff.To != 3 || len(diff.Changes) != 2 ||
+		diff.Changes[0].Field != "starts_at" || diff.Changes[1].Field != "status" {
+		t.Fatalf("diff = %+v", diff)
+	}
+
+	expectStatus(t, api.do(http.MethodGet, path+"/revisions/diff?from=1", nil, token), http.StatusBadRequest)
+	expectStatus(t, api.do(http.MethodGet, path+"/revisions/diff?from=1&to=9", nil, token), http.StatusNotFound)
+	expectStatus(t, api.do(http.MethodGet, path+"/revisions", nil, otherToken), http.StatusForbidden)
+
+	// Restoring brings back the fields but not the status.
+	restore := path + "/revisions/1/restore"
+	expectStatus(t, api.do(http.MethodPost, restore, nil, token), http.StatusPreconditionRequired)
+	expectStatus(t, api.do(http.MethodPost, restore, nil, otherToken, ifMatch(postponed)...), http.StatusForbidden)
+	rec = api.do(http.MethodPost, restore, nil, token, ifMatch(postponed)...)
+	expectStatus(t, rec, http.StatusOK)
+	var restored models.GigPatchResponse
+	decode(t, rec, &restored)
+	if restored.Gig.Status != models.GigStatusPostponed || restored.Gig.Version != 4 ||
+		len(restored.Changes) != 1 || restored.Changes[0].To != "2030-01-01T20:00:00" {
+		t.Fatalf("restored = %+v", restored)
+	}
+
+	rec = api.do(http.MethodGet, path+"/revisions/4", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var revision models.GigRevision
+	decode(t, rec, &revision)
+	if revision.Action != models.RevisionRestored || revision.RestoredFrom == nil || *revision.RestoredFrom != 1 {
+		t.Fatalf("restore revision = %+v", revision)
+	}
+}
+
+func TestUploadGigImage(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+	path := "/api/gigs/" + gig.ID + "/image"
+	data := pngImage(t, 1200, 600)
+
+	expectStatus(t, api.upload(path, data, token), http.StatusPreconditionRequired)
+	expectStatus(t, api.upload(path, data, otherToken, "If-Match", "*"), http.StatusForbidden)
+
+	rec := api.upload(path, []byte("just some text, not an image"), token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusUnsupportedMediaType)
+	rec = api.upload(path, make([]byte, 11<<20), token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	rec = api.upload(path, data, token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Gig
+	decode(t, rec, &updated)
+	prefix := "/uploads/gigs/" + gig.ID + "/"
+	if updated.ImageURL == nil || !strings.HasPrefix(*updated.ImageURL, prefix) ||
+		!strings.HasSuffix(*updated.ImageURL, "/original.png") || updated.Version != gig.Version+1 {
+		t.Fatalf("gig after upload = %+v", updated)
+	}
+	if len(updated.ImageThumbnails) != 2 {
+		t.Fatalf("thumbnails = %v", updated.ImageThumbnails)
+	}
+
+	// The files are served, and thumbnails are scaled to their width.
+	rec = api.do(http.MethodGet, *updated.ImageURL, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	for name, width := range map[string]int{"small": 320, "medium": 960} {
+		rec = api.do(http.MethodGet, updated.ImageThumbnails[name], nil, "")
+		expectStatus(t, rec, http.StatusOK)
+		config, err := png.DecodeConfig(rec.Body)
+		if err != nil || config.Width != width || config.Height != width/2 {
+			t.Fatalf("%s thumbnail = %+v, %v", name, config, err)
+		}
+	}
+
+	rec = api.do(http.MethodGet, "/api/gigs/"+gig.ID+"/revisions", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var revisions []models.GigRevision
+	decode(t, rec, &revisions)
+	if len(revisions[0].Changes) != 1 || revisions[0].Changes[0].Field != "image_url" {
+		t.Fatalf("upload revision = %+v", revisions[0])
+	}
+}
+
+func TestUploadGigImageToS3(t *testing.T) {
+	bucket := newFakeS3(t)
+	blobs, err := storage.NewS3Store(config.S3Config{
+		Endpoint:        bucket.server.URL,
+		Region:          "us-east-1",
+		Bucket:          "sunyi",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		PathStyle:       true,
+		PublicURL:       "https://cdn.example.com",
+	}, bucket.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := newTestAPIWithBlobs(t, config.UploadConfig{Backend: "s3"}, blobs)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Show", "2030-01-01"))
+
+	rec := api.upload("/api/gigs/"+gig.ID+"/image", pngImage(t, 400, 400), token, ifMatch(gig)...)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.Gig
+	decode(t, rec, &updated)
+
+	key := strings.TrimPrefix(*updated.ImageURL, "https://cdn.example.com/")
+	if !strings.HasPrefix(key, "gigs/"+gig.ID+"/") {
+		t.Fatalf("image_url = %s", *updated.ImageURL)
+	}
+	object, ok := bucket.get("/sunyi/" + key)
+	if !ok || object.contentType != "image/png" || !bytes.Equal(object.data, pngImage(t, 400, 400)) {
+		t.Fatalf("stored object = %+v, %v", object.contentType, ok)
+	}
+	if len(bucket.objects) != 3 {
+		t.Fatalf("bucket has %d objects, want the image and 2 thumbnails", len(bucket.objects))
+	}
+}
+
+// fakeS3 is a stand-in for an S3-compatible store: it keeps objects by path
+// and rejects requests without a SigV4 header for the expected key or with a
+// payload hash that does not match the body.
+type fakeS3 struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{objects: map[string]fakeObject{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = fakeObject{data: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) get(path string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[path]
+	return object, ok
+}
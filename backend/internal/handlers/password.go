@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/mail"
+	"sunyi-api/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+    passwordResetTTL = time.Hour
+    // passwordResetInterval is how often one account may be mailed a reset
+    // link. Requests in between are answered the same but send nothing.
+    passwordResetInterval = time.Minute
+    // passwordResetTimeout bounds looking up the account and mailing it,
+    // which happen after the response is sent.
+    passwordResetTimeout = 30 * time.Second
+)
+
+// ForgotPassword mails a password reset link to the account with the given
+// email. The response is the same whether or not such an account exists, so
+// it cannot be used to find out who has signed up. The link is sent in the
+// background, so neither does the time the response takes.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+    var input models.ForgotPasswordInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), passwordResetTimeout)
+    h.background.Add(1)
+    go func() {
+        defer h.background.Done()
+        defer cancel()
+        if err := h.sendPasswordReset(ctx, input.Email); err != nil {
+            log.Printf("forgot password: %v", err)
+        }
+    }()
+
+    c.JSON(http.StatusOK, gin.H{"message": "If an account uses that email, a reset link is on its way"})
+}
+
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, email string) error {
+    user, err := h.userRepo.GetByEmail(ctx, email)
+    if errors.Is(err, apperr.ErrNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    token, hash, err := newSecretToken()
+    if err != nil {
+        return err
+    }
+    created, err := h.resetRepo.Create(ctx, user.ID, hash, passwordResetTTL, passwordResetInterval)
+    if err != nil || !created {
+        return err
+    }
+
+    link := h.appURL + "/reset-password?token=" + url.QueryEscape(token)
+    err = h.mailer.Send(ctx, mail.Message{
+        To:      user.Email,
+        Subject: "Reset your password",
+        Body: fmt.Sprintf(
+            "Hi %s,\n\nSomeone asked to reset the password for your account. To choose a new one, open the link below:\n\n%s\n\n"+
+                "The link works once and expires in %d minutes. If it was not you, ignore this email; your password has not changed.\n",
+            user.Username, link, int(passwordResetTTL.Minutes()),
+        ),
+    })
+    if err != nil {
+        return fmt.Errorf("sending reset link to user %s: %w", user.ID, err)
+    }
+    return nil
+}
+
+// ResetPassword sets a new password with the token from a reset link. It
+// signs the user out of every session, so whoever may have known the old
+// password loses access.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+    var input models.ResetPasswordInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    _, err = h.resetRepo.Reset(c.Request.Context(), hashSecretToken(input.Token), string(hashedPassword))
+    if errors.Is(err, apperr.ErrNotFound) {
+        c.Error(apperr.InvalidField("token", "Reset link is invalid or has expired").WithCode(apperr.CodeInvalidToken))
+        return
+    }
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// ChangePassword replaces the caller's password after checking the current
+// one, and signs out every other session.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+    var input models.ChangePasswordInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    ctx := c.Request.Context()
+    userID := c.GetString("user_id")
+    user, err := h.userRepo.GetByID(ctx, userID)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.CurrentPassword)); err != nil {
+        c.Error(apperr.InvalidField("current_password", "Current password is incorrect"))
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    if err := h.userRepo.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
+        c.Error(err)
+        return
+    }
+    if _, err := h.sessionRepo.RevokeAll(ctx, userID, c.GetString("session_id")); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUserAgentLength bounds the user agent recorded with a session.
+const maxUserAgentLength = 500
+
+// newSecretToken returns a random token, such as a refresh or password
+// reset token, and the hash it is stored under. The token has 256 bits of
+// entropy, so an unsalted SHA-256 is enough to keep a copy of the table
+// from being usable.
+func newSecretToken() (string, string, error) {
+    var b [32]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        return "", "", err
+    }
+    token := base64.RawURLEncoding.EncodeToString(b[:])
+    return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// startSession signs the user in on a new session and responds with its
+// tokens.
+func (h *AuthHandler) startSession(c *gin.Context, status int, user *models.User) {
+    refreshToken, hash, err := newSecretToken()
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    userAgent := c.Request.UserAgent()
+    if len(userAgent) > maxUserAgentLength {
+        userAgent = userAgent[:maxUserAgentLength]
+    }
+    session := &models.Session{
+        UserID:    user.ID,
+        UserAgent: userAgent,
+        IPAddress: c.ClientIP(),
+    }
+    if err := h.sessionRepo.Create(c.Request.Context(), session, hash, h.refreshExp); err != nil {
+        c.Error(err)
+        return
+    }
+
+    h.respondWithTokens(c, status, user, session.ID, refreshToken)
+}
+
+func (h *AuthHandler) respondWithTokens(c *gin.Context, status int, user *models.User, sessionID, refreshToken string) {
+    token, expiresAt, err := h.generateToken(user, sessionID)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(status, models.AuthResponse{
+        Token:        token,
+        ExpiresAt:    expiresAt,
+        RefreshToken: refreshToken,
+        User:         *user,
+    })
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token works once: presenting one again
+// revokes its session, since only a copy of it could be sent twice.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+    var input models.RefreshInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    refreshToken, hash, err := newSecretToken()
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    ctx := c.Request.Context()
+    session, err := h.sessionRepo.Rotate(ctx, hashSecretToken(input.RefreshToken), hash, h.refreshExp)
+    if errors.Is(err, apperr.ErrNotFound) {
+        c.Error(apperr.Unauthorized("Invalid refresh token"))
+        return
+    }
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    user, err := h.userRepo.GetByID(ctx, session.UserID)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    h.respondWithTokens(c, http.StatusOK, user, session.ID, refreshToken)
+}
+
+// Logout revokes the session the request was made with or, with
+// ?all=true, every session of the user.
+func (h *AuthHandler) Logout(c *gin.Context) {
+    userID := c.GetString("user_id")
+    ctx := c.Request.Context()
+
+    if c.Query("all") == "true" {
+        if _, err := h.sessionRepo.RevokeAll(ctx, userID, ""); err != nil {
+            c.Error(err)
+            return
+        }
+    } else if err := h.sessionRepo.Revoke(ctx, userID, c.GetString("session_id")); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// GetSessions lists the caller's live sessions, marking the current one.
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+    sessions, err := h.sessionRepo.ListActive(c.Request.Context(), c.GetString("user_id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    current := c.GetString("session_id")
+    for i := range sessions {
+        sessions[i].Current = sessions[i].ID == current
+    }
+    c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs one of the caller's devices out.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+    if err := h.sessionRepo.Revoke(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
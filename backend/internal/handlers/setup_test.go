@@ -0,0 +1,285 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/jwtkeys"
+	"sunyi-api/internal/mail"
+	"sunyi-api/internal/middleware"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository/memory"
+	"sunyi-api/internal/server"
+	"sunyi-api/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// testAPI is the full router running against the in-memory store.
+type testAPI struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *memory.Store
+	stores server.Stores
+	cfg    *config.Config
+	keys   *jwtkeys.Keyring
+	mailer *mail.MemoryMailer
+	// signingKey signs new tokens under testSigningKeyID. retiredSecret is
+	// an HMAC key, testRetiredKeyID, that still verifies.
+	signingKey    ed25519.PrivateKey
+	retiredSecret []byte
+}
+
+const (
+	testSigningKeyID = "current"
+	testRetiredKeyID = "previous"
+)
+
+// testKeyring returns a fresh Ed25519 signing key and the keyring built
+// around it and a retired HMAC key.
+func testKeyring(t *testing.T, issuer string, retiredSecret []byte) (ed25519.PrivateKey, *jwtkeys.Keyring) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jwtkeys.NewKeyring(issuer, testSigningKeyID,
+		jwtkeys.Ed25519Key(testSigningKeyID, private),
+		jwtkeys.HMACKey(testRetiredKeyID, retiredSecret),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, keys
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	dir := t.TempDir()
+	return newTestAPIWithBlobs(t, config.UploadConfig{Backend: "local", Dir: dir}, storage.NewLocalStore(dir))
+}
+
+// newTestAPIWithBlobs is newTestAPI with uploads going to blobs.
+func newTestAPIWithBlobs(t *testing.T, uploads config.UploadConfig, blobs storage.BlobStore) *testAPI {
+	t.Helper()
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: "8080", Env: "test"},
+		JWT: config.JWTConfig{
+			Issuer:            "sunyi-test",
+			Expiration:        time.Hour,
+			RefreshExpiration: 24 * time.Hour,
+		},
+		CORS:    config.CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}},
+		Uploads: uploads,
+		Mail:    config.MailConfig{Backend: "memory", AppURL: "http://localhost:3000"},
+		// No backoff, so tests can fail a sign-in and retry at once.
+		Auth: config.AuthConfig{
+			Login: config.LoginThrottleConfig{MaxFailures: 5, Lockout: 15 * time.Minute, IPMaxFailures: 50},
+		},
+	}
+	retiredSecret := []byte("an-old-secret-that-still-verifies")
+	signingKey, keys := testKeyring(t, cfg.JWT.Issuer, retiredSecret)
+	store := memory.New()
+	mailer := mail.NewMemoryMailer()
+	stores := server.Stores{
+		Users:          store.Users,
+		Gigs:           store.Gigs,
+		Venues:         store.Venues,
+		Artists:        store.Artists,
+		Genres:         store.Genres,
+		Sessions:       store.Sessions,
+		PasswordResets: store.PasswordResets,
+		LoginAttempts:  store.LoginAttempts,
+		Blobs:          blobs,
+		Mail:           mailer,
+		Background:     &sync.WaitGroup{},
+	}
+	return &testAPI{
+		t:             t,
+		router:        server.NewRouter(cfg, stores, keys),
+		store:         store,
+		stores:        stores,
+		cfg:           cfg,
+		keys:          keys,
+		mailer:        mailer,
+		signingKey:    signingKey,
+		retiredSecret: retiredSecret,
+	}
+}
+
+// useKeys rebuilds the router around another keyring, keeping the data.
+func (a *testAPI) useKeys(keys *jwtkeys.Keyring) {
+	a.keys = keys
+	a.router = server.NewRouter(a.cfg, a.stores, keys)
+}
+
+// configure changes the config and rebuilds the router, keeping the data.
+func (a *testAPI) configure(change func(cfg *config.Config)) {
+	change(a.cfg)
+	a.router = server.NewRouter(a.cfg, a.stores, a.keys)
+}
+
+// do sends a request with an optional JSON body and bearer token, plus any
+// extra headers given as name, value pairs.
+func (a *testAPI) do(method, path string, body interface{}, token string, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return a.send(req, token, headers)
+}
+
+// patch sends a merge patch document as is.
+func (a *testAPI) patch(path, body, token string, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	return a.send(req, token, headers)
+}
+
+// upload posts data as the multipart "image" field.
+func (a *testAPI) upload(path string, data []byte, token string, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "image.bin")
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return a.send(req, token, headers)
+}
+
+// pngImage encodes a solid image of the given size.
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{200, 40, 40, 255}}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func (a *testAPI) send(req *http.Request, token string, headers []string) *httptest.ResponseRecorder {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	// Let work the request left running finish, so its effects, such as
+	// mail, can be checked as soon as the request returns.
+	a.stores.Background.Wait()
+	return rec
+}
+
+// ifMatch is the header pair for a conditional write against gig's version.
+func ifMatch(gig models.Gig) []string {
+	return []string{"If-Match", fmt.Sprintf(`"%d"`, gig.Version)}
+}
+
+// register creates an account and returns its token and user.
+func (a *testAPI) register(username string, role models.UserRole) (string, models.User) {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/api/auth/register", models.RegisterInput{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "password123",
+		Role:     role,
+	}, "")
+	expectStatus(a.t, rec, http.StatusCreated)
+	var resp models.AuthResponse
+	decode(a.t, rec, &resp)
+	return resp.Token, resp.User
+}
+
+// createGig posts a gig as the given organizer and returns it.
+func (a *testAPI) createGig(token string, input models.CreateGigInput) models.Gig {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/api/gigs", input, token)
+	expectStatus(a.t, rec, http.StatusCreated)
+	var gig models.Gig
+	decode(a.t, rec, &gig)
+	return gig
+}
+
+func gigInput(title, date string) models.CreateGigInput {
+	return models.CreateGigInput{
+		GigInput: models.GigInput{
+			Title:       title,
+			Description: "A night of music",
+			StartsAt:    date + "T20:00",
+			Timezone:    "Asia/Jakarta",
+		},
+		Venue: &models.VenueInput{
+			Name:      "The Club",
+			Address:   "1 Main St",
+			Latitude:  -6.2,
+			Longitude: 106.8,
+		},
+		Status: models.GigStatusPublished,
+	}
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+// expectError checks the machine-readable parts of an error response.
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, code, field string) {
+	t.Helper()
+	var body middleware.ErrorResponse
+	decode(t, rec, &body)
+	if body.Code != code || body.Field != field {
+		t.Fatalf("error = %+v, want code %q field %q", body, code, field)
+	}
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+}
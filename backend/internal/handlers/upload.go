@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/imaging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readImageUpload reads the multipart "image" field, at most maxSize bytes,
+// checks from its bytes that it is an image the API accepts and decodes it.
+// On failure it has already recorded the error on c.
+func readImageUpload(c *gin.Context, maxSize int64) ([]byte, image.Image, imaging.Format, bool) {
+    tooLarge := apperr.TooLarge(fmt.Sprintf("Image must be %dMB or smaller", maxSize>>20))
+
+    // Leave room for the multipart framing around the file itself.
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+    file, header, err := c.Request.FormFile("image")
+    if err != nil {
+        var maxBytes *http.MaxBytesError
+        if errors.As(err, &maxBytes) {
+            c.Error(tooLarge)
+        } else {
+            c.Error(apperr.InvalidField("image", "Image file is required"))
+        }
+        return nil, nil, "", false
+    }
+    defer file.Close()
+
+    if header.Size > maxSize {
+        c.Error(tooLarge)
+        return nil, nil, "", false
+    }
+    data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+    if err != nil {
+        c.Error(err)
+        return nil, nil, "", false
+    }
+    if int64(len(data)) > maxSize {
+        c.Error(tooLarge)
+        return nil, nil, "", false
+    }
+
+    // Trust the file's bytes rather than the client's Content-Type.
+    format, ok := imaging.Detect(data)
+    if !ok {
+        c.Error(apperr.UnsupportedMediaType("Image must be JPEG, PNG, WebP or GIF"))
+        return nil, nil, "", false
+    }
+    img, _, err := imaging.Decode(data)
+    if errors.Is(err, imaging.ErrTooManyPixels) {
+        c.Error(apperr.TooLarge("Image dimensions are too large"))
+        return nil, nil, "", false
+    }
+    if err != nil {
+        c.Error(apperr.InvalidField("image", "Image could not be read"))
+        return nil, nil, "", false
+    }
+    return data, img, format, true
+}
+
+// randomName returns n random bytes, hex encoded, for unguessable blob keys.
+func randomName(n int) (string, error) {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
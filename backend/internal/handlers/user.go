@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+	"sunyi-api/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxProfileImageSize = 5 << 20 // 5 mb
+
+type UserHandler struct {
+    userRepo repository.UserStore
+    gigRepo  repository.GigStore
+    blobs    storage.BlobStore
+}
+
+func NewUserHandler(userRepo repository.UserStore, gigRepo repository.GigStore, blobs storage.BlobStore) *UserHandler {
+    return &UserHandler{
+        userRepo: userRepo,
+        gigRepo:  gigRepo,
+        blobs:    blobs,
+    }
+}
+
+func (h *UserHandler) GetUser(c *gin.Context) {
+    user, err := h.userRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user.Public())
+}
+
+// GetProfile returns the public profile page payload: the user and the gigs
+// they have coming up.
+func (h *UserHandler) GetProfile(c *gin.Context) {
+    user, err := h.userRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    page, err := h.gigRepo.List(c.Request.Context(), models.GigFilter{
+        OrganizerID: user.ID,
+        Upcoming:    true,
+        Limit:       100,
+    })
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, models.UserProfile{
+        User:         user.Public(),
+        UpcomingGigs: page.Data,
+    })
+}
+
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var input models.UpdateUserInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    // A taken username is rejected by users_username_key, as in Register.
+    if input.Username != nil {
+        user.Username = *input.Username
+    }
+    if input.Bio != nil {
+        user.Bio = input.Bio
+    }
+    if input.ProfileImage != nil {
+        user.ProfileImage = input.ProfileImage
+    }
+
+    if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// UploadProfileImage stores the multipart "image" field in the blob store
+// and points the user's profile_image at it.
+func (h *UserHandler) UploadProfileImage(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    data, _, format, ok := readImageUpload(c, maxProfileImageSize)
+    if !ok {
+        return
+    }
+
+    suffix, err := randomName(8)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    key := "profiles/" + user.ID + "-" + suffix + format.Ext()
+    url, err := h.blobs.Put(c.Request.Context(), key, data, format.ContentType())
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    user.ProfileImage = &url
+    if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// currentUser loads the user named in the path and checks that it is the
+// authenticated caller. On failure it has already recorded the error on c.
+func (h *UserHandler) currentUser(c *gin.Context) (*models.User, bool) {
+    userID, _ := c.Get("user_id")
+    if c.Param("id") != userID.(string) {
+        c.Error(apperr.Forbidden("You can only update your own profile"))
+        return nil, false
+    }
+
+    user, err := h.userRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return nil, false
+    }
+
+    return user, true
+}
@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+)
+
+func TestGetUserIsPublic(t *testing.T) {
+	api := newTestAPI(t)
+	_, user := api.register("alice", models.RoleUser)
+
+	rec := api.do(http.MethodGet, "/api/users/"+user.ID, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), "alice@example.com") {
+		t.Fatalf("public user leaks email: %s", rec.Body.String())
+	}
+
+	expectStatus(t, api.do(http.MethodGet, "/api/users/missing", nil, ""), http.StatusNotFound)
+}
+
+func TestUpdateUser(t *testing.T) {
+	api := newTestAPI(t)
+	token, user := api.register("alice", models.RoleUser)
+	otherToken, _ := api.register("bob", models.RoleUser)
+
+	bio := "Gig goer"
+	expectStatus(t, api.do(http.MethodPut, "/api/users/"+user.ID, models.UpdateUserInput{Bio: &bio}, otherToken), http.StatusForbidden)
+
+	rec := api.do(http.MethodPut, "/api/users/"+user.ID, models.UpdateUserInput{Bio: &bio}, token)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.User
+	decode(t, rec, &updated)
+	if updated.Bio == nil || *updated.Bio != bio || updated.Username != "alice" {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	taken := "bob"
+	expectStatus(t, api.do(http.MethodPut, "/api/users/"+user.ID, models.UpdateUserInput{Username: &taken}, token), http.StatusConflict)
+}
+
+func TestUserProfileListsUpcomingGigs(t *testing.T) {
+	api := newTestAPI(t)
+	token, organizer := api.register("organizer", models.RoleOrganizer)
+	api.createGig(token, gigInput("Future", "2999-01-01"))
+	api.createGig(token, gigInput("Past", "2000-01-01"))
+
+	rec := api.do(http.MethodGet, "/api/users/"+organizer.ID+"/profile", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var profile models.UserProfile
+	decode(t, rec, &profile)
+	if profile.User.ID != organizer.ID || len(profile.UpcomingGigs) != 1 || profile.UpcomingGigs[0].Title != "Future" {
+		t.Fatalf("profile = %+v", profile)
+	}
+}
+
+func TestUploadProfileImage(t *testing.T) {
+	api := newTestAPI(t)
+	token, user := api.register("alice", models.RoleUser)
+	_, other := api.register("bob", models.RoleUser)
+
+	path := "/api/users/" + user.ID + "/profile-image"
+	expectStatus(t, api.upload("/api/users/"+other.ID+"/profile-image", pngImage(t, 64, 64), token), http.StatusForbidden)
+	expectStatus(t, api.upload(path, []byte("GIF87a"), token), http.StatusBadRequest)
+
+	rec := api.upload(path, pngImage(t, 64, 64), token)
+	expectStatus(t, rec, http.StatusOK)
+	var updated models.User
+	decode(t, rec, &updated)
+	if updated.ProfileImage == nil || !strings.HasPrefix(*updated.ProfileImage, "/uploads/profiles/"+user.ID+"-") {
+		t.Fatalf("profile_image = %v", updated.ProfileImage)
+	}
+	expectStatus(t, api.do(http.MethodGet, *updated.ProfileImage, nil, ""), http.StatusOK)
+
+	// The URL an upload returns can be set again as is.
+	update := models.UpdateUserInput{ProfileImage: updated.ProfileImage}
+	expectStatus(t, api.do(http.MethodPut, "/api/users/"+user.ID, update, token), http.StatusOK)
+	for _, bad := range []string{"/etc/passwd", "/uploads/../config.yaml", "javascript:alert(1)", "ftp://example.com/a.png"} {
+		update.ProfileImage = &bad
+		rec = api.do(http.MethodPut, "/api/users/"+user.ID, update, token)
+		expectStatus(t, rec, http.StatusBadRequest)
+		expectError(t, rec, apperr.CodeValidation, "profile_image")
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// codeDuplicateVenue marks a new venue that looks like one already listed
+// nearby.
+const codeDuplicateVenue = "duplicate_venue"
+
+type VenueHandler struct {
+    venueRepo repository.VenueStore
+    gigRepo   repository.GigStore
+}
+
+func NewVenueHandler(venueRepo repository.VenueStore, gigRepo repository.GigStore) *VenueHandler {
+    return &VenueHandler{venueRepo: venueRepo, gigRepo: gigRepo}
+}
+
+func (h *VenueHandler) GetVenues(c *gin.Context) {
+    var filter models.VenueFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    venues, err := h.venueRepo.List(c.Request.Context(), filter)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, venues)
+}
+
+func (h *VenueHandler) GetVenueByID(c *gin.Context) {
+    venue, err := h.venueRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, venue)
+}
+
+// GetVenueGigs lists the gigs at a venue, with the same filters and paging
+// as GET /api/gigs.
+func (h *VenueHandler) GetVenueGigs(c *gin.Context) {
+    venue, err := h.venueRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    var filter models.GigFilter
+    if err := c.ShouldBindQuery(&filter); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    filter.VenueID = venue.ID
+    filter.ViewerID = viewerID(c)
+
+    page, err := h.gigRepo.List(c.Request.Context(), filter)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, page)
+}
+
+// CreateVenue adds a venue, refusing one that matches a venue already
+// listed nearby the same way a new gig's inline venue would be matched.
+func (h *VenueHandler) CreateVenue(c *gin.Context) {
+    var input models.VenueInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    nearby, err := h.venueRepo.List(c.Request.Context(), models.VenueFilter{
+        Latitude:  &input.Latitude,
+        Longitude: &input.Longitude,
+        RadiusKm:  models.VenueMatchRadiusKm,
+        Limit:     repository.MaxGigPageSize,
+    })
+    if err != nil {
+        c.Error(err)
+        return
+    }
+    if match := models.MatchVenue(nearby, input.Name); match != nil {
+        c.Error(apperr.Conflict("name", "Venue "+match.Name+" is already listed nearby").WithCode(codeDuplicateVenue))
+        return
+    }
+
+    creatorID := viewerID(c)
+    venue := &models.Venue{
+        Name:      input.Name,
+        Address:   input.Address,
+        Latitude:  input.Latitude,
+        Longitude: input.Longitude,
+        CreatedBy: &creatorID,
+    }
+    if err := h.venueRepo.Create(c.Request.Context(), venue); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusCreated, venue)
+}
+
+// UpdateVenue edits a venue. Every gig held there shows the change.
+func (h *VenueHandler) UpdateVenue(c *gin.Context) {
+    venue, ok := h.ownVenue(c, "update")
+    if !ok {
+        return
+    }
+
+    var input models.VenueInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    venue.Name = input.Name
+    venue.Address = input.Address
+    venue.Latitude = input.Latitude
+    venue.Longitude = input.Longitude
+    if err := h.venueRepo.Update(c.Request.Context(), venue); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, venue)
+}
+
+// DeleteVenue removes a venue no gig takes place at.
+func (h *VenueHandler) DeleteVenue(c *gin.Context) {
+    venue, ok := h.ownVenue(c, "delete")
+    if !ok {
+        return
+    }
+
+    if err := h.venueRepo.Delete(c.Request.Context(), venue.ID); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Venue deleted successfully"})
+}
+
+// ownVenue loads the venue in the path and checks that the caller added it.
+// A venue whose creator has left can no longer be edited through the API.
+// On failure it has already recorded the error on c.
+func (h *VenueHandler) ownVenue(c *gin.Context, action string) (*models.Venue, bool) {
+    venue, err := h.venueRepo.GetByID(c.Request.Context(), c.Param("id"))
+    if err != nil {
+        c.Error(err)
+        return nil, false
+    }
+
+    if venue.CreatedBy == nil || *venue.CreatedBy != viewerID(c) {
+        c.Error(apperr.Forbidden("You can only " + action + " venues you added"))
+        return nil, false
+    }
+
+    return venue, true
+}
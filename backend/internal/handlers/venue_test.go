@@ -0,0 +1,158 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+)
+
+func TestCreateGigMatchesNearbyVenue(t *testing.T) {
+	api := newTestAPI(t)
+	token, organizer := api.register("organizer", models.RoleOrganizer)
+
+	first := api.createGig(token, gigInput("First", "2030-01-01"))
+	if first.VenueID == "" || first.VenueName != "The Club" || first.Latitude != -6.2 {
+		t.Fatalf("first = %+v", first)
+	}
+
+	// Another spelling a few metres away is the same venue.
+	respelled := gigInput("Second", "2030-01-02")
+	respelled.Venue.Name = "club"
+	respelled.Venue.Latitude = -6.2005
+	second := api.createGig(token, respelled)
+	if second.VenueID != first.VenueID || second.VenueName != "The Club" {
+		t.Fatalf("second = %+v, want venue %s", second, first.VenueID)
+	}
+
+	// The same name across town is not.
+	elsewhere := gigInput("Third", "2030-01-03")
+	elsewhere.Venue.Latitude = -6.3
+	third := api.createGig(token, elsewhere)
+	if third.VenueID == first.VenueID {
+		t.Fatal("venue 11 km away was matched")
+	}
+
+	byID := gigInput("Fourth", "2030-01-04")
+	byID.Venue = nil
+	byID.VenueID = third.VenueID
+	if fourth := api.createGig(token, byID); fourth.VenueID != third.VenueID || fourth.Latitude != -6.3 {
+		t.Fatalf("fourth = %+v", fourth)
+	}
+
+	rec := api.do(http.MethodGet, "/api/venues/"+first.VenueID, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var venue models.Venue
+	decode(t, rec, &venue)
+	if venue.CreatedBy == nil || *venue.CreatedBy != organizer.ID {
+		t.Fatalf("venue = %+v", venue)
+	}
+
+	neither := gigInput("Nowhere", "2030-01-05")
+	neither.Venue = nil
+	rec = api.do(http.MethodPost, "/api/gigs", neither, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "venue_id")
+
+	neither.VenueID = "00000000-0000-0000-0000-000000000000"
+	rec = api.do(http.MethodPost, "/api/gigs", neither, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+	expectError(t, rec, apperr.CodeValidation, "venue_id")
+}
+
+func TestVenueGigs(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	gig := api.createGig(token, gigInput("Here", "2030-01-01"))
+	elsewhere := gigInput("There", "2030-01-02")
+	elsewhere.Venue.Name = "Warehouse"
+	api.createGig(token, elsewhere)
+	draft := gigInput("Draft", "2030-01-03")
+	draft.Status = models.GigStatusDraft
+	api.createGig(token, draft)
+
+	path := "/api/venues/" + gig.VenueID + "/gigs"
+	rec := api.do(http.MethodGet, path, nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var page models.GigListResponse
+	decode(t, rec, &page)
+	if page.Total != 1 || page.Data[0].ID != gig.ID || page.Data[0].VenueName != "The Club" {
+		t.Fatalf("venue gigs = %+v", page)
+	}
+
+	// The organizer also sees their draft there.
+	rec = api.do(http.MethodGet, path, nil, token)
+	decode(t, rec, &page)
+	if page.Total != 2 {
+		t.Fatalf("venue gigs for organizer = %+v", page)
+	}
+
+	rec = api.do(http.MethodGet, "/api/gigs?venue_id="+gig.VenueID, nil, "")
+	decode(t, rec, &page)
+	if page.Total != 1 {
+		t.Fatalf("gigs filtered by venue = %+v", page)
+	}
+
+	expectStatus(t, api.do(http.MethodGet, "/api/venues/00000000-0000-0000-0000-000000000000/gigs", nil, ""), http.StatusNotFound)
+}
+
+func TestVenueCRUD(t *testing.T) {
+	api := newTestAPI(t)
+	token, _ := api.register("organizer", models.RoleOrganizer)
+	otherToken, _ := api.register("other", models.RoleOrganizer)
+	fanToken, _ := api.register("fan", models.RoleUser)
+
+	input := models.VenueInput{Name: "Jazz Cellar", Address: "2 Side St", Latitude: -6.2, Longitude: 106.8}
+	expectStatus(t, api.do(http.MethodPost, "/api/venues", input, fanToken), http.StatusForbidden)
+
+	rec := api.do(http.MethodPost, "/api/venues", input, token)
+	expectStatus(t, rec, http.StatusCreated)
+	var venue models.Venue
+	decode(t, rec, &venue)
+
+	duplicate := input
+	duplicate.Name = "The Jazz-Cellar"
+	rec = api.do(http.MethodPost, "/api/venues", duplicate, otherToken)
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, "duplicate_venue", "name")
+
+	rec = api.do(http.MethodGet, "/api/venues?q=jazz", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var venues []models.Venue
+	decode(t, rec, &venues)
+	if len(venues) != 1 || venues[0].ID != venue.ID {
+		t.Fatalf("search = %+v", venues)
+	}
+	rec = api.do(http.MethodGet, "/api/venues?lat=-6.3&lng=106.8&radius_km=5", nil, "")
+	decode(t, rec, &venues)
+	if len(venues) != 0 {
+		t.Fatalf("venues 11 km away = %+v", venues)
+	}
+
+	renamed := input
+	renamed.Name = "Jazz Basement"
+	expectStatus(t, api.do(http.MethodPut, "/api/venues/"+venue.ID, renamed, otherToken), http.StatusForbidden)
+	rec = api.do(http.MethodPut, "/api/venues/"+venue.ID, renamed, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	gigInput := gigInput("Show", "2030-01-01")
+	gigInput.Venue = nil
+	gigInput.VenueID = venue.ID
+	gig := api.createGig(token, gigInput)
+	if gig.VenueName != "Jazz Basement" {
+		t.Fatalf("gig venue = %q", gig.VenueName)
+	}
+
+	rec = api.do(http.MethodDelete, "/api/venues/"+venue.ID, nil, token)
+	expectStatus(t, rec, http.StatusConflict)
+	expectError(t, rec, apperr.CodeConflict, "venue")
+
+	unused := models.VenueInput{Name: "Empty Hall", Address: "3 Far St", Latitude: -7, Longitude: 110}
+	rec = api.do(http.MethodPost, "/api/venues", unused, token)
+	expectStatus(t, rec, http.StatusCreated)
+	decode(t, rec, &venue)
+	expectStatus(t, api.do(http.MethodDelete, "/api/venues/"+venue.ID, nil, otherToken), http.StatusForbidden)
+	expectStatus(t, api.do(http.MethodDelete, "/api/venues/"+venue.ID, nil, token), http.StatusOK)
+	expectStatus(t, api.do(http.MethodGet, "/api/venues/"+venue.ID, nil, ""), http.StatusNotFound)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/mail"
+	"sunyi-api/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+    // verifyEmailAudience sets verification tokens apart from access tokens,
+    // which are signed by the same keys. Access tokens carry no audience, and
+    // verification tokens carry no session, so neither passes for the other.
+    verifyEmailAudience = "verify-email"
+    verificationTokenTTL = 48 * time.Hour
+    // verificationResendInterval is how often one account may be mailed a
+    // verification link.
+    verificationResendInterval = time.Minute
+)
+
+// verificationClaims bind a token to the address it was mailed to, so it
+// stops working if the address changes.
+type verificationClaims struct {
+    Email string `json:"email"`
+    jwt.RegisteredClaims
+}
+
+// sendVerificationEmail mails the user a link to verify their address,
+// unless one went out within verificationResendInterval.
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+    wait, err := h.userRepo.ClaimVerificationEmail(ctx, user.ID, verificationResendInterval)
+    if err != nil {
+        return err
+    }
+    if wait > 0 {
+        return apperr.TooManyRequests("A verification email was sent recently; try again later", wait)
+    }
+
+    now := time.Now()
+    token, err := h.keys.Sign(&verificationClaims{
+        Email: user.Email,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Issuer:    h.keys.Issuer(),
+            Subject:   user.ID,
+            Audience:  jwt.ClaimStrings{verifyEmailAudience},
+            ExpiresAt: jwt.NewNumericDate(now.Add(verificationTokenTTL)),
+            IssuedAt:  jwt.NewNumericDate(now),
+        },
+    })
+    if err != nil {
+        return err
+    }
+
+    link := h.appURL + "/verify-email?token=" + url.QueryEscape(token)
+    return h.mailer.Send(ctx, mail.Message{
+        To:      user.Email,
+        Subject: "Verify your email address",
+        Body: fmt.Sprintf(
+            "Hi %s,\n\nConfirm this is your email address by opening the link below:\n\n%s\n\n"+
+                "The link works once and expires in %d hours. If you did not sign up, ignore this email.\n",
+            user.Username, link, int(verificationTokenTTL.Hours()),
+        ),
+    })
+}
+
+// VerifyEmail marks the address a verification link was sent to as
+// verified. Each link works once. Access tokens issued earlier still say
+// the address is unverified until the client refreshes them.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+    var input models.VerifyEmailInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.Error(err).SetType(gin.ErrorTypeBind)
+        return
+    }
+
+    invalid := apperr.InvalidField("token", "Verification link is invalid or has expired").WithCode(apperr.CodeInvalidToken)
+    var claims verificationClaims
+    if err := h.keys.Parse(input.Token, &claims, jwt.WithAudience(verifyEmailAudience)); err != nil {
+        c.Error(invalid)
+        return
+    }
+
+    ctx := c.Request.Context()
+    if _, err := h.userRepo.MarkEmailVerified(ctx, claims.Subject, claims.Email); err != nil {
+        if errors.Is(err, apperr.ErrNotFound) {
+            err = invalid
+        }
+        c.Error(err)
+        return
+    }
+
+    user, err := h.userRepo.GetByID(ctx, claims.Subject)
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// ResendVerification mails the caller a fresh verification link. Links
+// sent before keep working until they expire.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+    ctx := c.Request.Context()
+    user, err := h.userRepo.GetByID(ctx, c.GetString("user_id"))
+    if err != nil {
+        c.Error(err)
+        return
+    }
+
+    if err := h.sendVerificationEmail(ctx, user); err != nil {
+        c.Error(err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+// Package imaging recognises uploaded images by their bytes and produces
+// resized copies of them.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the decoded size of an image, so a small file that
+// declares huge dimensions cannot exhaust memory.
+const MaxPixels = 40_000_000
+
+var (
+    ErrUnsupported   = errors.New("unsupported image type")
+    ErrTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// Format is an image encoding the API accepts.
+type Format string
+
+const (
+    JPEG Format = "jpeg"
+    PNG  Format = "png"
+    GIF  Format = "gif"
+    WebP Format = "webp"
+)
+
+var contentTypes = map[Format]string{
+    JPEG: "image/jpeg",
+    PNG:  "image/png",
+    GIF:  "image/gif",
+    WebP: "image/webp",
+}
+
+var extensions = map[Format]string{
+    JPEG: ".jpg",
+    PNG:  ".png",
+    GIF:  ".gif",
+    WebP: ".webp",
+}
+
+func (f Format) ContentType() string {
+    return contentTypes[f]
+}
+
+func (f Format) Ext() string {
+    return extensions[f]
+}
+
+// Detect sniffs the format from the leading bytes of a file, ignoring
+// whatever the client claimed.
+func Detect(data []byte) (Format, bool) {
+    sniffed := http.DetectContentType(data)
+    for format, contentType := range contentTypes {
+        if contentType == sniffed {
+            return format, true
+        }
+    }
+    return "", false
+}
+
+// Decode reads an image after checking its declared dimensions against
+// MaxPixels. Only the first frame of an animated GIF is returned.
+func Decode(data []byte) (image.Image, Format, error) {
+    config, name, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        if errors.Is(err, image.ErrFormat) {
+            return nil, "", ErrUnsupported
+        }
+        return nil, "", err
+    }
+    if _, ok := contentTypes[Format(name)]; !ok {
+        return nil, "", ErrUnsupported
+    }
+    if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+        return nil, "", ErrTooManyPixels
+    }
+
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", err
+    }
+    return img, Format(name), nil
+}
+
+// Resize scales img down to width, keeping its aspect ratio. An image that
+// is already narrower is returned as is; images are never scaled up.
+func Resize(img image.Image, width int) image.Image {
+    bounds := img.Bounds()
+    if bounds.Dx() <= width {
+        return img
+    }
+    height := bounds.Dy() * width / bounds.Dx()
+    if height < 1 {
+        height = 1
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, width, height))
+    draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+    return dst
+}
+
+// Encode writes a resized copy in a format suited to it: PNG for sources
+// that may be transparent (PNG and GIF), JPEG otherwise. There is no WebP
+// encoder, so WebP sources become JPEG too.
+func Encode(img image.Image, source Format) ([]byte, Format, error) {
+    var buf bytes.Buffer
+    switch source {
+    case PNG, GIF:
+        if err := png.Encode(&buf, img); err != nil {
+            return nil, "", err
+        }
+        return buf.Bytes(), PNG, nil
+    default:
+        if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+            return nil, "", err
+        }
+        return buf.Bytes(), JPEG, nil
+    }
+}
@@ -0,0 +1,59 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+)
+
+// JWK is a public key in JSON Web Key form (RFC 7517, and RFC 8037 for
+// Ed25519).
+type JWK struct {
+    KeyType   string `json:"kty"`
+    KeyID     string `json:"kid"`
+    Use       string `json:"use"`
+    Algorithm string `json:"alg"`
+    Curve     string `json:"crv,omitempty"`
+    X         string `json:"x,omitempty"`
+    N         string `json:"n,omitempty"`
+    E         string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+    Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public halves of the asymmetric keys, signing key first,
+// so other services can verify tokens themselves. HMAC keys are secret and
+// never listed; tokens signed with one can only be verified here.
+func (r *Keyring) JWKS() JWKSet {
+    set := JWKSet{Keys: []JWK{}}
+    for _, key := range r.keys {
+        jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+        switch public := key.verifyKey.(type) {
+        case ed25519.PublicKey:
+            jwk.KeyType = "OKP"
+            jwk.Curve = "Ed25519"
+            jwk.X = base64.RawURLEncoding.EncodeToString(public)
+        case *rsa.PublicKey:
+            jwk.KeyType = "RSA"
+            jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+            jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+        default:
+            continue
+        }
+        set.Keys = append(set.Keys, jwk)
+    }
+
+    sort.Slice(set.Keys, func(i, j int) bool {
+        a, b := set.Keys[i].KeyID, set.Keys[j].KeyID
+        if a == r.signing.ID || b == r.signing.ID {
+            return a == r.signing.ID
+        }
+        return a < b
+    })
+    return set
+}
@@ -0,0 +1,164 @@
+// Package jwtkeys holds the keys access tokens are signed and verified
+// with. Every key has an id, sent as the token's kid header, and a single
+// algorithm; a token is only accepted when its kid names a known key and
+// its alg is that key's. One key signs, the others only verify, so keys can
+// be rotated without rejecting tokens already handed out.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithms a key can have.
+const (
+    HS256 = "HS256"
+    RS256 = "RS256"
+    EdDSA = "EdDSA"
+)
+
+// MinRSABits is the smallest RSA modulus accepted.
+const MinRSABits = 2048
+
+var (
+    ErrUnknownKey        = errors.New("token signed with an unknown key")
+    ErrAlgorithmMismatch = errors.New("token algorithm does not match its key")
+)
+
+var methods = map[string]jwt.SigningMethod{
+    HS256: jwt.SigningMethodHS256,
+    RS256: jwt.SigningMethodRS256,
+    EdDSA: jwt.SigningMethodEdDSA,
+}
+
+// Key is one signing or verification key.
+type Key struct {
+    ID        string
+    Algorithm string
+    // signKey is nil for a key that only verifies.
+    signKey   interface{}
+    verifyKey interface{}
+}
+
+func HMACKey(id string, secret []byte) Key {
+    return Key{ID: id, Algorithm: HS256, signKey: secret, verifyKey: secret}
+}
+
+func Ed25519Key(id string, private ed25519.PrivateKey) Key {
+    return Key{ID: id, Algorithm: EdDSA, signKey: private, verifyKey: private.Public()}
+}
+
+func RSAKey(id string, private *rsa.PrivateKey) Key {
+    return Key{ID: id, Algorithm: RS256, signKey: private, verifyKey: &private.PublicKey}
+}
+
+// PublicKey is a key that only verifies, such as a retired key whose
+// private half has been destroyed. public is an ed25519.PublicKey or an
+// *rsa.PublicKey.
+func PublicKey(id string, public interface{}) (Key, error) {
+    switch public := public.(type) {
+    case ed25519.PublicKey:
+        return Key{ID: id, Algorithm: EdDSA, verifyKey: public}, nil
+    case *rsa.PublicKey:
+        return Key{ID: id, Algorithm: RS256, verifyKey: public}, nil
+    default:
+        return Key{}, fmt.Errorf("key %q: unsupported public key type %T", id, public)
+    }
+}
+
+// CanSign reports whether the private or secret half of the key is known.
+func (k Key) CanSign() bool {
+    return k.signKey != nil
+}
+
+// Keyring signs tokens with its signing key and verifies them with any of
+// its keys.
+type Keyring struct {
+    issuer  string
+    signing Key
+    keys    map[string]Key
+    methods []string
+}
+
+// NewKeyring builds a keyring that signs with the key named signingID and
+// issues and accepts tokens from issuer.
+func NewKeyring(issuer, signingID string, keys ...Key) (*Keyring, error) {
+    ring := &Keyring{issuer: issuer, keys: map[string]Key{}}
+    algorithms := map[string]bool{}
+    for _, key := range keys {
+        if key.ID == "" {
+            return nil, errors.New("key without an id")
+        }
+        if _, ok := ring.keys[key.ID]; ok {
+            return nil, fmt.Errorf("duplicate key id %q", key.ID)
+        }
+        if _, ok := methods[key.Algorithm]; !ok {
+            return nil, fmt.Errorf("key %q: unsupported algorithm %q", key.ID, key.Algorithm)
+        }
+        if public, ok := key.verifyKey.(*rsa.PublicKey); ok && public.N.BitLen() < MinRSABits {
+            return nil, fmt.Errorf("key %q: RSA keys must have at least %d bits", key.ID, MinRSABits)
+        }
+        ring.keys[key.ID] = key
+        algorithms[key.Algorithm] = true
+    }
+
+    signing, ok := ring.keys[signingID]
+    if !ok {
+        return nil, fmt.Errorf("signing key %q not found", signingID)
+    }
+    if !signing.CanSign() {
+        return nil, fmt.Errorf("signing key %q is a public key", signingID)
+    }
+    ring.signing = signing
+
+    for algorithm := range algorithms {
+        ring.methods = append(ring.methods, algorithm)
+    }
+    sort.Strings(ring.methods)
+    return ring, nil
+}
+
+func (r *Keyring) Issuer() string {
+    return r.issuer
+}
+
+// Sign issues a token for claims with the signing key, naming it in the
+// kid header.
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+    token := jwt.NewWithClaims(methods[r.signing.Algorithm], claims)
+    token.Header["kid"] = r.signing.ID
+    return token.SignedString(r.signing.signKey)
+}
+
+// Parse verifies tokenString and decodes it into claims. The token must
+// name a known key, use that key's algorithm, come from the keyring's
+// issuer and carry an expiry. opts add checks, such as an audience.
+func (r *Keyring) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+    opts = append([]jwt.ParserOption{
+        jwt.WithValidMethods(r.methods),
+        jwt.WithIssuer(r.issuer),
+        jwt.WithExpirationRequired(),
+    }, opts...)
+    _, err := jwt.ParseWithClaims(tokenString, claims, r.verifyKey, opts...)
+    return err
+}
+
+// verifyKey picks the key a token names. Checking the algorithm against the
+// key, not just against the allowed list, stops an RS256 public key being
+// used as an HS256 secret.
+func (r *Keyring) verifyKey(token *jwt.Token) (interface{}, error) {
+    id, _ := token.Header["kid"].(string)
+    key, ok := r.keys[id]
+    if !ok {
+        return nil, ErrUnknownKey
+    }
+    if token.Method.Alg() != key.Algorithm {
+        return nil, ErrAlgorithmMismatch
+    }
+    return key.verifyKey, nil
+}
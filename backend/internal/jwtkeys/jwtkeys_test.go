@@ -0,0 +1,206 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const issuer = "sunyi-api"
+
+var (
+	secret        = []byte(strings.Repeat("s", MinSecretBytes))
+	retiredSecret = []byte(strings.Repeat("r", MinSecretBytes))
+)
+
+// testKeys returns an HS256 signing key, a retired HS256 key, an Ed25519
+// key and an RSA key, with the RSA private key for forging tokens with.
+func testKeys(t *testing.T) ([]Key, *rsa.PrivateKey) {
+	t.Helper()
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, MinRSABits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []Key{
+		HMACKey("current", secret),
+		HMACKey("retired", retiredSecret),
+		Ed25519Key("ed", edPrivate),
+		RSAKey("rsa", rsaPrivate),
+	}, rsaPrivate
+}
+
+// token signs claims with method and key, naming kid unless it is empty.
+func token(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParse(t *testing.T) {
+	keys, rsaPrivate := testKeys(t)
+	ring, err := NewKeyring(issuer, "current", keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPrivate := keys[2].signKey
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	valid := jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   "user-1",
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	noExpiry := valid
+	noExpiry.ExpiresAt = nil
+	otherIssuer := valid
+	otherIssuer.Issuer = "someone-else"
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"signing key", token(t, jwt.SigningMethodHS256, "current", secret, valid), nil},
+		{"retired key", token(t, jwt.SigningMethodHS256, "retired", retiredSecret, valid), nil},
+		{"Ed25519 key", token(t, jwt.SigningMethodEdDSA, "ed", edPrivate, valid), nil},
+		{"RSA key", token(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, valid), nil},
+		{"unknown kid", token(t, jwt.SigningMethodHS256, "gone", secret, valid), ErrUnknownKey},
+		{"no kid", token(t, jwt.SigningMethodHS256, "", secret, valid), ErrUnknownKey},
+		{
+			"another key's secret",
+			token(t, jwt.SigningMethodHS256, "current", retiredSecret, valid),
+			jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			// The RSA public key is no secret, so an HS256 token made with
+			// it must not verify against the RSA key.
+			"HS256 under an RSA kid",
+			token(t, jwt.SigningMethodHS256, "rsa", rsaPublicDER, valid),
+			ErrAlgorithmMismatch,
+		},
+		{
+			"EdDSA under an HMAC kid",
+			token(t, jwt.SigningMethodEdDSA, "current", edPrivate, valid),
+			ErrAlgorithmMismatch,
+		},
+		{
+			"algorithm no key has",
+			token(t, jwt.SigningMethodHS512, "current", secret, valid),
+			jwt.ErrTokenSignatureInvalid,
+		},
+		{"expired", token(t, jwt.SigningMethodHS256, "current", secret, expired), jwt.ErrTokenExpired},
+		{"no expiry", token(t, jwt.SigningMethodHS256, "current", secret, noExpiry), jwt.ErrTokenRequiredClaimMissing},
+		{"other issuer", token(t, jwt.SigningMethodHS256, "current", secret, otherIssuer), jwt.ErrTokenInvalidIssuer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims jwt.RegisteredClaims
+			err := ring.Parse(tt.token, &claims)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want the token accepted", err)
+				}
+				if claims.Subject != "user-1" {
+					t.Fatalf("got subject %q, want user-1", claims.Subject)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignNamesTheSigningKey(t *testing.T) {
+	keys, _ := testKeys(t)
+	for _, signingID := range []string{"current", "ed", "rsa"} {
+		ring, err := NewKeyring(issuer, signingID, keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := ring.Sign(jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims jwt.RegisteredClaims
+		parsed, _, err := jwt.NewParser().ParseUnverified(signed, &claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header["kid"] != signingID || parsed.Method.Alg() != ring.signing.Algorithm {
+			t.Fatalf("signed with kid %v alg %s, want %s %s",
+				parsed.Header["kid"], parsed.Method.Alg(), signingID, ring.signing.Algorithm)
+		}
+		if err := ring.Parse(signed, &claims); err != nil {
+			t.Fatalf("%s: own token rejected: %v", signingID, err)
+		}
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	keys, rsaPrivate := testKeys(t)
+	public, err := PublicKey("old-rsa", &rsaPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		signingID string
+		keys      []Key
+		want      string
+	}{
+		{"public key alongside", "current", append(keys, public), ""},
+		{"missing signing key", "nope", keys, `signing key "nope" not found`},
+		{"public signing key", "old-rsa", append(keys, public), `signing key "old-rsa" is a public key`},
+		{"duplicate id", "current", append(keys, HMACKey("current", retiredSecret)), `duplicate key id "current"`},
+		{"key without an id", "current", append(keys, HMACKey("", secret)), "key without an id"},
+		{"small RSA key", "current", append(keys, RSAKey("small", small)), "RSA keys must have at least"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(issuer, tt.signingID, tt.keys...)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("got %v, want a keyring", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package jwtkeys
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sunyi-api/config"
+)
+
+// SecretKeyID is the id of the HMAC key JWT_SECRET configures.
+const SecretKeyID = "default"
+
+// MinSecretBytes is the shortest HMAC secret accepted from a key file.
+const MinSecretBytes = 32
+
+// Load builds the keyring cfg describes: JWT_SECRET as the HS256 key
+// SecretKeyID, plus every key file in KeysDir. A file's name less its
+// extension is the key id. "<kid>.pem" holds an Ed25519 or RSA key, private
+// (PKCS #8, or PKCS #1 for RSA) or public for a key that only verifies;
+// "<kid>.secret" holds an HMAC secret. Other files are ignored. The key
+// named by SigningKeyID signs, or the JWT_SECRET key when none is named.
+func Load(cfg config.JWTConfig) (*Keyring, error) {
+    var keys []Key
+    if cfg.Secret != "" {
+        keys = append(keys, HMACKey(SecretKeyID, []byte(cfg.Secret)))
+    }
+
+    if cfg.KeysDir != "" {
+        entries, err := os.ReadDir(cfg.KeysDir)
+        if err != nil {
+            return nil, fmt.Errorf("read JWT keys: %w", err)
+        }
+        for _, entry := range entries {
+            ext := filepath.Ext(entry.Name())
+            if entry.IsDir() || (ext != ".pem" && ext != ".secret") {
+                continue
+            }
+            data, err := os.ReadFile(filepath.Join(cfg.KeysDir, entry.Name()))
+            if err != nil {
+                return nil, fmt.Errorf("read JWT key: %w", err)
+            }
+            id := strings.TrimSuffix(entry.Name(), ext)
+            var key Key
+            if ext == ".pem" {
+                key, err = parsePEM(id, data)
+            } else {
+                key, err = parseSecret(id, data)
+            }
+            if err != nil {
+                return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+            }
+            keys = append(keys, key)
+        }
+    }
+
+    signingID := cfg.SigningKeyID
+    if signingID == "" {
+        signingID = SecretKeyID
+    }
+    return NewKeyring(cfg.Issuer, signingID, keys...)
+}
+
+func parseSecret(id string, data []byte) (Key, error) {
+    secret := bytes.TrimSpace(data)
+    if len(secret) < MinSecretBytes {
+        return Key{}, fmt.Errorf("HMAC secret must be at least %d bytes", MinSecretBytes)
+    }
+    return HMACKey(id, secret), nil
+}
+
+func parsePEM(id string, data []byte) (Key, error) {
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return Key{}, fmt.Errorf("no PEM block found")
+    }
+
+    switch block.Type {
+    case "PRIVATE KEY":
+        private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+        if err != nil {
+            return Key{}, err
+        }
+        switch private := private.(type) {
+        case ed25519.PrivateKey:
+            return Ed25519Key(id, private), nil
+        case *rsa.PrivateKey:
+            return RSAKey(id, private), nil
+        default:
+            return Key{}, fmt.Errorf("unsupported private key type %T", private)
+        }
+    case "RSA PRIVATE KEY":
+        private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+        if err != nil {
+            return Key{}, err
+        }
+        return RSAKey(id, private), nil
+    case "PUBLIC KEY":
+        public, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+            return Key{}, err
+        }
+        return PublicKey(id, public)
+    case "RSA PUBLIC KEY":
+        public, err := x509.ParsePKCS1PublicKey(block.Bytes)
+        if err != nil {
+            return Key{}, err
+        }
+        return PublicKey(id, public)
+    default:
+        return Key{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+    }
+}
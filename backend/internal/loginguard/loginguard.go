@@ -0,0 +1,118 @@
+// Package loginguard throttles password sign-ins. Failures are recorded
+// under the email that was tried and the address they came from, so an
+// attacker is slowed down whether they try many passwords on one account or
+// one password on many. Emails are keyed whether or not an account uses
+// them, so being throttled says nothing about which accounts exist.
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+)
+
+type Guard struct {
+    store  repository.LoginAttemptStore
+    policy config.LoginThrottleConfig
+}
+
+func New(store repository.LoginAttemptStore, policy config.LoginThrottleConfig) *Guard {
+    return &Guard{store: store, policy: policy}
+}
+
+// AccountKey is the key failures against email count under. Case and
+// surrounding space are ignored, so variants of one address share a key.
+func AccountKey(email string) string {
+    return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+    return "ip:" + ip
+}
+
+// Begin lets a sign-in through unless it comes too soon after the last
+// failure for the account or the address, in which case it returns a
+// TooManyRequests error saying how long to wait. An attempt let through is
+// recorded as a failure at once, before its password is checked, so
+// attempts made in parallel count against each other; the caller passes
+// the returned id to Succeeded or Abandon if it turns out otherwise.
+// Refused attempts are not recorded, so waiting always helps.
+//
+// A key's failures are those within Lockout of its latest. Since nothing is
+// recorded while a key is locked, the latest failure is the one that
+// reached MaxFailures, and the lock lasts Lockout from it.
+func (g *Guard) Begin(ctx context.Context, email, ip string) (string, error) {
+    keys := []string{AccountKey(email), IPKey(ip)}
+    return g.store.Attempt(ctx, ip, keys, g.policy.Lockout, func(failures []models.LoginFailures) error {
+        account, addr := failures[0], failures[1]
+        if account.Count >= g.policy.MaxFailures && account.SinceLast < g.policy.Lockout {
+            return apperr.TooManyRequests("Too many failed sign-ins; the account is locked for a while", g.policy.Lockout-account.SinceLast).
+                WithCode(apperr.CodeAccountLocked)
+        }
+        if wait := g.backoff(account.Count) - account.SinceLast; wait > 0 {
+            return apperr.TooManyRequests("Too many failed sign-ins; try again shortly", wait)
+        }
+        if addr.Count >= g.policy.IPMaxFailures {
+            if wait := g.backoff(addr.Count-g.policy.IPMaxFailures+1) - addr.SinceLast; wait > 0 {
+                return apperr.TooManyRequests("Too many failed sign-ins; try again shortly", wait)
+            }
+        }
+        return nil
+    })
+}
+
+// backoff is how long the nth failure in a row makes the next attempt
+// wait: Backoff doubled for each failure before it, up to Lockout.
+func (g *Guard) backoff(n int) time.Duration {
+    if n <= 0 || g.policy.Backoff <= 0 {
+        return 0
+    }
+    wait := g.policy.Backoff
+    for i := 1; i < n && wait < g.policy.Lockout; i++ {
+        wait *= 2
+    }
+    return min(wait, g.policy.Lockout)
+}
+
+// Succeeded forgives the attempt and the account's earlier failures. The
+// address keeps its own, or signing in to one account would reset the
+// count for guessing others.
+func (g *Guard) Succeeded(ctx context.Context, email, attemptID string) error {
+    if err := g.store.Forgive(ctx, attemptID); err != nil {
+        return err
+    }
+    _, err := g.store.Clear(ctx, AccountKey(email))
+    return err
+}
+
+// Abandon forgives an attempt that failed for reasons of ours, such as the
+// database being unreachable, rather than a wrong password.
+func (g *Guard) Abandon(ctx context.Context, attemptID string) error {
+    return g.store.Forgive(ctx, attemptID)
+}
+
+// Unlock lifts the lock or backoff on an email, an address, or both, and
+// returns how many failures that forgave. Either may be empty.
+func (g *Guard) Unlock(ctx context.Context, email, ip string) (int, error) {
+    cleared := 0
+    if email != "" {
+        n, err := g.store.Clear(ctx, AccountKey(email))
+        if err != nil {
+            return cleared, err
+        }
+        cleared += n
+    }
+    if ip != "" {
+        n, err := g.store.Clear(ctx, IPKey(ip))
+        if err != nil {
+            return cleared, err
+        }
+        cleared += n
+    }
+    return cleared, nil
+}
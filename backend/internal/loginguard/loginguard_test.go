@@ -0,0 +1,311 @@
+package loginguard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/database"
+	"sunyi-api/internal/repository"
+	"sunyi-api/internal/repository/memory"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var policy = config.LoginThrottleConfig{
+	MaxFailures:   3,
+	Lockout:       10 * time.Minute,
+	Backoff:       time.Second,
+	IPMaxFailures: 5,
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		backoff  time.Duration
+		want     time.Duration
+	}{
+		{0, time.Second, 0},
+		{1, time.Second, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{4, time.Second, 8 * time.Second},
+		{10, time.Second, 8*time.Minute + 32*time.Second},
+		{11, time.Second, 10 * time.Minute},
+		{100, time.Second, 10 * time.Minute},
+		{3, 0, 0},
+	}
+	for _, tt := range tests {
+		g := New(nil, config.LoginThrottleConfig{Lockout: 10 * time.Minute, Backoff: tt.backoff})
+		if got := g.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) with Backoff %v = %v, want %v", tt.failures, tt.backoff, got, tt.want)
+		}
+	}
+}
+
+// step is one sign-in attempt in a scenario, made at offset from its start.
+// wait is the Retry-After it should be refused with, or 0 when it should be
+// let through; then says what becomes of an attempt let through, which by
+// default stays a failure.
+type step struct {
+	at     time.Duration
+	email  string
+	ip     string
+	wait   time.Duration
+	locked bool
+	then   string
+}
+
+const (
+	succeed = "succeed"
+	abandon = "abandon"
+)
+
+func TestBegin(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first attempt", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+		}},
+		{"backoff after a failure", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 400 * time.Millisecond, email: "a@example.com", ip: "2.2.2.2", wait: 600 * time.Millisecond},
+			{at: time.Second, email: "a@example.com", ip: "2.2.2.2"},
+		}},
+		{"backoff doubles", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: time.Second, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 2 * time.Second, email: "a@example.com", ip: "1.1.1.1", wait: time.Second},
+			{at: 3 * time.Second, email: "a@example.com", ip: "1.1.1.1"},
+		}},
+		{"email case and space are ignored", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 0, email: " A@Example.com", ip: "2.2.2.2", wait: time.Second},
+		}},
+		{"lockout after max failures", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: time.Second, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 3 * time.Second, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 3*time.Second + 4*time.Minute, email: "a@example.com", ip: "2.2.2.2", wait: 6 * time.Minute, locked: true},
+			{at: 3*time.Second + 10*time.Minute, email: "a@example.com", ip: "2.2.2.2"},
+		}},
+		{"failures further apart than the lockout do not add up", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 11 * time.Minute, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 22 * time.Minute, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 22*time.Minute + time.Second, email: "a@example.com", ip: "1.1.1.1"},
+		}},
+		{"success forgives the account", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: time.Second, email: "a@example.com", ip: "1.1.1.1", then: succeed},
+			{at: time.Second, email: "a@example.com", ip: "1.1.1.1"},
+		}},
+		{"abandoned attempts do not count", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1", then: abandon},
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+		}},
+		{"address backs off across accounts", []step{
+			{at: 0, email: "a@example.com", ip: "1.1.1.1"},
+			{at: 0, email: "b@example.com", ip: "1.1.1.1"},
+			{at: 0, email: "c@example.com", ip: "1.1.1.1"},
+			{at: 0, email: "d@example.com", ip: "1.1.1.1"},
+			{at: 0, email: "e@example.com", ip: "1.1.1.1"},
+			{at: 0, email: "f@example.com", ip: "1.1.1.1", wait: time.Second},
+			{at: 0, email: "f@example.com", ip: "2.2.2.2"},
+			{at: time.Second, email: "g@example.com", ip: "1.1.1.1"},
+			{at: time.Second, email: "h@example.com", ip: "1.1.1.1", wait: 2 * time.Second},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			now := start
+			store.SetClock(func() time.Time { return now })
+			g := New(store.LoginAttempts, policy)
+
+			for i, s := range tt.steps {
+				now = start.Add(s.at)
+				attemptID, err := g.Begin(context.Background(), s.email, s.ip)
+				if s.wait == 0 {
+					if err != nil {
+						t.Fatalf("step %d: %v, want it let through", i, err)
+					}
+				} else {
+					checkRefused(t, i, err, s.wait, s.locked)
+					continue
+				}
+
+				switch s.then {
+				case succeed:
+					err = g.Succeeded(context.Background(), s.email, attemptID)
+				case abandon:
+					err = g.Abandon(context.Background(), attemptID)
+				}
+				if err != nil {
+					t.Fatalf("step %d: %s: %v", i, s.then, err)
+				}
+			}
+		})
+	}
+}
+
+func checkRefused(t *testing.T, step int, err error, wait time.Duration, locked bool) {
+	t.Helper()
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) || !errors.Is(err, apperr.ErrTooManyRequests) {
+		t.Fatalf("step %d: got %v, want a TooManyRequests error", step, err)
+	}
+	if appErr.RetryAfter != wait {
+		t.Fatalf("step %d: retry after %v, want %v", step, appErr.RetryAfter, wait)
+	}
+	if (appErr.Code == apperr.CodeAccountLocked) != locked {
+		t.Fatalf("step %d: code %q, locked is %v", step, appErr.Code, locked)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	store := memory.New()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+	g := New(store.LoginAttempts, policy)
+	ctx := context.Background()
+
+	for i := 0; i < policy.MaxFailures; i++ {
+		if _, err := g.Begin(ctx, "a@example.com", "1.1.1.1"); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+		now = now.Add(time.Minute)
+	}
+	_, err := g.Begin(ctx, "a@example.com", "2.2.2.2")
+	checkRefused(t, 0, err, policy.Lockout-time.Minute, true)
+
+	cleared, err := g.Unlock(ctx, "A@example.com", "")
+	if err != nil || cleared != policy.MaxFailures {
+		t.Fatalf("unlock cleared %d (%v), want %d", cleared, err, policy.MaxFailures)
+	}
+	if _, err := g.Begin(ctx, "a@example.com", "2.2.2.2"); err != nil {
+		t.Fatalf("after unlock: %v", err)
+	}
+	// The address keeps its failures.
+	if cleared, err := g.Unlock(ctx, "", "1.1.1.1"); err != nil || cleared != policy.MaxFailures {
+		t.Fatalf("unlocking the address cleared %d (%v), want %d", cleared, err, policy.MaxFailures)
+	}
+}
+
+func TestOldAttemptsArePruned(t *testing.T) {
+	store := memory.New()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+	g := New(store.LoginAttempts, policy)
+	ctx := context.Background()
+
+	if _, err := g.Begin(ctx, "made-up@example.com", "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2*policy.Lockout + time.Minute)
+	if _, err := g.Begin(ctx, "a@example.com", "2.2.2.2"); err != nil {
+		t.Fatal(err)
+	}
+	if cleared, err := g.Unlock(ctx, "made-up@example.com", "1.1.1.1"); err != nil || cleared != 0 {
+		t.Fatalf("%d old attempts left (%v), want them pruned", cleared, err)
+	}
+	if cleared, err := g.Unlock(ctx, "a@example.com", ""); err != nil || cleared != 1 {
+		t.Fatalf("%d recent attempts left (%v), want 1", cleared, err)
+	}
+}
+
+// TestConcurrentFailures checks that attempts made at once are decided one
+// after another: only MaxFailures of them get through before the lock.
+func TestConcurrentFailures(t *testing.T) {
+	noBackoff := policy
+	noBackoff.Backoff = 0
+	noBackoff.IPMaxFailures = 1000
+
+	stores := map[string]repository.LoginAttemptStore{"memory": memory.NewLoginAttemptStore()}
+	if db := testDB(t); db != nil {
+		stores["postgres"] = repository.NewLoginAttemptRepository(db, 5*time.Second)
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			g := New(store, noBackoff)
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				through int
+			)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := g.Begin(context.Background(), "a@example.com", "1.1.1.1")
+					if err == nil {
+						mu.Lock()
+						through++
+						mu.Unlock()
+					} else if !errors.Is(err, apperr.ErrTooManyRequests) {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if through != noBackoff.MaxFailures {
+				t.Fatalf("%d attempts got through, want %d", through, noBackoff.MaxFailures)
+			}
+		})
+	}
+}
+
+// testDB returns a migrated schema of the Postgres database named by
+// TEST_DATABASE_URL, dropped when the test ends, or nil when it is unset.
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		return nil
+	}
+
+	admin, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "loginguard_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema+",public")
+	u.RawQuery = query.Encode()
+	db, err := sqlx.Connect("postgres", u.String())
+	if err != nil {
+		t.Fatalf("connect to %s: %v", schema, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes each message as an .eml file under a directory, where
+// it can be opened with any mail client during development.
+type FileMailer struct {
+    from string
+    dir  string
+    now  func() time.Time
+}
+
+func NewFileMailer(from, dir string) *FileMailer {
+    return &FileMailer{from: from, dir: dir, now: time.Now}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    if err := os.MkdirAll(m.dir, 0o755); err != nil {
+        return err
+    }
+
+    now := m.now()
+    file, err := os.CreateTemp(m.dir, now.UTC().Format("20060102T150405")+"-*.eml")
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    if _, err := file.Write(compose(m.from, msg, now)); err != nil {
+        return fmt.Errorf("write %s: %w", filepath.Base(file.Name()), err)
+    }
+    return file.Close()
+}
@@ -0,0 +1,36 @@
+// Package mail sends the emails the API writes, such as address
+// verification links, behind the Mailer interface: over SMTP in production,
+// and to files or memory in development and tests.
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"sunyi-api/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer cfg.Backend names.
+func New(cfg config.MailConfig) (Mailer, error) {
+    switch cfg.Backend {
+    case "smtp":
+        return NewSMTPMailer(cfg.From, cfg.SMTP), nil
+    case "file":
+        return NewFileMailer(cfg.From, cfg.Dir), nil
+    case "memory":
+        return NewMemoryMailer(), nil
+    default:
+        return nil, fmt.Errorf("unknown mail backend %q", cfg.Backend)
+    }
+}
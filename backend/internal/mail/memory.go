@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryMailer keeps sent messages for tests to read back.
+type MemoryMailer struct {
+    mu       sync.Mutex
+    messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+    return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.messages = append(m.messages, msg)
+    return nil
+}
+
+// Sent returns the messages sent to the address, oldest first.
+func (m *MemoryMailer) Sent(to string) []Message {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var sent []Message
+    for _, msg := range m.messages {
+        if msg.To == to {
+            sent = append(sent, msg)
+        }
+    }
+    return sent
+}
@@ -0,0 +1,122 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"sunyi-api/config"
+)
+
+// SMTPMailer delivers through an SMTP server, upgrading to TLS with
+// STARTTLS when the server offers it and authenticating with PLAIN when a
+// username is set.
+type SMTPMailer struct {
+    from string
+    cfg  config.SMTPConfig
+}
+
+func NewSMTPMailer(from string, cfg config.SMTPConfig) *SMTPMailer {
+    return &SMTPMailer{from: from, cfg: cfg}
+}
+
+// Send dials per message; the API sends too little mail to keep a
+// connection open. The context bounds the whole exchange.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+    addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(ctx, "tcp", addr)
+    if err != nil {
+        return fmt.Errorf("smtp dial %s: %w", addr, err)
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+
+    client, err := smtp.NewClient(conn, m.cfg.Host)
+    if err != nil {
+        conn.Close()
+        return fmt.Errorf("smtp %s: %w", addr, err)
+    }
+    defer client.Close()
+
+    if ok, _ := client.Extension("STARTTLS"); ok {
+        if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host, MinVersion: tls.VersionTLS12}); err != nil {
+            return fmt.Errorf("smtp starttls: %w", err)
+        }
+    }
+    if m.cfg.Username != "" {
+        auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+        if err := client.Auth(auth); err != nil {
+            return fmt.Errorf("smtp auth: %w", err)
+        }
+    }
+
+    from, err := mail.ParseAddress(m.from)
+    if err != nil {
+        return fmt.Errorf("smtp from address: %w", err)
+    }
+    if err := client.Mail(from.Address); err != nil {
+        return fmt.Errorf("smtp MAIL FROM: %w", err)
+    }
+    if err := client.Rcpt(msg.To); err != nil {
+        return fmt.Errorf("smtp RCPT TO: %w", err)
+    }
+    w, err := client.Data()
+    if err != nil {
+        return fmt.Errorf("smtp DATA: %w", err)
+    }
+    if _, err := w.Write(compose(m.from, msg, time.Now())); err != nil {
+        return fmt.Errorf("smtp DATA: %w", err)
+    }
+    if err := w.Close(); err != nil {
+        return fmt.Errorf("smtp DATA: %w", err)
+    }
+    return client.Quit()
+}
+
+// compose renders msg as an RFC 5322 message with CRLF line endings.
+func compose(from string, msg Message, now time.Time) []byte {
+    var b bytes.Buffer
+    header := func(name, value string) {
+        b.WriteString(name + ": " + value + "\r\n")
+    }
+    header("From", from)
+    // Addresses come from validated input, but a line break in one must
+    // never be able to add headers.
+    header("To", strings.NewReplacer("\r", "", "\n", "").Replace(msg.To))
+    header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+    header("Date", now.Format(time.RFC1123Z))
+    header("Message-ID", messageID(from))
+    header("MIME-Version", "1.0")
+    header("Content-Type", "text/plain; charset=utf-8")
+    header("Content-Transfer-Encoding", "8bit")
+    b.WriteString("\r\n")
+
+    body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+    for _, line := range strings.Split(body, "\n") {
+        b.WriteString(line + "\r\n")
+    }
+    return b.Bytes()
+}
+
+func messageID(from string) string {
+    domain := "localhost"
+    if addr, err := mail.ParseAddress(from); err == nil {
+        if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+            domain = addr.Address[at+1:]
+        }
+    }
+    var b [12]byte
+    rand.Read(b[:])
+    return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">"
+}
@@ -0,0 +1,114 @@
+// Package mergepatch implements JSON Merge Patch (RFC 7396) for flat
+// resource documents, and the field-level diff used to report what a patch
+// changed.
+package mergepatch
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "reflect"
+    "sort"
+)
+
+// ContentType is the media type of a merge patch request body.
+const ContentType = "application/merge-patch+json"
+
+var ErrNotObject = errors.New("merge patch must be a JSON object")
+
+// Change is one top-level field whose value differs between two documents.
+// From or To is nil when the field was null or absent on that side.
+type Change struct {
+    Field string      `json:"field"`
+    From  interface{} `json:"from"`
+    To    interface{} `json:"to"`
+}
+
+// Document is a decoded JSON object. Numbers are kept as json.Number so a
+// round trip does not lose precision.
+type Document map[string]interface{}
+
+// Decode parses a JSON object.
+func Decode(data []byte) (Document, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+    var v interface{}
+    if err := dec.Decode(&v); err != nil {
+        return nil, err
+    }
+    doc, ok := v.(map[string]interface{})
+    if !ok {
+        return nil, ErrNotObject
+    }
+    return doc, nil
+}
+
+// FromValue encodes v, which must marshal to a JSON object, as a Document.
+func FromValue(v interface{}) (Document, error) {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return Decode(data)
+}
+
+// Apply merges patch into a copy of doc as RFC 7396 describes: a null
+// removes the member, an object is merged recursively, and anything else
+// replaces the member.
+func Apply(doc, patch Document) Document {
+    return merge(map[string]interface{}(doc), map[string]interface{}(patch))
+}
+
+func merge(target, patch map[string]interface{}) map[string]interface{} {
+    out := make(map[string]interface{}, len(target))
+    for k, v := range target {
+        out[k] = v
+    }
+    for k, v := range patch {
+        switch pv := v.(type) {
+        case nil:
+            delete(out, k)
+        case map[string]interface{}:
+            tv, _ := out[k].(map[string]interface{})
+            out[k] = merge(tv, pv)
+        default:
+            out[k] = v
+        }
+    }
+    return out
+}
+
+// Into decodes doc into v, rejecting members v has no field for.
+func (doc Document) Into(v interface{}) error {
+    data, err := json.Marshal(doc)
+    if err != nil {
+        return err
+    }
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    return dec.Decode(v)
+}
+
+// Diff lists the top-level fields whose values differ, sorted by name. An
+// absent member and an explicit null are treated alike.
+func Diff(before, after Document) []Change {
+    fields := map[string]bool{}
+    for k := range before {
+        fields[k] = true
+    }
+    for k := range after {
+        fields[k] = true
+    }
+
+    changes := []Change{}
+    for field := range fields {
+        from, to := before[field], after[field]
+        if !reflect.DeepEqual(from, to) {
+            changes = append(changes, Change{Field: field, From: from, To: to})
+        }
+    }
+    sort.Slice(changes, func(i, j int) bool {
+        return changes[i].Field < changes[j].Field
+    })
+    return changes
+}
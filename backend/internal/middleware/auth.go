@@ -1,8 +1,11 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
+	"errors"
 	"strings"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/jwtkeys"
 	"sunyi-api/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -10,72 +13,157 @@ import (
 )
 
 type Claims struct {
-    UserID string           `json:"user_id"`
-    Email  string           `json:"email"`
-    Role   models.UserRole  `json:"role"`
+    UserID        string          `json:"user_id"`
+    Email         string          `json:"email"`
+    Role          models.UserRole `json:"role"`
+    // EmailVerified is as of when the token was issued; refreshing picks
+    // up a verification made since.
+    EmailVerified bool            `json:"email_verified"`
+    // SessionID names the session the token was issued for. Tokens from
+    // before sessions existed have none and are refused.
+    SessionID     string          `json:"sid"`
     jwt.RegisteredClaims
 }
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// SessionChecker tells whether a session is still live.
+// repository.SessionStore satisfies it.
+type SessionChecker interface {
+    Active(ctx context.Context, id string) (bool, error)
+}
+
+// AuthMiddleware requires a valid access token whose session has not been
+// revoked.
+func AuthMiddleware(keys *jwtkeys.Keyring, sessions SessionChecker) gin.HandlerFunc {
     return func(c *gin.Context) {
         authHeader := c.GetHeader("Authorization")
         if authHeader == "" {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+            c.Error(apperr.Unauthorized("Authorization header required"))
             c.Abort()
             return
         }
 
-        // Extract token from "Bearer <token>"
-        parts := strings.Split(authHeader, " ")
-        if len(parts) != 2 || parts[0] != "Bearer" {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+        claims, err := parseBearer(authHeader, keys)
+        if err == nil {
+            err = checkSession(c.Request.Context(), sessions, claims)
+        }
+        if err != nil {
+            c.Error(err)
             c.Abort()
             return
         }
 
-        tokenString := parts[1]
+        setClaims(c, claims)
+        c.Next()
+    }
+}
 
-        // Parse and validate token
-        token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-            return []byte(jwtSecret), nil
-        })
+// OptionalAuth identifies the caller when a valid token is sent and lets the
+// request through anonymously otherwise, so public endpoints can show extra
+// data, such as drafts, to their owner. A bad or expired token is ignored
+// rather than rejected, and so is one whose session was revoked.
+func OptionalAuth(keys *jwtkeys.Keyring, sessions SessionChecker) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+            if claims, err := parseBearer(authHeader, keys); err == nil {
+                err = checkSession(c.Request.Context(), sessions, claims)
+                if err != nil && !errors.Is(err, apperr.ErrUnauthorized) {
+                    c.Error(err)
+                    c.Abort()
+                    return
+                }
+                if err == nil {
+                    setClaims(c, claims)
+                }
+            }
+        }
+        c.Next()
+    }
+}
+
+func parseBearer(authHeader string, keys *jwtkeys.Keyring) (*Claims, error) {
+    // Extract token from "Bearer <token>"
+    parts := strings.Split(authHeader, " ")
+    if len(parts) != 2 || parts[0] != "Bearer" {
+        return nil, apperr.Unauthorized("Invalid authorization header format")
+    }
 
-        if err != nil || !token.Valid {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+    tokenString := parts[1]
+
+    // Parse and validate token
+    claims := &Claims{}
+    if err := keys.Parse(tokenString, claims); err != nil {
+        return nil, apperr.Unauthorized("Invalid or expired token")
+    }
+
+    return claims, nil
+}
+
+// checkSession refuses a token whose session was revoked or has expired.
+// It costs a lookup per request, which is what lets logging out take
+// effect before the token itself expires.
+func checkSession(ctx context.Context, sessions SessionChecker, claims *Claims) error {
+    if claims.SessionID == "" {
+        return apperr.Unauthorized("Invalid or expired token")
+    }
+    active, err := sessions.Active(ctx, claims.SessionID)
+    if err != nil {
+        return err
+    }
+    if !active {
+        return apperr.Unauthorized("Session has expired or was revoked").WithCode(apperr.CodeSessionEnded)
+    }
+    return nil
+}
+
+// setClaims stores the caller's identity in the context.
+func setClaims(c *gin.Context, claims *Claims) {
+    c.Set("user_id", claims.UserID)
+    c.Set("session_id", claims.SessionID)
+    c.Set("user_email", claims.Email)
+    c.Set("user_role", claims.Role)
+    c.Set("email_verified", claims.EmailVerified)
+}
+
+// AdminOnly admits admins.
+func AdminOnly() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        role, exists := c.Get("user_role")
+        if !exists {
+            c.Error(apperr.Unauthorized("User not authenticated"))
             c.Abort()
             return
         }
 
-        // Extract claims
-        claims, ok := token.Claims.(*Claims)
-        if !ok {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+        if userRole, ok := role.(models.UserRole); !ok || userRole != models.RoleAdmin {
+            c.Error(apperr.Forbidden("Only admins can perform this action"))
             c.Abort()
             return
         }
 
-        // Set user info in context
-        c.Set("user_id", claims.UserID)
-        c.Set("user_email", claims.Email)
-        c.Set("user_role", claims.Role)
-
         c.Next()
     }
 }
 
-// Optional: Middleware to check if user is an organizer
-func OrganizerOnly() gin.HandlerFunc {
+// OrganizerOnly admits organizers and, when requireVerifiedEmail is set,
+// only those who have verified their email address.
+func OrganizerOnly(requireVerifiedEmail bool) gin.HandlerFunc {
     return func(c *gin.Context) {
         role, exists := c.Get("user_role")
         if !exists {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+            c.Error(apperr.Unauthorized("User not authenticated"))
             c.Abort()
             return
         }
 
         userRole, ok := role.(models.UserRole)
         if !ok || userRole != models.RoleOrganizer {
-            c.JSON(http.StatusForbidden, gin.H{"error": "Only organizers can perform this action"})
+            c.Error(apperr.Forbidden("Only organizers can perform this action"))
+            c.Abort()
+            return
+        }
+
+        if requireVerifiedEmail && !c.GetBool("email_verified") {
+            c.Error(apperr.Forbidden("Verify your email address to perform this action").WithCode(apperr.CodeEmailUnverified))
             c.Abort()
             return
         }
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sunyi-api/internal/apperr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// StatusClientClosedRequest is the non-standard status nginx uses when the
+// client went away before a response was written.
+const StatusClientClosedRequest = 499
+
+// ErrorResponse is the body of every failed request. Error stays a plain
+// message for existing clients; Code is stable for programs to branch on.
+type ErrorResponse struct {
+    Error  string            `json:"error"`
+    Code   string            `json:"code"`
+    Field  string            `json:"field,omitempty"`
+    Fields map[string]string `json:"fields,omitempty"`
+}
+
+// ErrorHandler turns the last error a handler attached with c.Error into a
+// response. Handlers and middleware report failures that way instead of
+// writing their own error bodies.
+func ErrorHandler() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Next()
+
+        if len(c.Errors) == 0 || c.Writer.Written() {
+            return
+        }
+
+        last := c.Errors.Last()
+        status, body := describeError(c, last)
+        if status == http.StatusInternalServerError {
+            log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, last.Err)
+        }
+        c.AbortWithStatusJSON(status, body)
+    }
+}
+
+func describeError(c *gin.Context, ginErr *gin.Error) (int, ErrorResponse) {
+    err := ginErr.Err
+
+    if ginErr.IsType(gin.ErrorTypeBind) {
+        return http.StatusBadRequest, bindingError(err)
+    }
+
+    var appErr *apperr.Error
+    if errors.As(err, &appErr) {
+        if appErr.RetryAfter > 0 {
+            c.Header("Retry-After", strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+        }
+        return statusFor(appErr.Kind), ErrorResponse{
+            Error:  appErr.Message,
+            Code:   appErr.Code,
+            Field:  appErr.Field,
+            Fields: appErr.Fields,
+        }
+    }
+
+    switch {
+    case errors.Is(err, context.Canceled) || c.Request.Context().Err() != nil:
+        return StatusClientClosedRequest, ErrorResponse{Error: "Request canceled", Code: apperr.CodeCanceled}
+    case errors.Is(err, context.DeadlineExceeded):
+        return http.StatusServiceUnavailable, ErrorResponse{Error: "Request timed out", Code: apperr.CodeTimeout}
+    }
+
+    return http.StatusInternalServerError, ErrorResponse{Error: "Internal server error", Code: apperr.CodeInternal}
+}
+
+func statusFor(kind error) int {
+    switch kind {
+    case apperr.ErrNotFound:
+        return http.StatusNotFound
+    case apperr.ErrConflict:
+        return http.StatusConflict
+    case apperr.ErrValidation:
+        return http.StatusBadRequest
+    case apperr.ErrForbidden:
+        return http.StatusForbidden
+    case apperr.ErrUnauthorized:
+        return http.StatusUnauthorized
+    case apperr.ErrTooLarge:
+        return http.StatusRequestEntityTooLarge
+    case apperr.ErrUnsupported:
+        return http.StatusUnsupportedMediaType
+    case apperr.ErrPrecondition:
+        return http.StatusPreconditionFailed
+    case apperr.ErrPreconditionRequired:
+        return http.StatusPreconditionRequired
+    case apperr.ErrTooManyRequests:
+        return http.StatusTooManyRequests
+    }
+    return http.StatusInternalServerError
+}
+
+// bindingError reports which request fields failed which validation rules.
+// Field names are the json/form names once RegisterValidatorTagNames ran.
+func bindingError(err error) ErrorResponse {
+    resp := ErrorResponse{Error: "Invalid request", Code: apperr.CodeValidation}
+
+    var verrs validator.ValidationErrors
+    if !errors.As(err, &verrs) {
+        resp.Error = err.Error()
+        return resp
+    }
+
+    resp.Fields = make(map[string]string, len(verrs))
+    for _, fe := range verrs {
+        rule := fe.Tag()
+        if fe.Param() != "" {
+            rule += "=" + fe.Param()
+        }
+        resp.Fields[fe.Field()] = rule
+    }
+    if len(verrs) == 1 {
+        resp.Field = verrs[0].Field()
+        resp.Error = "Invalid " + verrs[0].Field()
+    }
+    return resp
+}
+
+// RegisterValidatorTagNames makes validation errors name fields by their
+// json or form tag rather than the Go field name.
+func RegisterValidatorTagNames(v *validator.Validate) {
+    v.RegisterTagNameFunc(func(field reflect.StructField) string {
+        for _, tag := range []string{"json", "form"} {
+            name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+            if name != "" && name != "-" {
+                return name
+            }
+        }
+        return field.Name
+    })
+}
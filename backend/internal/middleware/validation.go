@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"sunyi-api/internal/storage"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// RegisterValidations adds the validation rules the request models use
+// beyond the validator's own.
+func RegisterValidations(v *validator.Validate) {
+    v.RegisterValidation("image_url", validImageURL)
+}
+
+// validImageURL accepts an absolute http(s) URL, such as an S3 upload's, or
+// a path under the local uploads directory, which is what uploads return
+// when they are served by the API itself.
+func validImageURL(fl validator.FieldLevel) bool {
+    raw := fl.Field().String()
+    u, err := url.Parse(raw)
+    if err != nil {
+        return false
+    }
+    if u.Scheme == "http" || u.Scheme == "https" {
+        return u.Host != ""
+    }
+    if u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, storage.LocalURLPrefix+"/") {
+        return false
+    }
+    for _, segment := range strings.Split(u.Path, "/") {
+        if segment == ".." {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+    "time"
+)
+
+type Artist struct {
+    ID        string    `json:"id" db:"id"`
+    Name      string    `json:"name" db:"name"`
+    Bio       *string   `json:"bio" db:"bio"`
+    // CreatedBy is the organizer who added the artist and may edit it. It
+    // is nil once their account is deleted.
+    CreatedBy *string   `json:"created_by" db:"created_by"`
+    CreatedAt time.Time `json:"created_at" db:"created_at"`
+    UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type ArtistInput struct {
+    Name string  `json:"name" binding:"required,max=200"`
+    Bio  *string `json:"bio" binding:"omitempty,max=2000"`
+}
+
+// ArtistFilter searches artists by a name fragment. An exact name match
+// comes first, the rest by name.
+type ArtistFilter struct {
+    Query string `form:"q" binding:"omitempty,max=200"`
+    Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// MaxLineupSize bounds how many artists a gig can bill.
+const MaxLineupSize = 50
+
+// LineupSlot is one artist on a gig's bill. Position 1 tops the bill; set
+// times are optional and, like the gig's, shown in its timezone.
+type LineupSlot struct {
+    GigID       string     `json:"-" db:"gig_id"`
+    ArtistID    string     `json:"artist_id" db:"artist_id"`
+    ArtistName  string     `json:"artist_name" db:"artist_name"`
+    Position    int        `json:"position" db:"position"`
+    SetStartsAt *time.Time `json:"set_starts_at" db:"set_starts_at"`
+    SetEndsAt   *time.Time `json:"set_ends_at" db:"set_ends_at"`
+}
+
+// LineupSlotInput is a lineup entry as organizers send it. The billing
+// order is the order of the lineup array; set times are local wall-clock
+// values in the gig's timezone.
+type LineupSlotInput struct {
+    ArtistID    string  `json:"artist_id" binding:"required,uuid"`
+    SetStartsAt *string `json:"set_starts_at"`
+    SetEndsAt   *string `json:"set_ends_at"`
+}
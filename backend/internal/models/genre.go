@@ -0,0 +1,33 @@
+package models
+
+import (
+    "strings"
+    "unicode"
+)
+
+// Genre is a canonical genre. Gigs are tagged with slugs; any alias or
+// spelling of the name resolves to one, so "Hip Hop", "hip-hop" and
+// "hiphop" are the same genre.
+type Genre struct {
+    Slug         string  `json:"slug" db:"slug"`
+    Name         string  `json:"name" db:"name"`
+    // Parent is the broader genre this one belongs to, such as rock for
+    // shoegaze. Filtering by a genre includes its sub-genres.
+    Parent       *string `json:"parent" db:"parent_slug"`
+    // UpcomingGigs counts the public gigs yet to happen tagged with the
+    // genre or any of its sub-genres.
+    UpcomingGigs int     `json:"upcoming_gigs" db:"upcoming_gigs"`
+}
+
+// GenreKey reduces a genre name or alias to the form they are matched in:
+// lower case, "&" read as "and", everything but letters and digits dropped.
+// The genres migration applies the same rules in SQL.
+func GenreKey(name string) string {
+    name = strings.ReplaceAll(strings.ToLower(name), "&", "and")
+    return strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return -1
+    }, name)
+}
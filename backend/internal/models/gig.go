@@ -5,6 +5,7 @@ import (
     "database/sql/driver"
     "encoding/json"
     "errors"
+    "sunyi-api/internal/mergepatch"
 )
 
 type StringArray []string
@@ -30,36 +31,186 @@ func (s StringArray) Value() (driver.Value, error) {
     return json.Marshal(s)
 }
 
+// ImageVariants maps a resized copy's name, such as "small", to its URL.
+type ImageVariants map[string]string
+
+func (v *ImageVariants) Scan(value interface{}) error {
+    if value == nil {
+        *v = nil
+        return nil
+    }
+
+    bytes, ok := value.([]byte)
+    if !ok {
+        return errors.New("failed to scan ImageVariants")
+    }
+
+    return json.Unmarshal(bytes, v)
+}
+
+func (v ImageVariants) Value() (driver.Value, error) {
+    if len(v) == 0 {
+        return nil, nil
+    }
+    return json.Marshal(v)
+}
+
 type Gig struct {
-    ID           string       `json:"id" db:"id"`
-    Title        string       `json:"title" db:"title"`
-    Description  string       `json:"description" db:"description"`
-    VenueName    string       `json:"venue_name" db:"venue_name"`
-    VenueAddress string       `json:"venue_address" db:"venue_address"`
-    Latitude     float64      `json:"latitude" db:"latitude"`
-    Longitude    float64      `json:"longitude" db:"longitude"`
-    Date         string       `json:"date" db:"date"`
-    StartTime    string       `json:"start_time" db:"start_time"`
-    EndTime      *string      `json:"end_time" db:"end_time"`
-    Price        *float64     `json:"price" db:"price"`
-    ImageURL     *string      `json:"image_url" db:"image_url"`
-    OrganizerID  string       `json:"organizer_id" db:"organizer_id"`
-    Genres       StringArray  `json:"genres" db:"genres"`
-    CreatedAt    time.Time    `json:"created_at" db:"created_at"`
-    UpdatedAt    time.Time    `json:"updated_at" db:"updated_at"`
-    Organizer    *User        `json:"organizer,omitempty" db:"-"`
+    ID              string        `json:"id" db:"id"`
+    Title           string        `json:"title" db:"title"`
+    Description     string        `json:"description" db:"description"`
+    // VenueID is the gig's venue. The venue fields that follow are read
+    // from it and are not written with the gig.
+    VenueID         string        `json:"venue_id" db:"venue_id"`
+    VenueName       string        `json:"venue_name" db:"venue_name"`
+    VenueAddress    string        `json:"venue_address" db:"venue_address"`
+    Latitude        float64       `json:"latitude" db:"latitude"`
+    Longitude       float64       `json:"longitude" db:"longitude"`
+    StartsAt        time.Time     `json:"starts_at" db:"starts_at"`
+    EndsAt          *time.Time    `json:"ends_at" db:"ends_at"`
+    Timezone        string        `json:"timezone" db:"timezone"`
+    Price           *float64      `json:"price" db:"price"`
+    ImageURL        *string       `json:"image_url" db:"image_url"`
+    // ImageThumbnails are downscaled copies of the image, keyed by size.
+    ImageThumbnails ImageVariants `json:"image_thumbnails" db:"image_thumbnails"`
+    OrganizerID     string        `json:"organizer_id" db:"organizer_id"`
+    // Genres are canonical genre slugs.
+    Genres          StringArray   `json:"genres" db:"-"`
+    Status          GigStatus     `json:"status" db:"status"`
+    // StatusReason is the organizer's note for a cancellation, postponement
+    // or move, shown alongside the status.
+    StatusReason    *string       `json:"status_reason" db:"status_reason"`
+    StatusChangedAt *time.Time    `json:"status_changed_at" db:"status_changed_at"`
+    RescheduledFrom *time.Time    `json:"rescheduled_from" db:"rescheduled_from"`
+    // Version increases with every write; it is the gig's ETag.
+    Version         int           `json:"version" db:"version"`
+    CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+    UpdatedAt       time.Time     `json:"updated_at" db:"updated_at"`
+    Organizer       *PublicUser   `json:"organizer,omitempty" db:"-"`
+    // Lineup is the bill in order, headliner first.
+    Lineup          []LineupSlot  `json:"lineup" db:"-"`
+    DistanceKm      *float64      `json:"distance_km,omitempty" db:"distance_km"`
+}
+
+// GigInput holds the organizer-editable fields of a gig. It is the body of
+// PUT and the document a merge patch applies to.
+//
+// VenueID is checked by the handler rather than tagged required, since a
+// new gig may name its venue inline instead.
+type GigInput struct {
+    Title       string            `json:"title" binding:"required"`
+    Description string            `json:"description" binding:"required"`
+    VenueID     string            `json:"venue_id" binding:"omitempty,uuid"`
+    StartsAt    string            `json:"starts_at" binding:"required"`
+    EndsAt      *string           `json:"ends_at"`
+    Timezone    string            `json:"timezone" binding:"required,timezone"`
+    Price       *float64          `json:"price"`
+    Genres      []string          `json:"genres"`
+    Lineup      []LineupSlotInput `json:"lineup" binding:"omitempty,max=50,dive"`
 }
 
 type CreateGigInput struct {
-    Title        string    `json:"title" binding:"required"`
-    Description  string    `json:"description" binding:"required"`
-    VenueName    string    `json:"venue_name" binding:"required"`
-    VenueAddress string    `json:"venue_address" binding:"required"`
-    Latitude     float64   `json:"latitude" binding:"required,min=-90,max=90"`
-    Longitude    float64   `json:"longitude" binding:"required,min=-180,max=180"`
-    Date         string    `json:"date" binding:"required"`
-    StartTime    string    `json:"start_time" binding:"required"`
-    EndTime      *string   `json:"end_time"`
-    Price        *float64  `json:"price"`
-    Genres       []string  `json:"genres"`
-}
\ No newline at end of file
+    GigInput
+    // Venue describes the venue when VenueID is not given. It is matched
+    // against nearby venues with a similar name before a new one is added.
+    Venue  *VenueInput `json:"venue"`
+    // Status is draft unless the gig is published straight away.
+    Status GigStatus   `json:"status" binding:"omitempty,oneof=draft published"`
+}
+
+// GigPatchResponse is the gig after a merge patch and the fields it changed,
+// in GigInput form.
+type GigPatchResponse struct {
+    Gig     *Gig                `json:"gig"`
+    Changes []mergepatch.Change `json:"changes"`
+}
+
+// SetVenue copies the venue's details onto the gig.
+func (g *Gig) SetVenue(venue *Venue) {
+    g.VenueID = venue.ID
+    g.VenueName = venue.Name
+    g.VenueAddress = venue.Address
+    g.Latitude = venue.Latitude
+    g.Longitude = venue.Longitude
+}
+
+// Input returns the gig's editable fields, with times as local wall-clock
+// values in its timezone.
+func (g *Gig) Input() GigInput {
+    loc := g.Location()
+    input := GigInput{
+        Title:       g.Title,
+        Description: g.Description,
+        VenueID:     g.VenueID,
+        StartsAt:    g.StartsAt.In(loc).Format(LocalDateTimeLayout + ":05"),
+        Timezone:    g.Timezone,
+        Price:       g.Price,
+        Genres:      append([]string{}, g.Genres...),
+        Lineup:      []LineupSlotInput{},
+    }
+    for _, slot := range g.Lineup {
+        input.Lineup = append(input.Lineup, LineupSlotInput{
+            ArtistID:    slot.ArtistID,
+            SetStartsAt: formatLocal(slot.SetStartsAt, loc),
+            SetEndsAt:   formatLocal(slot.SetEndsAt, loc),
+        })
+    }
+    if g.EndsAt != nil {
+        endsAt := g.EndsAt.In(loc).Format(LocalDateTimeLayout + ":05")
+        input.EndsAt = &endsAt
+    }
+    return input
+}
+
+type GigFilter struct {
+    DateFrom    string    `form:"date_from" binding:"omitempty,datetime=2006-01-02"`
+    DateTo      string    `form:"date_to" binding:"omitempty,datetime=2006-01-02"`
+    Genre       string    `form:"genre"`
+    PriceMin    *float64  `form:"price_min" binding:"omitempty,min=0"`
+    PriceMax    *float64  `form:"price_max" binding:"omitempty,min=0"`
+    OrganizerID string    `form:"organizer_id" binding:"omitempty,uuid"`
+    VenueID     string    `form:"venue_id" binding:"omitempty,uuid"`
+    ArtistID    string    `form:"artist_id" binding:"omitempty,uuid"`
+    // Artist matches gigs billing an artist whose name contains it,
+    // ignoring case.
+    Artist      string    `form:"artist" binding:"omitempty,max=200"`
+    Status      GigStatus `form:"status" binding:"omitempty,oneof=draft published cancelled postponed rescheduled"`
+    Upcoming    bool      `form:"upcoming"`
+    Cursor      string    `form:"cursor"`
+    Limit       int       `form:"limit" binding:"omitempty,min=1,max=100"`
+    // ViewerID is the authenticated caller, whose own drafts are included.
+    // Everyone else's drafts never are.
+    ViewerID    string    `form:"-"`
+}
+
+type GigListResponse struct {
+    Data       []Gig   `json:"data"`
+    NextCursor *string `json:"next_cursor"`
+    Total      int     `json:"total"`
+}
+
+const (
+    NearbySortDistance = "distance"
+    NearbySortDate     = "date"
+)
+
+// NearbyGigFilter narrows a radius search. The embedded GigFilter applies as
+// on the listing; its cursor is ignored.
+type NearbyGigFilter struct {
+    GigFilter
+    Latitude  *float64 `form:"lat" binding:"required,min=-90,max=90"`
+    Longitude *float64 `form:"lng" binding:"required,min=-180,max=180"`
+    RadiusKm  float64  `form:"radius_km" binding:"omitempty,gt=0,max=500"`
+    Sort      string   `form:"sort" binding:"omitempty,oneof=distance date"`
+}
+
+// MapGigFilter selects the gigs inside a map viewport. MinLng may exceed
+// MaxLng when the viewport crosses the antimeridian.
+type MapGigFilter struct {
+    GigFilter
+    MinLat *float64 `form:"min_lat" binding:"required,min=-90,max=90"`
+    MinLng *float64 `form:"min_lng" binding:"required,min=-180,max=180"`
+    MaxLat *float64 `form:"max_lat" binding:"required,min=-90,max=90,gtefield=MinLat"`
+    MaxLng *float64 `form:"max_lng" binding:"required,min=-180,max=180"`
+    Zoom   *int     `form:"zoom" binding:"required,min=0,max=22"`
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "sunyi-api/internal/mergepatch"
+    "time"
+)
+
+type GigRevisionAction string
+
+// A revision's action is created, updated or restored for edits, or the new
+// status for a status change.
+const (
+    RevisionCreated  GigRevisionAction = "created"
+    RevisionUpdated  GigRevisionAction = "updated"
+    RevisionRestored GigRevisionAction = "restored"
+)
+
+// GigRevision records one write to a gig: who made it, the resulting
+// snapshot and the fields that changed from the previous revision.
+// Version is the gig's version after the write.
+type GigRevision struct {
+    ID           string            `json:"id" db:"id"`
+    GigID        string            `json:"gig_id" db:"gig_id"`
+    Version      int               `json:"version" db:"version"`
+    Action       GigRevisionAction `json:"action" db:"action"`
+    EditorID     *string           `json:"editor_id" db:"editor_id"`
+    RestoredFrom *int              `json:"restored_from" db:"restored_from"`
+    Snapshot     JSONDocument      `json:"snapshot" db:"snapshot"`
+    Changes      ChangeList        `json:"changes" db:"changes"`
+    CreatedAt    time.Time         `json:"created_at" db:"created_at"`
+    Editor       *PublicUser       `json:"editor,omitempty" db:"-"`
+}
+
+// GigSnapshot is what a revision stores: the editable fields plus the
+// status they were published under and the image.
+type GigSnapshot struct {
+    GigInput
+    Status       GigStatus `json:"status"`
+    StatusReason *string   `json:"status_reason"`
+    ImageURL     *string   `json:"image_url"`
+}
+
+func (g *Gig) Snapshot() GigSnapshot {
+    return GigSnapshot{
+        GigInput:     g.Input(),
+        Status:       g.Status,
+        StatusReason: g.StatusReason,
+        ImageURL:     g.ImageURL,
+    }
+}
+
+// SnapshotDocument is Snapshot as a JSON object, ready to store or diff.
+func (g *Gig) SnapshotDocument() (JSONDocument, error) {
+    doc, err := mergepatch.FromValue(g.Snapshot())
+    return JSONDocument(doc), err
+}
+
+// GigDiff is the difference between two revisions of a gig.
+type GigDiff struct {
+    From    int                 `json:"from"`
+    To      int                 `json:"to"`
+    Changes []mergepatch.Change `json:"changes"`
+}
+
+type GigDiffQuery struct {
+    From int `form:"from" binding:"required,min=1"`
+    To   int `form:"to" binding:"required,min=1"`
+}
+
+// JSONDocument is a JSONB object column.
+type JSONDocument mergepatch.Document
+
+func (d *JSONDocument) Scan(value interface{}) error {
+    bytes, ok := value.([]byte)
+    if !ok {
+        return errors.New("failed to scan JSONDocument")
+    }
+    doc, err := mergepatch.Decode(bytes)
+    if err != nil {
+        return err
+    }
+    *d = JSONDocument(doc)
+    return nil
+}
+
+func (d JSONDocument) Value() (driver.Value, error) {
+    return json.Marshal(map[string]interface{}(d))
+}
+
+// ChangeList is a JSONB array of field changes.
+type ChangeList []mergepatch.Change
+
+func (l *ChangeList) Scan(value interface{}) error {
+    bytes, ok := value.([]byte)
+    if !ok {
+        return errors.New("failed to scan ChangeList")
+    }
+    return json.Unmarshal(bytes, l)
+}
+
+func (l ChangeList) Value() (driver.Value, error) {
+    if l == nil {
+        l = ChangeList{}
+    }
+    return json.Marshal(l)
+}
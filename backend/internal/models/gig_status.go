@@ -0,0 +1,52 @@
+package models
+
+type GigStatus string
+
+const (
+    GigStatusDraft       GigStatus = "draft"
+    GigStatusPublished   GigStatus = "published"
+    GigStatusCancelled   GigStatus = "cancelled"
+    GigStatusPostponed   GigStatus = "postponed"
+    GigStatusRescheduled GigStatus = "rescheduled"
+)
+
+// gigTransitions lists the statuses each status may move to. A draft is only
+// published; once public a gig can be cancelled, postponed or moved, and a
+// cancellation is final.
+var gigTransitions = map[GigStatus][]GigStatus{
+    GigStatusDraft:       {GigStatusPublished},
+    GigStatusPublished:   {GigStatusCancelled, GigStatusPostponed, GigStatusRescheduled},
+    GigStatusPostponed:   {GigStatusCancelled, GigStatusRescheduled},
+    GigStatusRescheduled: {GigStatusCancelled, GigStatusPostponed, GigStatusRescheduled},
+}
+
+func (s GigStatus) CanTransitionTo(next GigStatus) bool {
+    for _, allowed := range gigTransitions[s] {
+        if allowed == next {
+            return true
+        }
+    }
+    return false
+}
+
+// IsPublic reports whether gigs in this status are visible to everyone.
+func (s GigStatus) IsPublic() bool {
+    return s != GigStatusDraft
+}
+
+type CancelGigInput struct {
+    Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type PostponeGigInput struct {
+    Reason *string `json:"reason" binding:"omitempty,max=500"`
+}
+
+// RescheduleGigInput moves a gig to new times. Timezone defaults to the
+// gig's current one.
+type RescheduleGigInput struct {
+    StartsAt string  `json:"starts_at" binding:"required"`
+    EndsAt   *string `json:"ends_at"`
+    Timezone string  `json:"timezone" binding:"omitempty,timezone"`
+    Reason   *string `json:"reason" binding:"omitempty,max=500"`
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+    "encoding/json"
+    "errors"
+    "sync"
+    "time"
+)
+
+// Wall-clock layouts for gig times, read in the gig's own timezone.
+const (
+    LocalDateLayout     = "2006-01-02"
+    LocalTimeLayout     = "15:04"
+    LocalDateTimeLayout = "2006-01-02T15:04"
+)
+
+var ErrInvalidLocalTime = errors.New("expected YYYY-MM-DDTHH:MM or an RFC 3339 timestamp")
+
+var timezones sync.Map // name -> *time.Location
+
+// LoadTimezone is time.LoadLocation with a cache, since every gig in a
+// response needs its location.
+func LoadTimezone(name string) (*time.Location, error) {
+    if loc, ok := timezones.Load(name); ok {
+        return loc.(*time.Location), nil
+    }
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        return nil, err
+    }
+    timezones.Store(name, loc)
+    return loc, nil
+}
+
+// ParseLocalTime reads a wall-clock time in loc, with or without seconds.
+// A full RFC 3339 timestamp is also accepted and keeps its own offset.
+func ParseLocalTime(value string, loc *time.Location) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    for _, layout := range []string{LocalDateTimeLayout, LocalDateTimeLayout + ":05"} {
+        if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+            return t, nil
+        }
+    }
+    return time.Time{}, ErrInvalidLocalTime
+}
+
+// formatLocal writes t as a wall-clock time in loc, or nil for no time.
+func formatLocal(t *time.Time, loc *time.Location) *string {
+    if t == nil {
+        return nil
+    }
+    local := t.In(loc).Format(LocalDateTimeLayout + ":05")
+    return &local
+}
+
+// Location returns the gig's timezone, falling back to UTC for a name the
+// running system does not know.
+func (g Gig) Location() *time.Location {
+    loc, err := LoadTimezone(g.Timezone)
+    if err != nil {
+        return time.UTC
+    }
+    return loc
+}
+
+// MarshalJSON writes starts_at and ends_at with the gig's local offset, adds
+// their UTC forms, and keeps the local date, start_time and end_time fields
+// for clients that only display wall-clock times. An overnight show has an
+// end_time earlier than its start_time; ends_at carries the real date.
+func (g Gig) MarshalJSON() ([]byte, error) {
+    type gig Gig
+    loc := g.Location()
+    start := g.StartsAt.In(loc)
+
+    out := struct {
+        gig
+        StartsAt        string       `json:"starts_at"`
+        StartsAtUTC     string       `json:"starts_at_utc"`
+        EndsAt          *string      `json:"ends_at"`
+        EndsAtUTC       *string      `json:"ends_at_utc"`
+        Date            string       `json:"date"`
+        StartTime       string       `json:"start_time"`
+        EndTime         *string      `json:"end_time"`
+        RescheduledFrom *string      `json:"rescheduled_from"`
+        Lineup          []LineupSlot `json:"lineup"`
+    }{
+        gig:         gig(g),
+        StartsAt:    start.Format(time.RFC3339),
+        StartsAtUTC: g.StartsAt.UTC().Format(time.RFC3339),
+        Date:        start.Format(LocalDateLayout),
+        StartTime:   start.Format(LocalTimeLayout),
+        Lineup:      make([]LineupSlot, len(g.Lineup)),
+    }
+    // Set times carry the gig's offset too.
+    for i, slot := range g.Lineup {
+        if slot.SetStartsAt != nil {
+            local := slot.SetStartsAt.In(loc)
+            slot.SetStartsAt = &local
+        }
+        if slot.SetEndsAt != nil {
+            local := slot.SetEndsAt.In(loc)
+            slot.SetEndsAt = &local
+        }
+        out.Lineup[i] = slot
+    }
+    if g.EndsAt != nil {
+        end := g.EndsAt.In(loc)
+        local := end.Format(time.RFC3339)
+        utc := g.EndsAt.UTC().Format(time.RFC3339)
+        clock := end.Format(LocalTimeLayout)
+        out.EndsAt, out.EndsAtUTC, out.EndTime = &local, &utc, &clock
+    }
+    if g.RescheduledFrom != nil {
+        from := g.RescheduledFrom.In(loc).Format(time.RFC3339)
+        out.RescheduledFrom = &from
+    }
+    return json.Marshal(out)
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginFailures summarizes the failed sign-ins recorded under one
+// throttling key: how many fell within the window ending at the latest,
+// and how long ago the latest was.
+type LoginFailures struct {
+    Count     int
+    SinceLast time.Duration
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session is one signed-in device. Access tokens name their session in the
+// sid claim and stop working once it is revoked; the refresh token that
+// renews them is rotated on every use.
+type Session struct {
+    ID         string     `json:"id" db:"id"`
+    UserID     string     `json:"-" db:"user_id"`
+    UserAgent  string     `json:"user_agent" db:"user_agent"`
+    IPAddress  string     `json:"ip_address" db:"ip_address"`
+    CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+    // LastUsedAt is when the session last signed in or refreshed.
+    LastUsedAt time.Time  `json:"last_used_at" db:"last_used_at"`
+    // ExpiresAt moves forward on every refresh, so only sessions left
+    // unused for the refresh lifetime expire.
+    ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+    RevokedAt  *time.Time `json:"-" db:"revoked_at"`
+    // Current marks the session the request was made with.
+    Current    bool       `json:"current" db:"-"`
+}
+
+type RefreshInput struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
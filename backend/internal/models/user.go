@@ -7,18 +7,35 @@ type UserRole string
 const (
     RoleUser      UserRole = "user"
     RoleOrganizer UserRole = "organizer"
+    // RoleAdmin is granted from the command line, never at registration.
+    RoleAdmin     UserRole = "admin"
 )
 
 type User struct {
+    ID                 string     `json:"id" db:"id"`
+    Username           string     `json:"username" db:"username"`
+    Email              string     `json:"email" db:"email"`
+    PasswordHash       string     `json:"-" db:"password_hash"`
+    Role               UserRole   `json:"role" db:"role"`
+    Bio                *string    `json:"bio" db:"bio"`
+    ProfileImage       *string    `json:"profile_image" db:"profile_image"`
+    // EmailVerifiedAt is nil until the user follows the link mailed to them.
+    EmailVerifiedAt    *time.Time `json:"email_verified_at" db:"email_verified_at"`
+    VerificationSentAt *time.Time `json:"-" db:"email_verification_sent_at"`
+    CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+    UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// PublicUser is the projection of a user that anyone may see. It is what gets
+// embedded in other resources and returned from public endpoints; the full
+// User, with its email, is only for the account owner.
+type PublicUser struct {
     ID           string     `json:"id" db:"id"`
     Username     string     `json:"username" db:"username"`
-    Email        string     `json:"email" db:"email"`
-    PasswordHash string     `json:"-" db:"password_hash"`
     Role         UserRole   `json:"role" db:"role"`
     Bio          *string    `json:"bio" db:"bio"`
     ProfileImage *string    `json:"profile_image" db:"profile_image"`
     CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-    UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 type RegisterInput struct {
@@ -33,11 +50,66 @@ type LoginInput struct {
     Password string `json:"password" binding:"required"`
 }
 
+// VerifyEmailInput carries the token from a verification link.
+type VerifyEmailInput struct {
+    Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+    Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordInput carries the token from a password reset link.
+type ResetPasswordInput struct {
+    Token    string `json:"token" binding:"required"`
+    Password string `json:"password" binding:"required,min=8"`
+}
+
+type ChangePasswordInput struct {
+    CurrentPassword string `json:"current_password" binding:"required"`
+    NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+type UpdateUserInput struct {
+    Username     *string `json:"username" binding:"omitempty,min=3,max=50"`
+    Bio          *string `json:"bio" binding:"omitempty,max=500"`
+    ProfileImage *string `json:"profile_image" binding:"omitempty,image_url"`
+}
+
+type UserProfile struct {
+    User         PublicUser `json:"user"`
+    UpcomingGigs []Gig      `json:"upcoming_gigs"`
+}
+
+// AuthResponse is what signing in, registering and refreshing return. Token
+// is the access token, valid until ExpiresAt; RefreshToken renews it once
+// and is replaced by the one in the next response.
 type AuthResponse struct {
-    Token string `json:"token"`
-    User  User   `json:"user"`
+    Token        string    `json:"token"`
+    ExpiresAt    time.Time `json:"expires_at"`
+    RefreshToken string    `json:"refresh_token"`
+    User         User      `json:"user"`
 }
 
 func (u *User) IsOrganizer() bool {
     return u.Role == RoleOrganizer
-}
\ No newline at end of file
+}
+
+func (u *User) IsAdmin() bool {
+    return u.Role == RoleAdmin
+}
+
+func (u *User) IsEmailVerified() bool {
+    return u.EmailVerifiedAt != nil
+}
+
+func (u *User) Public() PublicUser {
+    return PublicUser{
+        ID:           u.ID,
+        Username:     u.Username,
+        Role:         u.Role,
+        Bio:          u.Bio,
+        ProfileImage: u.ProfileImage,
+        CreatedAt:    u.CreatedAt,
+    }
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+    "strings"
+    "time"
+    "unicode"
+)
+
+// VenueMatchRadiusKm is how close an existing venue must be for a new
+// gig's venue to be matched against it by name.
+const VenueMatchRadiusKm = 0.3
+
+// venueNameSimilarity is the minimum similarity, from 0 to 1, at which two
+// normalized venue names are taken to mean the same place.
+const venueNameSimilarity = 0.8
+
+type Venue struct {
+    ID         string    `json:"id" db:"id"`
+    Name       string    `json:"name" db:"name"`
+    Address    string    `json:"address" db:"address"`
+    Latitude   float64   `json:"latitude" db:"latitude"`
+    Longitude  float64   `json:"longitude" db:"longitude"`
+    // CreatedBy is the organizer who added the venue and may edit it. It is
+    // nil once their account is deleted.
+    CreatedBy  *string   `json:"created_by" db:"created_by"`
+    CreatedAt  time.Time `json:"created_at" db:"created_at"`
+    UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+    DistanceKm *float64  `json:"distance_km,omitempty" db:"distance_km"`
+}
+
+type VenueInput struct {
+    Name      string  `json:"name" binding:"required,max=200"`
+    Address   string  `json:"address" binding:"required"`
+    Latitude  float64 `json:"latitude" binding:"required,min=-90,max=90"`
+    Longitude float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// VenueFilter searches venues by name and, with lat and lng, by distance.
+// Results near a point are ordered by distance, the rest by name.
+type VenueFilter struct {
+    Query     string   `form:"q" binding:"omitempty,max=200"`
+    Latitude  *float64 `form:"lat" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+    Longitude *float64 `form:"lng" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+    RadiusKm  float64  `form:"radius_km" binding:"omitempty,gt=0,max=500"`
+    Limit     int      `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// NormalizeVenueName reduces a venue name to the form names are compared
+// in: lower case, "&" read as "and", punctuation dropped and a leading or
+// inner "the" ignored, so "The Jazz-Club" and "jazz club" are equal. The
+// venues migration applies the same rules in SQL.
+func NormalizeVenueName(name string) string {
+    name = strings.ReplaceAll(strings.ToLower(name), "&", " and ")
+    words := strings.FieldsFunc(name, func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+    kept := words[:0]
+    for _, word := range words {
+        if word != "the" {
+            kept = append(kept, word)
+        }
+    }
+    return strings.Join(kept, " ")
+}
+
+// SimilarVenueNames reports whether two names likely spell the same venue:
+// equal once normalized, or close enough to be a typo of each other.
+func SimilarVenueNames(a, b string) bool {
+    a, b = NormalizeVenueName(a), NormalizeVenueName(b)
+    if a == "" || b == "" {
+        return false
+    }
+    if a == b {
+        return true
+    }
+    ra, rb := []rune(a), []rune(b)
+    longest := len(ra)
+    if len(rb) > longest {
+        longest = len(rb)
+    }
+    // Short names differ too much with a single edit to call them similar.
+    if longest < 5 {
+        return false
+    }
+    return 1-float64(levenshtein(ra, rb))/float64(longest) >= venueNameSimilarity
+}
+
+// MatchVenue picks the candidate whose name is similar to name, preferring
+// the closest. Candidates are expected to lie within VenueMatchRadiusKm.
+func MatchVenue(candidates []Venue, name string) *Venue {
+    var best *Venue
+    for i := range candidates {
+        venue := &candidates[i]
+        if !SimilarVenueNames(venue.Name, name) {
+            continue
+        }
+        if best == nil || (venue.DistanceKm != nil && best.DistanceKm != nil && *venue.DistanceKm < *best.DistanceKm) {
+            best = venue
+        }
+    }
+    return best
+}
+
+func levenshtein(a, b []rune) int {
+    prev := make([]int, len(b)+1)
+    curr := make([]int, len(b)+1)
+    for j := range prev {
+        prev[j] = j
+    }
+    for i := 1; i <= len(a); i++ {
+        curr[0] = i
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+            curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+        }
+        prev, curr = curr, prev
+    }
+    return prev[len(b)]
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrArtistInUse means gigs still bill the artist being deleted.
+var ErrArtistInUse = apperr.Conflict("artist", "Artist is still on a gig lineup and cannot be deleted")
+
+type ArtistRepository struct {
+    db      *sqlx.DB
+    timeout time.Duration
+}
+
+// NewArtistRepository returns a repository whose queries are bounded by
+// queryTimeout unless the caller's context ends sooner.
+func NewArtistRepository(db *sqlx.DB, queryTimeout time.Duration) *ArtistRepository {
+    return &ArtistRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *ArtistRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+func (r *ArtistRepository) Create(ctx context.Context, artist *models.Artist) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        INSERT INTO artists (name, bio, created_by)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, updated_at
+    `
+    err := r.db.QueryRowContext(ctx, query, artist.Name, artist.Bio, artist.CreatedBy).
+        Scan(&artist.ID, &artist.CreatedAt, &artist.UpdatedAt)
+    return TranslateError(err, "artist")
+}
+
+func (r *ArtistRepository) GetByID(ctx context.Context, id string) (*models.Artist, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    var artist models.Artist
+    query := `
+        SELECT id, name, bio, created_by, created_at, updated_at
+        FROM artists
+        WHERE id = $1
+    `
+    if err := r.db.GetContext(ctx, &artist, query, id); err != nil {
+        return nil, TranslateError(err, "artist")
+    }
+    return &artist, nil
+}
+
+// List searches artists by a case-insensitive name fragment. An artist
+// named exactly as searched comes first, the rest by name.
+func (r *ArtistRepository) List(ctx context.Context, filter models.ArtistFilter) ([]models.Artist, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    w := &whereBuilder{}
+    orderBy := "name, id"
+    if filter.Query != "" {
+        w.where("name ILIKE '%' || " + w.arg(escapeLike(filter.Query)) + " || '%'")
+        orderBy = "lower(name) = lower(" + w.arg(filter.Query) + ") DESC, " + orderBy
+    }
+
+    query := `
+        SELECT id, name, bio, created_by, created_at, updated_at
+        FROM artists
+        ` + w.clause() + `
+        ORDER BY ` + orderBy + `
+        LIMIT ` + w.arg(PageLimit(filter.Limit))
+
+    artists := []models.Artist{}
+    if err := r.db.SelectContext(ctx, &artists, query, w.args...); err != nil {
+        return nil, TranslateError(err, "artist")
+    }
+    return artists, nil
+}
+
+func (r *ArtistRepository) Update(ctx context.Context, artist *models.Artist) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE artists
+        SET name = $1, bio = $2, updated_at = NOW()
+        WHERE id = $3
+        RETURNING updated_at
+    `
+    err := r.db.QueryRowContext(ctx, query, artist.Name, artist.Bio, artist.ID).Scan(&artist.UpdatedAt)
+    return TranslateError(err, "artist")
+}
+
+// Delete removes an artist no lineup refers to, failing with ErrArtistInUse
+// otherwise.
+func (r *ArtistRepository) Delete(ctx context.Context, id string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM artists WHERE id = $1`, id)
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Constraint == "gig_lineups_artist_id_fkey" {
+        return ErrArtistInUse
+    }
+    if err != nil {
+        return TranslateError(err, "artist")
+    }
+
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rows == 0 {
+        return TranslateError(sql.ErrNoRows, "artist")
+    }
+    return nil
+}
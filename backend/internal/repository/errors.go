@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sunyi-api/internal/apperr"
+
+	"github.com/lib/pq"
+)
+
+// constraintErrors maps named constraints to the input field they guard and
+// the message clients see when it is violated.
+var constraintErrors = map[string]struct {
+    field   string
+    message string
+}{
+    "users_email_key":              {"email", "Email already registered"},
+    "users_username_key":           {"username", "Username already taken"},
+    "users_role_check":             {"role", "Role must be user, organizer or admin"},
+    "gigs_organizer_id_fkey":       {"organizer_id", "Organizer does not exist"},
+    "gigs_venue_id_fkey":           {"venue_id", "Venue does not exist"},
+    "gigs_ends_after_start_check":  {"ends_at", "End must be after the start"},
+    "gigs_status_check":            {"status", "Unknown gig status"},
+    "venues_latitude_check":        {"latitude", "Latitude must be between -90 and 90"},
+    "venues_longitude_check":       {"longitude", "Longitude must be between -180 and 180"},
+    "gig_lineups_artist_id_fkey":   {"lineup", "Artist does not exist"},
+    "gig_lineups_pkey":             {"lineup", "An artist can only appear once in a lineup"},
+    "gig_lineups_set_ends_check":   {"lineup", "A set must end after it starts"},
+    "gig_genres_genre_slug_fkey":   {"genres", "Unknown genre"},
+    "sessions_user_id_fkey":        {"user_id", "User does not exist"},
+    "password_resets_user_id_fkey": {"user_id", "User does not exist"},
+}
+
+// TranslateError converts driver errors into apperr values: missing rows
+// and malformed ids become ErrNotFound for resource, unique violations
+// (23505) ErrConflict, and other malformed input (22P02), foreign key
+// (23503) or check (23514) violations ErrValidation. A statement Postgres
+// canceled (57014) is reported as context.DeadlineExceeded. Anything else
+// is returned unchanged.
+func TranslateError(err error, resource string) error {
+    if err == nil {
+        return nil
+    }
+    if errors.Is(err, sql.ErrNoRows) {
+        return apperr.NotFound(resource).Wrap(err)
+    }
+
+    var pqErr *pq.Error
+    if !errors.As(err, &pqErr) {
+        return err
+    }
+    known, ok := constraintErrors[pqErr.Constraint]
+    switch pqErr.Code {
+    case "23505":
+        if !ok {
+            known.message = strings.ToUpper(resource[:1]) + resource[1:] + " already exists"
+        }
+        return apperr.Conflict(known.field, known.message).Wrap(err)
+    case "23503":
+        if !ok {
+            known.message = "Referenced record does not exist"
+        }
+        return apperr.InvalidField(known.field, known.message).Wrap(err)
+    case "23514":
+        if !ok {
+            known.message = "Invalid " + resource
+        }
+        return apperr.InvalidField(known.field, known.message).Wrap(err)
+    case "22P02":
+        // A malformed id cannot match any row, as the memory stores agree.
+        // Other text Postgres cannot read, such as an unknown enum value or
+        // bad JSON, is the caller's mistake.
+        if strings.Contains(pqErr.Message, "type uuid") {
+            return apperr.NotFound(resource).Wrap(err)
+        }
+        return apperr.Validation("Invalid " + resource).Wrap(err)
+    case "57014":
+        return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+    }
+    return err
+}
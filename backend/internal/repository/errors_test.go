@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"sunyi-api/internal/apperr"
+
+	"github.com/lib/pq"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		kind    error
+		message string
+		field   string
+	}{
+		{"missing row", sql.ErrNoRows, apperr.ErrNotFound, "Gig not found", ""},
+		{
+			"malformed id",
+			&pq.Error{Code: "22P02", Message: `invalid input syntax for type uuid: "not-a-uuid"`},
+			apperr.ErrNotFound, "Gig not found", "",
+		},
+		{
+			"malformed enum",
+			&pq.Error{Code: "22P02", Message: `invalid input value for enum gig_status: "soon"`},
+			apperr.ErrValidation, "Invalid gig", "",
+		},
+		{
+			"known unique violation",
+			&pq.Error{Code: "23505", Constraint: "users_email_key"},
+			apperr.ErrConflict, "Email already registered", "email",
+		},
+		{
+			"unknown unique violation",
+			&pq.Error{Code: "23505", Constraint: "gigs_something_key"},
+			apperr.ErrConflict, "Gig already exists", "",
+		},
+		{
+			"foreign key",
+			&pq.Error{Code: "23503", Constraint: "gigs_venue_id_fkey"},
+			apperr.ErrValidation, "Venue does not exist", "venue_id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := TranslateError(tt.err, "gig")
+			var appErr *apperr.Error
+			if !errors.As(err, &appErr) {
+				t.Fatalf("got %v, want an apperr.Error", err)
+			}
+			if !errors.Is(err, tt.kind) || appErr.Message != tt.message || appErr.Field != tt.field {
+				t.Fatalf("got %v %q field %q, want %v %q field %q",
+					appErr.Kind, appErr.Message, appErr.Field, tt.kind, tt.message, tt.field)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("%v does not wrap %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"sunyi-api/internal/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type GenreRepository struct {
+    db      *sqlx.DB
+    timeout time.Duration
+}
+
+// NewGenreRepository returns a repository whose queries are bounded by
+// queryTimeout unless the caller's context ends sooner.
+func NewGenreRepository(db *sqlx.DB, queryTimeout time.Duration) *GenreRepository {
+    return &GenreRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *GenreRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+// genreTreeSQL selects the slug of the genre whose alias key is the given
+// placeholder together with the slugs of all its sub-genres.
+func genreTreeSQL(key string) string {
+    return `
+        WITH RECURSIVE tree (slug) AS (
+            SELECT genre_slug FROM genre_aliases WHERE alias = ` + key + `
+            UNION
+            SELECT g.slug FROM genres g JOIN tree t ON g.parent_slug = t.slug
+        )
+        SELECT slug FROM tree`
+}
+
+// List returns every genre by name, each with the number of upcoming
+// public gigs in it or its sub-genres, counted as GET /api/gigs?upcoming=true
+// would.
+func (r *GenreRepository) List(ctx context.Context) ([]models.Genre, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        WITH RECURSIVE tree (root, slug) AS (
+            SELECT slug, slug FROM genres
+            UNION
+            SELECT t.root, g.slug FROM genres g JOIN tree t ON g.parent_slug = t.slug
+        )
+        SELECT ge.slug, ge.name, ge.parent_slug, COUNT(DISTINCT g.id) AS upcoming_gigs
+        FROM genres ge
+        JOIN tree t ON t.root = ge.slug
+        LEFT JOIN gig_genres gg ON gg.genre_slug = t.slug
+        LEFT JOIN gigs g ON g.id = gg.gig_id
+            AND g.status <> 'draft'
+            AND (COALESCE(g.ends_at, g.starts_at) >= NOW() OR g.status = 'postponed')
+        GROUP BY ge.slug, ge.name, ge.parent_slug
+        ORDER BY ge.name, ge.slug
+    `
+    genres := []models.Genre{}
+    if err := r.db.SelectContext(ctx, &genres, query); err != nil {
+        return nil, TranslateError(err, "genre")
+    }
+    return genres, nil
+}
+
+// Resolve maps each of the given alias keys that names a genre to the
+// genre's slug. Unknown keys are absent from the result.
+func (r *GenreRepository) Resolve(ctx context.Context, keys []string) (map[string]string, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    var rows []struct {
+        Alias string `db:"alias"`
+        Slug  string `db:"genre_slug"`
+    }
+    query := `SELECT alias, genre_slug FROM genre_aliases WHERE alias = ANY($1)`
+    if err := r.db.SelectContext(ctx, &rows, query, pq.Array(keys)); err != nil {
+        return nil, TranslateError(err, "genre")
+    }
+
+    slugs := make(map[string]string, len(rows))
+    for _, row := range rows {
+        slugs[row.Alias] = row.Slug
+    }
+    return slugs, nil
+}
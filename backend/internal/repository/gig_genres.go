@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sunyi-api/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// loadGenres fills Genres on every gig with its genre slugs in the order
+// they were given, with a single query for all of them.
+func (r *GigRepository) loadGenres(ctx context.Context, gigs []models.Gig) error {
+    if len(gigs) == 0 {
+        return nil
+    }
+
+    ids := make([]string, len(gigs))
+    for i := range gigs {
+        ids[i] = gigs[i].ID
+    }
+
+    var rows []struct {
+        GigID string `db:"gig_id"`
+        Slug  string `db:"genre_slug"`
+    }
+    query := `
+        SELECT gig_id, genre_slug
+        FROM gig_genres
+        WHERE gig_id = ANY($1)
+        ORDER BY gig_id, position
+    `
+    if err := r.db.SelectContext(ctx, &rows, query, pq.Array(ids)); err != nil {
+        return fmt.Errorf("load genres: %w", TranslateError(err, "gig"))
+    }
+
+    byGig := make(map[string]models.StringArray, len(gigs))
+    for _, row := range rows {
+        byGig[row.GigID] = append(byGig[row.GigID], row.Slug)
+    }
+    for i := range gigs {
+        gigs[i].Genres = byGig[gigs[i].ID]
+        if gigs[i].Genres == nil {
+            gigs[i].Genres = models.StringArray{}
+        }
+    }
+    return nil
+}
+
+// saveGenres replaces the gig's genres inside the writing transaction. The
+// slugs are expected to be canonical already; an unknown one fails
+// gig_genres_genre_slug_fkey.
+func (r *GigRepository) saveGenres(ctx context.Context, tx *sqlx.Tx, gig *models.Gig) error {
+    if _, err := tx.ExecContext(ctx, `DELETE FROM gig_genres WHERE gig_id = $1`, gig.ID); err != nil {
+        return TranslateError(err, "gig")
+    }
+
+    query := `
+        INSERT INTO gig_genres (gig_id, genre_slug, position)
+        SELECT $1, slug, position
+        FROM unnest($2::text[]) WITH ORDINALITY AS genres (slug, position)
+    `
+    _, err := tx.ExecContext(ctx, query, gig.ID, pq.Array([]string(gig.Genres)))
+    return TranslateError(err, "gig")
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sunyi-api/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// loadRelated fills what gig reads return besides the gig row itself: the
+// organizer, the genres and the lineup.
+func (r *GigRepository) loadRelated(ctx context.Context, gigs []models.Gig) error {
+    if err := r.loadOrganizers(ctx, gigs); err != nil {
+        return err
+    }
+    if err := r.loadGenres(ctx, gigs); err != nil {
+        return err
+    }
+    return r.loadLineups(ctx, gigs)
+}
+
+// loadLineups fills Lineup on every gig, in billing order, with a single
+// query for all of them.
+func (r *GigRepository) loadLineups(ctx context.Context, gigs []models.Gig) error {
+    if len(gigs) == 0 {
+        return nil
+    }
+
+    ids := make([]string, len(gigs))
+    for i := range gigs {
+        ids[i] = gigs[i].ID
+        gigs[i].Lineup = []models.LineupSlot{}
+    }
+
+    var slots []models.LineupSlot
+    query := `
+        SELECT l.gig_id, l.artist_id, a.name AS artist_name, l.position,
+               l.set_starts_at, l.set_ends_at
+        FROM gig_lineups l
+        JOIN artists a ON a.id = l.artist_id
+        WHERE l.gig_id = ANY($1)
+        ORDER BY l.gig_id, l.position
+    `
+    if err := r.db.SelectContext(ctx, &slots, query, pq.Array(ids)); err != nil {
+        return fmt.Errorf("load lineups: %w", TranslateError(err, "gig"))
+    }
+
+    byGig := make(map[string][]models.LineupSlot, len(gigs))
+    for _, slot := range slots {
+        byGig[slot.GigID] = append(byGig[slot.GigID], slot)
+    }
+    for i := range gigs {
+        if lineup, ok := byGig[gigs[i].ID]; ok {
+            gigs[i].Lineup = lineup
+        }
+    }
+    return nil
+}
+
+// saveLineup replaces the gig's lineup inside the writing transaction,
+// numbering positions from 1 in slice order.
+func (r *GigRepository) saveLineup(ctx context.Context, tx *sqlx.Tx, gig *models.Gig) error {
+    if _, err := tx.ExecContext(ctx, `DELETE FROM gig_lineups WHERE gig_id = $1`, gig.ID); err != nil {
+        return TranslateError(err, "gig")
+    }
+
+    query := `
+        INSERT INTO gig_lineups (gig_id, artist_id, position, set_starts_at, set_ends_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+    for i := range gig.Lineup {
+        slot := &gig.Lineup[i]
+        slot.GigID = gig.ID
+        slot.Position = i + 1
+        _, err := tx.ExecContext(ctx, query, gig.ID, slot.ArtistID, slot.Position, slot.SetStartsAt, slot.SetEndsAt)
+        if err != nil {
+            return TranslateError(err, "gig")
+        }
+    }
+    return nil
+}
@@ -1,180 +1,608 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/geo"
 	"sunyi-api/internal/models"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type GigRepository struct {
-    db *sqlx.DB
+    db      *sqlx.DB
+    timeout time.Duration
 }
 
-func NewGigRepository(db *sqlx.DB) *GigRepository {
-    return &GigRepository{db: db}
+// NewGigRepository returns a repository whose queries are bounded by
+// queryTimeout unless the caller's context ends sooner.
+func NewGigRepository(db *sqlx.DB, queryTimeout time.Duration) *GigRepository {
+    return &GigRepository{db: db, timeout: queryTimeout}
 }
 
-func (r *GigRepository) Create(gig *models.Gig) error {
+func (r *GigRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+// Create inserts the gig and its first revision, credited to the organizer.
+func (r *GigRepository) Create(ctx context.Context, gig *models.Gig) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return TranslateError(err, "gig")
+    }
+    defer tx.Rollback()
+
     query := `
         INSERT INTO gigs (
-            title, description, venue_name, venue_address, 
-            latitude, longitude, date, start_time, end_time, 
-            price, image_url, organizer_id, genres
+            title, description, venue_id, starts_at, ends_at, timezone, 
+            price, image_url, organizer_id, status
         )
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-        RETURNING id, created_at, updated_at
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING id, version, created_at, updated_at
     `
-    return r.db.QueryRow(
+    err = tx.QueryRowContext(
+        ctx,
         query,
         gig.Title,
         gig.Description,
-        gig.VenueName,
-        gig.VenueAddress,
-        gig.Latitude,
-        gig.Longitude,
-        gig.Date,
-        gig.StartTime,
-        gig.EndTime,
+        gig.VenueID,
+        gig.StartsAt,
+        gig.EndsAt,
+        gig.Timezone,
         gig.Price,
         gig.ImageURL,
         gig.OrganizerID,
-        gig.Genres,
-    ).Scan(&gig.ID, &gig.CreatedAt, &gig.UpdatedAt)
+        gig.Status,
+    ).Scan(&gig.ID, &gig.Version, &gig.CreatedAt, &gig.UpdatedAt)
+    if err != nil {
+        return TranslateError(err, "gig")
+    }
+
+    if err := r.saveGenres(ctx, tx, gig); err != nil {
+        return err
+    }
+    if err := r.saveLineup(ctx, tx, gig); err != nil {
+        return err
+    }
+    if err := r.recordRevision(ctx, tx, gig, revisionMeta{editorID: gig.OrganizerID, action: models.RevisionCreated}); err != nil {
+        return err
+    }
+    return TranslateError(tx.Commit(), "gig")
+}
+
+const (
+    DefaultGigPageSize = 20
+    MaxGigPageSize     = 100
+)
+
+var (
+    ErrInvalidCursor    = apperr.InvalidField("cursor", "Invalid cursor")
+    // ErrGigStatusChanged means another request changed the gig's status
+    // between reading it and applying a transition.
+    ErrGigStatusChanged = apperr.Conflict("status", "Gig status has changed, reload and try again")
+    // ErrStaleGig means the gig's version is no longer the one the caller
+    // read, so its write would overwrite someone else's.
+    ErrStaleGig = apperr.PreconditionFailed("Gig was changed by someone else, reload and try again")
+)
+
+// PageLimit clamps a requested page size to [1, MaxGigPageSize], using the
+// default when none was given.
+func PageLimit(limit int) int {
+    if limit <= 0 {
+        return DefaultGigPageSize
+    }
+    if limit > MaxGigPageSize {
+        return MaxGigPageSize
+    }
+    return limit
+}
+
+// GigCursor marks the last row of a page in ORDER BY starts_at DESC, id DESC.
+type GigCursor struct {
+    StartsAt time.Time `json:"s"`
+    ID       string    `json:"id"`
+}
+
+func EncodeGigCursor(gig models.Gig) string {
+    b, _ := json.Marshal(GigCursor{StartsAt: gig.StartsAt, ID: gig.ID})
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeGigCursor(s string) (*GigCursor, error) {
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return nil, ErrInvalidCursor
+    }
+    var cur GigCursor
+    if err := json.Unmarshal(b, &cur); err != nil || cur.ID == "" || cur.StartsAt.IsZero() {
+        return nil, ErrInvalidCursor
+    }
+    return &cur, nil
 }
 
-func (r *GigRepository) GetAll() ([]models.Gig, error) {
-    // First, get all gigs
-    var gigs []models.Gig
+// filterConditions applies the shared gig filters. Drafts are only visible
+// to their organizer. A genre matches by any alias and takes in its
+// sub-genres. Date bounds compare the gig's local date in its own
+// timezone; "upcoming" keeps gigs that have not finished yet and postponed
+// gigs, whose old date no longer says anything.
+func (r *GigRepository) filterConditions(filter models.GigFilter) *whereBuilder {
+    w := &whereBuilder{}
+    if filter.ViewerID != "" {
+        w.where("(status <> 'draft' OR organizer_id = " + w.arg(filter.ViewerID) + ")")
+    } else {
+        w.where("status <> 'draft'")
+    }
+    if filter.Status != "" {
+        w.where("status = " + w.arg(filter.Status))
+    }
+    if filter.DateFrom != "" {
+        w.where("(starts_at AT TIME ZONE timezone)::date >= " + w.arg(filter.DateFrom) + "::date")
+    }
+    if filter.DateTo != "" {
+        w.where("(starts_at AT TIME ZONE timezone)::date <= " + w.arg(filter.DateTo) + "::date")
+    }
+    if filter.Upcoming {
+        w.where("(COALESCE(ends_at, starts_at) >= NOW() OR status = 'postponed')")
+    }
+    if filter.Genre != "" {
+        w.where(`EXISTS (
+            SELECT 1 FROM gig_genres gg
+            WHERE gg.gig_id = gig_listings.id AND gg.genre_slug IN (` + genreTreeSQL(w.arg(models.GenreKey(filter.Genre))) + `))`)
+    }
+    if filter.PriceMin != nil {
+        w.where("COALESCE(price, 0) >= " + w.arg(*filter.PriceMin))
+    }
+    if filter.PriceMax != nil {
+        w.where("COALESCE(price, 0) <= " + w.arg(*filter.PriceMax))
+    }
+    if filter.OrganizerID != "" {
+        w.where("organizer_id = " + w.arg(filter.OrganizerID))
+    }
+    if filter.VenueID != "" {
+        w.where("venue_id = " + w.arg(filter.VenueID))
+    }
+    if filter.ArtistID != "" {
+        w.where("EXISTS (SELECT 1 FROM gig_lineups l WHERE l.gig_id = gig_listings.id AND l.artist_id = " + w.arg(filter.ArtistID) + ")")
+    }
+    if filter.Artist != "" {
+        w.where(`EXISTS (
+            SELECT 1 FROM gig_lineups l JOIN artists a ON a.id = l.artist_id
+            WHERE l.gig_id = gig_listings.id AND a.name ILIKE '%' || ` + w.arg(escapeLike(filter.Artist)) + ` || '%')`)
+    }
+    return w
+}
+
+// List returns one page of gigs matching filter along with the total number
+// of matches and the cursor for the following page.
+func (r *GigRepository) List(ctx context.Context, filter models.GigFilter) (*models.GigListResponse, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    limit := PageLimit(filter.Limit)
+
+    w := r.filterConditions(filter)
+
+    var total int
+    countQuery := `SELECT COUNT(*) FROM gig_listings ` + w.clause()
+    if err := r.db.GetContext(ctx, &total, countQuery, w.args...); err != nil {
+        return nil, TranslateError(err, "gig")
+    }
+
+    page := w.clone()
+    if filter.Cursor != "" {
+        cur, err := DecodeGigCursor(filter.Cursor)
+        if err != nil {
+            return nil, err
+        }
+        page.where("(starts_at, id) < (" + page.arg(cur.StartsAt) + ", " + page.arg(cur.ID) + ")")
+    }
+
     query := `
-        SELECT id, title, description, venue_name, venue_address,
-               latitude, longitude, date, start_time, end_time,
-               price, image_url, organizer_id, genres,
+        SELECT id, title, description, venue_id, venue_name, venue_address,
+               latitude, longitude, starts_at, ends_at, timezone,
+               price, image_url, image_thumbnails, organizer_id,
+               status, status_reason, status_changed_at, rescheduled_from, version,
                created_at, updated_at
-        FROM gigs
-        ORDER BY date DESC, start_time DESC
-    `
-    err := r.db.Select(&gigs, query)
-    if err != nil {
+        FROM gig_listings
+        ` + page.clause() + `
+        ORDER BY starts_at DESC, id DESC
+        LIMIT ` + page.arg(limit+1)
+
+    gigs := []models.Gig{}
+    if err := r.db.SelectContext(ctx, &gigs, query, page.args...); err != nil {
+        return nil, TranslateError(err, "gig")
+    }
+
+    result := &models.GigListResponse{Total: total}
+    if len(gigs) > limit {
+        gigs = gigs[:limit]
+        next := EncodeGigCursor(gigs[limit-1])
+        result.NextCursor = &next
+    }
+
+    if err := r.loadRelated(ctx, gigs); err != nil {
         return nil, err
     }
+    result.Data = gigs
+
+    return result, nil
+}
+
+const DefaultNearbyRadiusKm = 10
+
+// haversineSQL builds the great-circle distance in km from the given
+// latitude/longitude placeholders to each gig.
+func haversineSQL(lat, lng string) string {
+    return `(2 * 6371 * ASIN(LEAST(1, SQRT(
+            POWER(SIN(RADIANS(latitude - ` + lat + `) / 2), 2) +
+            COS(RADIANS(` + lat + `)) * COS(RADIANS(latitude)) *
+            POWER(SIN(RADIANS(longitude - ` + lng + `) / 2), 2)))))`
+}
+
+// Nearby returns gigs within filter.RadiusKm of a point, each annotated with
+// its distance. A bounding box narrows the rows before the exact distance is
+// computed.
+func (r *GigRepository) Nearby(ctx context.Context, filter models.NearbyGigFilter) ([]models.Gig, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    radius := filter.RadiusKm
+    if radius <= 0 {
+        radius = DefaultNearbyRadiusKm
+    }
+    limit := PageLimit(filter.Limit)
+    lat, lng := *filter.Latitude, *filter.Longitude
+
+    w := r.filterConditions(filter.GigFilter)
+    box := geo.BoundingBox(lat, lng, radius)
+    w.where("latitude BETWEEN " + w.arg(box.MinLat) + " AND " + w.arg(box.MaxLat))
+    if box.CrossesAntimeridian() {
+        w.where("(longitude >= " + w.arg(box.MinLng) + " OR longitude <= " + w.arg(box.MaxLng) + ")")
+    } else {
+        w.where("longitude BETWEEN " + w.arg(box.MinLng) + " AND " + w.arg(box.MaxLng))
+    }
+
+    distance := haversineSQL(w.arg(lat), w.arg(lng))
+
+    orderBy := "distance_km ASC, starts_at DESC, id DESC"
+    if filter.Sort == models.NearbySortDate {
+        orderBy = "starts_at DESC, distance_km ASC, id DESC"
+    }
+
+    query := `
+        SELECT * FROM (
+            SELECT id, title, description, venue_id, venue_name, venue_address,
+                   latitude, longitude, starts_at, ends_at, timezone,
+                   price, image_url, image_thumbnails, organizer_id,
+                   status, status_reason, status_changed_at, rescheduled_from, version,
+                   created_at, updated_at,
+                   ` + distance + ` AS distance_km
+            FROM gig_listings
+            ` + w.clause() + `
+        ) nearby
+        WHERE distance_km <= ` + w.arg(radius) + `
+        ORDER BY ` + orderBy + `
+        LIMIT ` + w.arg(limit)
+
+    gigs := []models.Gig{}
+    if err := r.db.SelectContext(ctx, &gigs, query, w.args...); err != nil {
+        return nil, TranslateError(err, "gig")
+    }
+
+    if err := r.loadRelated(ctx, gigs); err != nil {
+        return nil, err
+    }
+
+    return gigs, nil
+}
+
+// MaxViewportGigs caps how many rows a single viewport query may cluster.
+const MaxViewportGigs = 5000
+
+// InViewport returns the gigs inside a map viewport for clustering, latest
+// first, and reports whether there were more than MaxViewportGigs of them,
+// in which case the rest are left out. Only what a map marker shows is
+// loaded: no description, organizer or lineup.
+func (r *GigRepository) InViewport(ctx context.Context, filter models.MapGigFilter) ([]models.Gig, bool, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    w := r.filterConditions(filter.GigFilter)
+    w.where("latitude BETWEEN " + w.arg(*filter.MinLat) + " AND " + w.arg(*filter.MaxLat))
+    if *filter.MinLng > *filter.MaxLng {
+        w.where("(longitude >= " + w.arg(*filter.MinLng) + " OR longitude <= " + w.arg(*filter.MaxLng) + ")")
+    } else {
+        w.where("longitude BETWEEN " + w.arg(*filter.MinLng) + " AND " + w.arg(*filter.MaxLng))
+    }
+
+    query := `
+        SELECT id, title, venue_name, latitude, longitude, starts_at, timezone,
+               price, image_url, status
+        FROM gig_listings
+        ` + w.clause() + `
+        ORDER BY starts_at DESC, id DESC
+        LIMIT ` + w.arg(MaxViewportGigs+1)
+
+    gigs := []models.Gig{}
+    if err := r.db.SelectContext(ctx, &gigs, query, w.args...); err != nil {
+        return nil, false, TranslateError(err, "gig")
+    }
+    truncated := len(gigs) > MaxViewportGigs
+    if truncated {
+        gigs = gigs[:MaxViewportGigs]
+    }
+
+    if err := r.loadGenres(ctx, gigs); err != nil {
+        return nil, false, err
+    }
+
+    return gigs, truncated, nil
+}
+
+// loadOrganizers fills Organizer on every gig with a single query for all
+// distinct organizer ids. A gig whose organizer row is missing is an error
+// since organizer_id is a foreign key.
+func (r *GigRepository) loadOrganizers(ctx context.Context, gigs []models.Gig) error {
+    if len(gigs) == 0 {
+        return nil
+    }
+
+    ids := make([]string, len(gigs))
+    for i, gig := range gigs {
+        ids[i] = gig.OrganizerID
+    }
+    byID, err := r.publicUsers(ctx, ids)
+    if err != nil {
+        return fmt.Errorf("load organizers: %w", err)
+    }
 
-    // Then fetch organizer for each gig
-    userQuery := `SELECT id, username, email, role, bio, profile_image, created_at, updated_at FROM users WHERE id = $1`
     for i := range gigs {
-        var user models.User
-        err := r.db.Get(&user, userQuery, gigs[i].OrganizerID)
-        if err == nil {
-            gigs[i].Organizer = &user
+        organizer, ok := byID[gigs[i].OrganizerID]
+        if !ok {
+            return fmt.Errorf("load organizers: organizer %s of gig %s not found", gigs[i].OrganizerID, gigs[i].ID)
         }
+        gigs[i].Organizer = organizer
     }
 
-    return gigs, nil
+    return nil
+}
+
+// publicUsers fetches the distinct users among ids in one query, keyed by id.
+// Ids with no user are simply absent from the result.
+func (r *GigRepository) publicUsers(ctx context.Context, ids []string) (map[string]*models.PublicUser, error) {
+    seen := make(map[string]bool, len(ids))
+    distinct := make([]string, 0, len(ids))
+    for _, id := range ids {
+        if !seen[id] {
+            seen[id] = true
+            distinct = append(distinct, id)
+        }
+    }
+
+    var users []models.PublicUser
+    query := `
+        SELECT id, username, role, bio, profile_image, created_at
+        FROM users
+        WHERE id = ANY($1)
+    `
+    if err := r.db.SelectContext(ctx, &users, query, pq.Array(distinct)); err != nil {
+        return nil, TranslateError(err, "user")
+    }
+
+    byID := make(map[string]*models.PublicUser, len(users))
+    for i := range users {
+        byID[users[i].ID] = &users[i]
+    }
+    return byID, nil
 }
 
-func (r *GigRepository) GetByID(id string) (*models.Gig, error) {
+func (r *GigRepository) GetByID(ctx context.Context, id string) (*models.Gig, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     var gig models.Gig
     query := `
-        SELECT id, title, description, venue_name, venue_address,
-               latitude, longitude, date, start_time, end_time,
-               price, image_url, organizer_id, genres,
+        SELECT id, title, description, venue_id, venue_name, venue_address,
+               latitude, longitude, starts_at, ends_at, timezone,
+               price, image_url, image_thumbnails, organizer_id,
+               status, status_reason, status_changed_at, rescheduled_from, version,
                created_at, updated_at
-        FROM gigs
+        FROM gig_listings
         WHERE id = $1
     `
-    err := r.db.Get(&gig, query, id)
-    if err == sql.ErrNoRows {
-        return nil, nil
-    }
-    if err != nil {
-        return nil, err
+    if err := r.db.GetContext(ctx, &gig, query, id); err != nil {
+        return nil, TranslateError(err, "gig")
     }
 
-    // Fetch organizer
-    var user models.User
-    userQuery := `SELECT id, username, email, role, bio, profile_image, created_at, updated_at FROM users WHERE id = $1`
-    err = r.db.Get(&user, userQuery, gig.OrganizerID)
-    if err == nil {
-        gig.Organizer = &user
+    gigs := []models.Gig{gig}
+    if err := r.loadRelated(ctx, gigs); err != nil {
+        return nil, err
     }
 
-    return &gig, nil
+    return &gigs[0], nil
 }
 
-func (r *GigRepository) GetByOrganizerID(organizerID string) ([]models.Gig, error) {
-    var gigs []models.Gig
+func (r *GigRepository) GetByOrganizerID(ctx context.Context, organizerID string) ([]models.Gig, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    gigs := []models.Gig{}
     query := `
-        SELECT id, title, description, venue_name, venue_address,
-               latitude, longitude, date, start_time, end_time,
-               price, image_url, organizer_id, genres,
+        SELECT id, title, description, venue_id, venue_name, venue_address,
+               latitude, longitude, starts_at, ends_at, timezone,
+               price, image_url, image_thumbnails, organizer_id,
+               status, status_reason, status_changed_at, rescheduled_from, version,
                created_at, updated_at
-        FROM gigs
+        FROM gig_listings
         WHERE organizer_id = $1
-        ORDER BY date DESC, start_time DESC
+        ORDER BY starts_at DESC, id DESC
     `
-    err := r.db.Select(&gigs, query, organizerID)
+    err := r.db.SelectContext(ctx, &gigs, query, organizerID)
     if err != nil {
-        return nil, err
+        return nil, TranslateError(err, "gig")
     }
 
-    // Fetch organizer for each gig
-    if len(gigs) > 0 {
-        var user models.User
-        userQuery := `SELECT id, username, email, role, bio, profile_image, created_at, updated_at FROM users WHERE id = $1`
-        err := r.db.Get(&user, userQuery, organizerID)
-        if err == nil {
-            for i := range gigs {
-                gigs[i].Organizer = &user
-            }
-        }
+    if err := r.loadRelated(ctx, gigs); err != nil {
+        return nil, err
     }
 
     return gigs, nil
 }
 
-func (r *GigRepository) Update(gig *models.Gig) error {
+// Update writes the editable fields if the stored version still equals
+// gig.Version, then bumps it and records a revision by editorID. It fails
+// with ErrStaleGig otherwise.
+func (r *GigRepository) Update(ctx context.Context, gig *models.Gig, editorID string) error {
+    return r.update(ctx, gig, revisionMeta{editorID: editorID, action: models.RevisionUpdated})
+}
+
+// Restore is Update for fields copied back from revision fromVersion.
+func (r *GigRepository) Restore(ctx context.Context, gig *models.Gig, fromVersion int, editorID string) error {
+    return r.update(ctx, gig, revisionMeta{editorID: editorID, action: models.RevisionRestored, restoredFrom: &fromVersion})
+}
+
+func (r *GigRepository) update(ctx context.Context, gig *models.Gig, meta revisionMeta) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return TranslateError(err, "gig")
+    }
+    defer tx.Rollback()
+
     query := `
         UPDATE gigs 
-        SET title = $1, description = $2, venue_name = $3, venue_address = $4,
-            latitude = $5, longitude = $6, date = $7, start_time = $8, 
-            end_time = $9, price = $10, image_url = $11, genres = $12,
-            updated_at = NOW()
-        WHERE id = $13
-        RETURNING updated_at
+        SET title = $1, description = $2, venue_id = $3, starts_at = $4,
+            ends_at = $5, timezone = $6, price = $7, image_url = $8,
+            image_thumbnails = $9, version = version + 1, updated_at = NOW()
+        WHERE id = $10 AND version = $11
+        RETURNING version, updated_at
     `
-    return r.db.QueryRow(
+    err = tx.QueryRowContext(
+        ctx,
         query,
         gig.Title,
         gig.Description,
-        gig.VenueName,
-        gig.VenueAddress,
-        gig.Latitude,
-        gig.Longitude,
-        gig.Date,
-        gig.StartTime,
-        gig.EndTime,
+        gig.VenueID,
+        gig.StartsAt,
+        gig.EndsAt,
+        gig.Timezone,
         gig.Price,
         gig.ImageURL,
-        gig.Genres,
+        gig.ImageThumbnails,
         gig.ID,
-    ).Scan(&gig.UpdatedAt)
+        gig.Version,
+    ).Scan(&gig.Version, &gig.UpdatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return r.missingOr(ctx, gig.ID, ErrStaleGig)
+    }
+    if err != nil {
+        return TranslateError(err, "gig")
+    }
+
+    if err := r.saveGenres(ctx, tx, gig); err != nil {
+        return err
+    }
+    if err := r.saveLineup(ctx, tx, gig); err != nil {
+        return err
+    }
+    if err := r.recordRevision(ctx, tx, gig, meta); err != nil {
+        return err
+    }
+    return TranslateError(tx.Commit(), "gig")
+}
+
+// missingOr explains a conditional write that matched no row: err if the gig
+// exists, so it was the condition that failed, and not found otherwise.
+func (r *GigRepository) missingOr(ctx context.Context, id string, err error) error {
+    var exists bool
+    if err := r.db.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM gigs WHERE id = $1)`, id); err != nil {
+        return TranslateError(err, "gig")
+    }
+    if !exists {
+        return TranslateError(sql.ErrNoRows, "gig")
+    }
+    return err
 }
 
-func (r *GigRepository) Delete(id string) error {
-    query := `DELETE FROM gigs WHERE id = $1`
-    result, err := r.db.Exec(query, id)
+// Transition moves gig from status from to gig.Status, writing the status
+// fields and schedule together and recording a revision by editorID. It
+// fails with ErrGigStatusChanged when the stored status is no longer from.
+func (r *GigRepository) Transition(ctx context.Context, gig *models.Gig, from models.GigStatus, editorID string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return TranslateError(err, "gig")
+    }
+    defer tx.Rollback()
+
+    query := `
+        UPDATE gigs
+        SET status = $1, status_reason = $2, starts_at = $3, ends_at = $4,
+            timezone = $5, rescheduled_from = $6, version = version + 1,
+            status_changed_at = NOW(), updated_at = NOW()
+        WHERE id = $7 AND status = $8
+        RETURNING version, status_changed_at, updated_at
+    `
+    err = tx.QueryRowContext(
+        ctx,
+        query,
+        gig.Status,
+        gig.StatusReason,
+        gig.StartsAt,
+        gig.EndsAt,
+        gig.Timezone,
+        gig.RescheduledFrom,
+        gig.ID,
+        from,
+    ).Scan(&gig.Version, &gig.StatusChangedAt, &gig.UpdatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return r.missingOr(ctx, gig.ID, ErrGigStatusChanged)
+    }
     if err != nil {
+        return TranslateError(err, "gig")
+    }
+
+    meta := revisionMeta{editorID: editorID, action: models.GigRevisionAction(gig.Status)}
+    if err := r.recordRevision(ctx, tx, gig, meta); err != nil {
         return err
     }
-    
+    return TranslateError(tx.Commit(), "gig")
+}
+
+// Delete removes the gig if its stored version equals version, failing with
+// ErrStaleGig otherwise.
+func (r *GigRepository) Delete(ctx context.Context, id string, version int) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `DELETE FROM gigs WHERE id = $1 AND version = $2`
+    result, err := r.db.ExecContext(ctx, query, id, version)
+    if err != nil {
+        return TranslateError(err, "gig")
+    }
+
     rows, err := result.RowsAffected()
     if err != nil {
         return err
     }
-    
+
     if rows == 0 {
-        return sql.ErrNoRows
+        return r.missingOr(ctx, id, ErrStaleGig)
     }
-    
+
     return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sunyi-api/internal/mergepatch"
+	"sunyi-api/internal/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// revisionMeta describes the write a revision records.
+type revisionMeta struct {
+    editorID     string
+    action       models.GigRevisionAction
+    restoredFrom *int
+}
+
+// recordRevision stores gig's current state as a revision, with the fields
+// that changed since the previous one. It runs in the writing transaction so
+// a gig never changes without a revision.
+func (r *GigRepository) recordRevision(ctx context.Context, tx *sqlx.Tx, gig *models.Gig, meta revisionMeta) error {
+    snapshot, err := gig.SnapshotDocument()
+    if err != nil {
+        return err
+    }
+
+    var previous models.JSONDocument
+    err = tx.GetContext(ctx, &previous, `
+        SELECT snapshot FROM gig_revisions
+        WHERE gig_id = $1
+        ORDER BY version DESC
+        LIMIT 1
+    `, gig.ID)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        return TranslateError(err, "revision")
+    }
+
+    var editorID *string
+    if meta.editorID != "" {
+        editorID = &meta.editorID
+    }
+    changes := models.ChangeList(mergepatch.Diff(mergepatch.Document(previous), mergepatch.Document(snapshot)))
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO gig_revisions (gig_id, version, action, editor_id, restored_from, snapshot, changes)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, gig.ID, gig.Version, meta.action, editorID, meta.restoredFrom, snapshot, changes)
+    return TranslateError(err, "revision")
+}
+
+// Revisions returns every revision of a gig, newest first, with editors
+// loaded. Editors whose accounts were deleted are left nil.
+func (r *GigRepository) Revisions(ctx context.Context, gigID string) ([]models.GigRevision, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    revisions := []models.GigRevision{}
+    query := `
+        SELECT id, gig_id, version, action, editor_id, restored_from,
+               snapshot, changes, created_at
+        FROM gig_revisions
+        WHERE gig_id = $1
+        ORDER BY version DESC
+    `
+    if err := r.db.SelectContext(ctx, &revisions, query, gigID); err != nil {
+        return nil, TranslateError(err, "revision")
+    }
+
+    if err := r.loadEditors(ctx, revisions); err != nil {
+        return nil, err
+    }
+    return revisions, nil
+}
+
+// Revision returns the revision of a gig at version.
+func (r *GigRepository) Revision(ctx context.Context, gigID string, version int) (*models.GigRevision, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    var revision models.GigRevision
+    query := `
+        SELECT id, gig_id, version, action, editor_id, restored_from,
+               snapshot, changes, created_at
+        FROM gig_revisions
+        WHERE gig_id = $1 AND version = $2
+    `
+    if err := r.db.GetContext(ctx, &revision, query, gigID, version); err != nil {
+        return nil, TranslateError(err, "revision")
+    }
+
+    revisions := []models.GigRevision{revision}
+    if err := r.loadEditors(ctx, revisions); err != nil {
+        return nil, err
+    }
+    return &revisions[0], nil
+}
+
+func (r *GigRepository) loadEditors(ctx context.Context, revisions []models.GigRevision) error {
+    var ids []string
+    for _, revision := range revisions {
+        if revision.EditorID != nil {
+            ids = append(ids, *revision.EditorID)
+        }
+    }
+    if len(ids) == 0 {
+        return nil
+    }
+
+    byID, err := r.publicUsers(ctx, ids)
+    if err != nil {
+        return err
+    }
+    for i := range revisions {
+        if revisions[i].EditorID != nil {
+            revisions[i].Editor = byID[*revisions[i].EditorID]
+        }
+    }
+    return nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sunyi-api/internal/models"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type LoginAttemptRepository struct {
+    db      *sqlx.DB
+    timeout time.Duration
+
+    // pruned is when Attempt last deleted old attempts.
+    mu     sync.Mutex
+    pruned time.Time
+}
+
+// NewLoginAttemptRepository returns a repository whose queries are bounded
+// by queryTimeout unless the caller's context ends sooner.
+func NewLoginAttemptRepository(db *sqlx.DB, queryTimeout time.Duration) *LoginAttemptRepository {
+    return &LoginAttemptRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *LoginAttemptRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+// Attempt passes decide the failures recorded under each of keys, in order,
+// and unless it returns an error records a new attempt from ip under all of
+// them, returning the attempt's id. Attempts on a key are serialized with
+// an advisory lock, so a burst of them cannot all be decided on the same
+// count. Each key's failures are those within window of its latest one.
+//
+// At most once a minute it also deletes the attempts older than twice
+// window, which can no longer count: the latest failure only matters
+// within window of now, and the others only within window of it. Keys
+// that are never tried again, such as made-up emails, do not pile up.
+func (r *LoginAttemptRepository) Attempt(
+    ctx context.Context,
+    ip string,
+    keys []string,
+    window time.Duration,
+    decide func([]models.LoginFailures) error,
+) (string, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return "", TranslateError(err, "login attempt")
+    }
+    defer tx.Rollback()
+
+    // Locking in a fixed order keeps two attempts from deadlocking. Times
+    // below are taken with clock_timestamp, as NOW() is when the
+    // transaction began, which may be long before it got the locks.
+    sorted := append([]string(nil), keys...)
+    sort.Strings(sorted)
+    for _, key := range sorted {
+        if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key); err != nil {
+            return "", TranslateError(err, "login attempt")
+        }
+    }
+    if r.duePrune() {
+        query := `DELETE FROM login_attempts WHERE attempted_at < clock_timestamp() - make_interval(secs => $1)`
+        if _, err := tx.ExecContext(ctx, query, 2*window.Seconds()); err != nil {
+            return "", TranslateError(err, "login attempt")
+        }
+    }
+
+    failures := make([]models.LoginFailures, len(keys))
+    query := `
+        SELECT COUNT(*) AS count,
+               COALESCE(EXTRACT(EPOCH FROM clock_timestamp() - MAX(attempted_at)), 0)::float8 AS since_last
+        FROM login_attempts
+        WHERE key = $1 AND cleared_at IS NULL
+          AND attempted_at > (
+              SELECT MAX(attempted_at) FROM login_attempts
+              WHERE key = $1 AND cleared_at IS NULL
+          ) - make_interval(secs => $2)
+    `
+    for i, key := range keys {
+        var row struct {
+            Count     int     `db:"count"`
+            SinceLast float64 `db:"since_last"`
+        }
+        if err := tx.GetContext(ctx, &row, query, key, window.Seconds()); err != nil {
+            return "", TranslateError(err, "login attempt")
+        }
+        failures[i] = models.LoginFailures{
+            Count:     row.Count,
+            SinceLast: time.Duration(row.SinceLast * float64(time.Second)),
+        }
+    }
+    if err := decide(failures); err != nil {
+        return "", err
+    }
+
+    var attemptID string
+    query = `
+        WITH attempt AS (SELECT gen_random_uuid() AS id),
+        inserted AS (
+            INSERT INTO login_attempts (attempt_id, key, ip_address, attempted_at)
+            SELECT attempt.id, key, $2, clock_timestamp() FROM attempt, unnest($1::text[]) AS key
+        )
+        SELECT id FROM attempt
+    `
+    if err := tx.GetContext(ctx, &attemptID, query, pq.Array(keys), ip); err != nil {
+        return "", TranslateError(err, "login attempt")
+    }
+    return attemptID, TranslateError(tx.Commit(), "login attempt")
+}
+
+// duePrune reports whether a minute has passed since the last prune, and if
+// so counts this as one.
+func (r *LoginAttemptRepository) duePrune() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    now := time.Now()
+    if now.Sub(r.pruned) < time.Minute {
+        return false
+    }
+    r.pruned = now
+    return true
+}
+
+// Forgive deletes an attempt that turned out not to be a failure.
+func (r *LoginAttemptRepository) Forgive(ctx context.Context, attemptID string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    _, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE attempt_id = $1`, attemptID)
+    return TranslateError(err, "login attempt")
+}
+
+// Clear stops the failures under key from counting, which lifts any lock
+// or backoff on it, and returns how many there were. The records remain.
+func (r *LoginAttemptRepository) Clear(ctx context.Context, key string) (int, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE login_attempts SET cleared_at = NOW() WHERE key = $1 AND cleared_at IS NULL`
+    result, err := r.db.ExecContext(ctx, query, key)
+    if err != nil {
+        return 0, TranslateError(err, "login attempt")
+    }
+    rows, err := result.RowsAffected()
+    return int(rows), err
+}
@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+)
+
+type ArtistStore struct {
+    state *state
+}
+
+func (s *ArtistStore) Create(ctx context.Context, artist *models.Artist) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if artist.CreatedBy != nil {
+        if _, ok := st.users[*artist.CreatedBy]; !ok {
+            return repository.TranslateError(foreignKeyViolation("artists", "artists_created_by_fkey"), "artist")
+        }
+    }
+
+    artist.ID = newID()
+    artist.CreatedAt = st.timestamp()
+    artist.UpdatedAt = artist.CreatedAt
+    st.artists[artist.ID] = cloneArtist(*artist)
+    return nil
+}
+
+func (s *ArtistStore) GetByID(ctx context.Context, id string) (*models.Artist, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    artist, ok := st.artists[id]
+    if !ok {
+        return nil, repository.TranslateError(sql.ErrNoRows, "artist")
+    }
+    artist = cloneArtist(artist)
+    return &artist, nil
+}
+
+func (s *ArtistStore) List(ctx context.Context, filter models.ArtistFilter) ([]models.Artist, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    query := strings.ToLower(filter.Query)
+
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    artists := []models.Artist{}
+    for _, artist := range st.artists {
+        if query != "" && !strings.Contains(strings.ToLower(artist.Name), query) {
+            continue
+        }
+        artists = append(artists, cloneArtist(artist))
+    }
+
+    sort.Slice(artists, func(i, j int) bool {
+        a, b := artists[i], artists[j]
+        if query != "" {
+            aExact, bExact := strings.ToLower(a.Name) == query, strings.ToLower(b.Name) == query
+            if aExact != bExact {
+                return aExact
+            }
+        }
+        if a.Name != b.Name {
+            return a.Name < b.Name
+        }
+        return a.ID < b.ID
+    })
+    if limit := repository.PageLimit(filter.Limit); len(artists) > limit {
+        artists = artists[:limit]
+    }
+    return artists, nil
+}
+
+func (s *ArtistStore) Update(ctx context.Context, artist *models.Artist) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    existing, ok := st.artists[artist.ID]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "artist")
+    }
+
+    // created_by and created_at are not updatable.
+    updated := cloneArtist(*artist)
+    updated.CreatedBy = clonePtr(existing.CreatedBy)
+    updated.CreatedAt = existing.CreatedAt
+    updated.UpdatedAt = st.timestamp()
+    st.artists[artist.ID] = updated
+
+    artist.UpdatedAt = updated.UpdatedAt
+    return nil
+}
+
+func (s *ArtistStore) Delete(ctx context.Context, id string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if _, ok := st.artists[id]; !ok {
+        return repository.TranslateError(sql.ErrNoRows, "artist")
+    }
+    // gig_lineups_artist_id_fkey is ON DELETE RESTRICT.
+    for _, gig := range st.gigs {
+        for _, slot := range gig.Lineup {
+            if slot.ArtistID == id {
+                return repository.ErrArtistInUse
+            }
+        }
+    }
+    delete(st.artists, id)
+    return nil
+}
+
+// checkLineup enforces the gig_lineups constraints and numbers the slots
+// as GigRepository.saveLineup does. Callers hold the lock.
+func (st *state) checkLineup(gig *models.Gig) error {
+    seen := map[string]bool{}
+    for i := range gig.Lineup {
+        slot := &gig.Lineup[i]
+        if _, ok := st.artists[slot.ArtistID]; !ok {
+            return foreignKeyViolation("gig_lineups", "gig_lineups_artist_id_fkey")
+        }
+        if seen[slot.ArtistID] {
+            return uniqueViolation("gig_lineups_pkey")
+        }
+        seen[slot.ArtistID] = true
+        if slot.SetStartsAt != nil && slot.SetEndsAt != nil && !slot.SetEndsAt.After(*slot.SetStartsAt) {
+            return checkViolation("gig_lineups", "gig_lineups_set_ends_check")
+        }
+        slot.Position = i + 1
+    }
+    return nil
+}
+
+// withLineup fills the artist names of a gig's lineup, as the join in
+// GigRepository.loadLineups does. Callers hold the lock.
+func (st *state) withLineup(gig models.Gig) models.Gig {
+    if gig.Lineup == nil {
+        gig.Lineup = []models.LineupSlot{}
+    }
+    for i := range gig.Lineup {
+        gig.Lineup[i].ArtistName = st.artists[gig.Lineup[i].ArtistID].Name
+    }
+    return gig
+}
+
+// containsFold is ILIKE '%' || substr || '%'.
+func containsFold(s, substr string) bool {
+    return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// bills reports whether the gig's lineup has an artist for which match is
+// true. Callers hold the lock.
+func (st *state) bills(gig models.Gig, match func(models.Artist) bool) bool {
+    for _, slot := range gig.Lineup {
+        if match(st.artists[slot.ArtistID]) {
+            return true
+        }
+    }
+    return false
+}
+
+func cloneArtist(artist models.Artist) models.Artist {
+    artist.Bio = clonePtr(artist.Bio)
+    artist.CreatedBy = clonePtr(artist.CreatedBy)
+    return artist
+}
+
+func cloneLineup(lineup []models.LineupSlot) []models.LineupSlot {
+    if lineup == nil {
+        return nil
+    }
+    cloned := make([]models.LineupSlot, len(lineup))
+    for i, slot := range lineup {
+        slot.SetStartsAt = clonePtr(slot.SetStartsAt)
+        slot.SetEndsAt = clonePtr(slot.SetEndsAt)
+        cloned[i] = slot
+    }
+    return cloned
+}
@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sunyi-api/internal/models"
+)
+
+// defaultGenres is the taxonomy the genres migration seeds, so the memory
+// store starts out like a freshly migrated database.
+var defaultGenres = []struct {
+    slug, name, parent string
+    aliases            []string
+}{
+    {"rock", "Rock", "", nil},
+    {"indie", "Indie", "rock", []string{"indie rock"}},
+    {"punk", "Punk", "rock", []string{"punk rock"}},
+    {"metal", "Metal", "rock", []string{"heavy metal"}},
+    {"shoegaze", "Shoegaze", "rock", nil},
+    {"post-rock", "Post-Rock", "rock", nil},
+    {"pop", "Pop", "", nil},
+    {"hip-hop", "Hip Hop", "", []string{"rap"}},
+    {"r-and-b", "R&B", "", []string{"rnb", "rhythm and blues"}},
+    {"soul", "Soul", "", nil},
+    {"electronic", "Electronic", "", []string{"electronica", "edm"}},
+    {"techno", "Techno", "electronic", nil},
+    {"house", "House", "electronic", nil},
+    {"ambient", "Ambient", "electronic", nil},
+    {"drum-and-bass", "Drum & Bass", "electronic", []string{"dnb"}},
+    {"jazz", "Jazz", "", nil},
+    {"blues", "Blues", "", nil},
+    {"folk", "Folk", "", nil},
+    {"reggae", "Reggae", "", nil},
+    {"classical", "Classical", "", nil},
+    {"dangdut", "Dangdut", "", nil},
+}
+
+// seedGenres loads defaultGenres into st. Every genre's slug and name are
+// aliases of it too.
+func (st *state) seedGenres() {
+    for _, g := range defaultGenres {
+        genre := models.Genre{Slug: g.slug, Name: g.name}
+        if g.parent != "" {
+            parent := g.parent
+            genre.Parent = &parent
+        }
+        st.genres[g.slug] = genre
+        for _, alias := range append([]string{g.slug, g.name}, g.aliases...) {
+            st.genreAliases[models.GenreKey(alias)] = g.slug
+        }
+    }
+}
+
+type GenreStore struct {
+    state *state
+}
+
+func (s *GenreStore) List(ctx context.Context) ([]models.Genre, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    now := st.now()
+    genres := make([]models.Genre, 0, len(st.genres))
+    for _, genre := range st.genres {
+        tree := st.genreTree(genre.Slug)
+        genre.Parent = clonePtr(genre.Parent)
+        genre.UpcomingGigs = 0
+        for _, gig := range st.gigs {
+            if gig.Status != models.GigStatusDraft &&
+                (!endOf(gig).Before(now) || gig.Status == models.GigStatusPostponed) &&
+                taggedWith(gig, tree) {
+                genre.UpcomingGigs++
+            }
+        }
+        genres = append(genres, genre)
+    }
+
+    sort.Slice(genres, func(i, j int) bool {
+        if genres[i].Name != genres[j].Name {
+            return genres[i].Name < genres[j].Name
+        }
+        return genres[i].Slug < genres[j].Slug
+    })
+    return genres, nil
+}
+
+func (s *GenreStore) Resolve(ctx context.Context, keys []string) (map[string]string, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    slugs := map[string]string{}
+    for _, key := range keys {
+        if slug, ok := st.genreAliases[key]; ok {
+            slugs[key] = slug
+        }
+    }
+    return slugs, nil
+}
+
+// genreTree returns slug and the slugs of all its sub-genres, as
+// genreTreeSQL does. Callers hold the lock.
+func (st *state) genreTree(slug string) map[string]bool {
+    tree := map[string]bool{slug: true}
+    for grew := true; grew; {
+        grew = false
+        for _, genre := range st.genres {
+            if genre.Parent != nil && tree[*genre.Parent] && !tree[genre.Slug] {
+                tree[genre.Slug] = true
+                grew = true
+            }
+        }
+    }
+    return tree
+}
+
+// inGenre reports whether the gig is tagged with the genre any alias of
+// which has the given key, or with one of its sub-genres. Callers hold the
+// lock.
+func (st *state) inGenre(gig models.Gig, key string) bool {
+    slug, ok := st.genreAliases[key]
+    if !ok {
+        return false
+    }
+    return taggedWith(gig, st.genreTree(slug))
+}
+
+func taggedWith(gig models.Gig, slugs map[string]bool) bool {
+    for _, slug := range gig.Genres {
+        if slugs[slug] {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sunyi-api/internal/mergepatch"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+)
+
+// revisionMeta mirrors the repository's: who made a write and why.
+type revisionMeta struct {
+    editorID     string
+    action       models.GigRevisionAction
+    restoredFrom *int
+}
+
+// newRevision builds the revision recording gig's current state, diffed
+// against the gig's latest revision. Callers hold the lock.
+func (st *state) newRevision(gig *models.Gig, meta revisionMeta) (models.GigRevision, error) {
+    snapshot, err := gig.SnapshotDocument()
+    if err != nil {
+        return models.GigRevision{}, err
+    }
+
+    var previous models.JSONDocument
+    if revisions := st.revisions[gig.ID]; len(revisions) > 0 {
+        previous = revisions[len(revisions)-1].Snapshot
+    }
+
+    revision := models.GigRevision{
+        ID:           newID(),
+        GigID:        gig.ID,
+        Version:      gig.Version,
+        Action:       meta.action,
+        RestoredFrom: clonePtr(meta.restoredFrom),
+        Snapshot:     snapshot,
+        Changes:      mergepatch.Diff(mergepatch.Document(previous), mergepatch.Document(snapshot)),
+        CreatedAt:    st.timestamp(),
+    }
+    if meta.editorID != "" {
+        editorID := meta.editorID
+        revision.EditorID = &editorID
+    }
+    return revision, nil
+}
+
+func (s *GigStore) Revisions(ctx context.Context, gigID string) ([]models.GigRevision, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    stored := st.revisions[gigID]
+    revisions := make([]models.GigRevision, 0, len(stored))
+    for i := len(stored) - 1; i >= 0; i-- {
+        revisions = append(revisions, st.withEditor(stored[i]))
+    }
+    return revisions, nil
+}
+
+func (s *GigStore) Revision(ctx context.Context, gigID string, version int) (*models.GigRevision, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    for _, revision := range st.revisions[gigID] {
+        if revision.Version == version {
+            revision = st.withEditor(revision)
+            return &revision, nil
+        }
+    }
+    return nil, repository.TranslateError(sql.ErrNoRows, "revision")
+}
+
+// withEditor copies a revision and loads its editor, mirroring
+// GigRepository.loadEditors. Callers hold the lock.
+func (st *state) withEditor(revision models.GigRevision) models.GigRevision {
+    revision.EditorID = clonePtr(revision.EditorID)
+    revision.RestoredFrom = clonePtr(revision.RestoredFrom)
+    revision.Changes = append(models.ChangeList{}, revision.Changes...)
+    if revision.EditorID != nil {
+        if user, ok := st.users[*revision.EditorID]; ok {
+            editor := user.Public()
+            revision.Editor = &editor
+        }
+    }
+    return revision
+}
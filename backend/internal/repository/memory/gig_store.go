@@ -0,0 +1,455 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sunyi-api/internal/geo"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+	"time"
+)
+
+type GigStore struct {
+    state *state
+}
+
+func (s *GigStore) Create(ctx context.Context, gig *models.Gig) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if gig.Status == "" {
+        gig.Status = models.GigStatusDraft
+    }
+    if err := st.checkGig(gig); err != nil {
+        return repository.TranslateError(err, "gig")
+    }
+
+    gig.ID = newID()
+    gig.Version = 1
+    gig.CreatedAt = st.timestamp()
+    gig.UpdatedAt = gig.CreatedAt
+    revision, err := st.newRevision(gig, revisionMeta{editorID: gig.OrganizerID, action: models.RevisionCreated})
+    if err != nil {
+        return err
+    }
+    st.gigs[gig.ID] = cloneGig(*gig)
+    st.revisions[gig.ID] = append(st.revisions[gig.ID], revision)
+    return nil
+}
+
+func (s *GigStore) List(ctx context.Context, filter models.GigFilter) (*models.GigListResponse, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    var cursor *repository.GigCursor
+    if filter.Cursor != "" {
+        cur, err := repository.DecodeGigCursor(filter.Cursor)
+        if err != nil {
+            return nil, err
+        }
+        cursor = cur
+    }
+    limit := repository.PageLimit(filter.Limit)
+
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    matched := st.filterGigs(filter)
+    sortByDate(matched)
+
+    result := &models.GigListResponse{Total: len(matched), Data: []models.Gig{}}
+    for _, gig := range matched {
+        if cursor != nil && !beforeCursor(gig, cursor) {
+            continue
+        }
+        if len(result.Data) == limit {
+            next := repository.EncodeGigCursor(result.Data[limit-1])
+            result.NextCursor = &next
+            break
+        }
+        result.Data = append(result.Data, gig)
+    }
+
+    if err := st.loadOrganizers(result.Data); err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+func (s *GigStore) Nearby(ctx context.Context, filter models.NearbyGigFilter) ([]models.Gig, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    radius := filter.RadiusKm
+    if radius <= 0 {
+        radius = repository.DefaultNearbyRadiusKm
+    }
+    limit := repository.PageLimit(filter.Limit)
+    lat, lng := *filter.Latitude, *filter.Longitude
+
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    gigs := []models.Gig{}
+    for _, gig := range st.filterGigs(filter.GigFilter) {
+        distance := geo.HaversineKm(lat, lng, gig.Latitude, gig.Longitude)
+        if distance <= radius {
+            gig.DistanceKm = &distance
+            gigs = append(gigs, gig)
+        }
+    }
+
+    if filter.Sort == models.NearbySortDate {
+        sort.SliceStable(gigs, func(i, j int) bool {
+            if !gigs[i].StartsAt.Equal(gigs[j].StartsAt) {
+                return gigs[i].StartsAt.After(gigs[j].StartsAt)
+            }
+            if *gigs[i].DistanceKm != *gigs[j].DistanceKm {
+                return *gigs[i].DistanceKm < *gigs[j].DistanceKm
+            }
+            return gigs[i].ID > gigs[j].ID
+        })
+    } else {
+        sort.SliceStable(gigs, func(i, j int) bool {
+            if *gigs[i].DistanceKm != *gigs[j].DistanceKm {
+                return *gigs[i].DistanceKm < *gigs[j].DistanceKm
+            }
+            return lessKey(gigs[j], gigs[i])
+        })
+    }
+    if len(gigs) > limit {
+        gigs = gigs[:limit]
+    }
+
+    if err := st.loadOrganizers(gigs); err != nil {
+        return nil, err
+    }
+    return gigs, nil
+}
+
+func (s *GigStore) InViewport(ctx context.Context, filter models.MapGigFilter) ([]models.Gig, bool, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, false, err
+    }
+    box := geo.Box{MinLat: *filter.MinLat, MaxLat: *filter.MaxLat, MinLng: *filter.MinLng, MaxLng: *filter.MaxLng}
+
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    gigs := []models.Gig{}
+    for _, gig := range st.filterGigs(filter.GigFilter) {
+        if box.Contains(gig.Latitude, gig.Longitude) {
+            gigs = append(gigs, gig)
+        }
+    }
+    sortByDate(gigs)
+    truncated := len(gigs) > repository.MaxViewportGigs
+    if truncated {
+        gigs = gigs[:repository.MaxViewportGigs]
+    }
+    return gigs, truncated, nil
+}
+
+func (s *GigStore) GetByID(ctx context.Context, id string) (*models.Gig, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    gig, ok := st.gigs[id]
+    if !ok {
+        return nil, repository.TranslateError(sql.ErrNoRows, "gig")
+    }
+    gigs := []models.Gig{st.withLineup(st.withVenue(cloneGig(gig)))}
+    if err := st.loadOrganizers(gigs); err != nil {
+        return nil, err
+    }
+    return &gigs[0], nil
+}
+
+func (s *GigStore) GetByOrganizerID(ctx context.Context, organizerID string) ([]models.Gig, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    // Like the SQL query, this returns drafts too.
+    gigs := st.filterGigs(models.GigFilter{OrganizerID: organizerID, ViewerID: organizerID})
+    if gigs == nil {
+        gigs = []models.Gig{}
+    }
+    sortByDate(gigs)
+
+    if err := st.loadOrganizers(gigs); err != nil {
+        return nil, err
+    }
+    return gigs, nil
+}
+
+func (s *GigStore) Update(ctx context.Context, gig *models.Gig, editorID string) error {
+    return s.update(ctx, gig, revisionMeta{editorID: editorID, action: models.RevisionUpdated})
+}
+
+func (s *GigStore) Restore(ctx context.Context, gig *models.Gig, fromVersion int, editorID string) error {
+    return s.update(ctx, gig, revisionMeta{editorID: editorID, action: models.RevisionRestored, restoredFrom: &fromVersion})
+}
+
+func (s *GigStore) update(ctx context.Context, gig *models.Gig, meta revisionMeta) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    existing, ok := st.gigs[gig.ID]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "gig")
+    }
+    if existing.Version != gig.Version {
+        return repository.ErrStaleGig
+    }
+    if err := st.checkGig(gig); err != nil {
+        return repository.TranslateError(err, "gig")
+    }
+
+    // organizer_id, created_at and the status fields are not updatable here.
+    updated := cloneGig(*gig)
+    updated.OrganizerID = existing.OrganizerID
+    updated.CreatedAt = existing.CreatedAt
+    updated.Status = existing.Status
+    updated.StatusReason = clonePtr(existing.StatusReason)
+    updated.StatusChangedAt = clonePtr(existing.StatusChangedAt)
+    updated.RescheduledFrom = clonePtr(existing.RescheduledFrom)
+    updated.Version = existing.Version + 1
+    updated.UpdatedAt = st.timestamp()
+    revision, err := st.newRevision(&updated, meta)
+    if err != nil {
+        return err
+    }
+    st.gigs[gig.ID] = updated
+    st.revisions[gig.ID] = append(st.revisions[gig.ID], revision)
+
+    gig.Version = updated.Version
+    gig.UpdatedAt = updated.UpdatedAt
+    return nil
+}
+
+func (s *GigStore) Transition(ctx context.Context, gig *models.Gig, from models.GigStatus, editorID string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    existing, ok := st.gigs[gig.ID]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "gig")
+    }
+    if existing.Status != from {
+        return repository.ErrGigStatusChanged
+    }
+
+    updated := existing
+    updated.Status = gig.Status
+    updated.StatusReason = clonePtr(gig.StatusReason)
+    updated.StartsAt = gig.StartsAt
+    updated.EndsAt = clonePtr(gig.EndsAt)
+    updated.Timezone = gig.Timezone
+    updated.RescheduledFrom = clonePtr(gig.RescheduledFrom)
+    if err := st.checkGig(&updated); err != nil {
+        return repository.TranslateError(err, "gig")
+    }
+    now := st.timestamp()
+    updated.StatusChangedAt = &now
+    updated.Version++
+    updated.UpdatedAt = now
+    revision, err := st.newRevision(&updated, revisionMeta{editorID: editorID, action: models.GigRevisionAction(updated.Status)})
+    if err != nil {
+        return err
+    }
+    st.gigs[gig.ID] = cloneGig(updated)
+    st.revisions[gig.ID] = append(st.revisions[gig.ID], revision)
+
+    gig.Version = updated.Version
+    gig.StatusChangedAt = clonePtr(updated.StatusChangedAt)
+    gig.UpdatedAt = now
+    return nil
+}
+
+func (s *GigStore) Delete(ctx context.Context, id string, version int) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    existing, ok := st.gigs[id]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "gig")
+    }
+    if existing.Version != version {
+        return repository.ErrStaleGig
+    }
+    st.deleteGig(id)
+    return nil
+}
+
+// deleteGig removes a gig and, like ON DELETE CASCADE, its revisions.
+// Callers hold the lock.
+func (st *state) deleteGig(id string) {
+    delete(st.gigs, id)
+    delete(st.revisions, id)
+}
+
+// checkGig enforces the gigs table constraints. Callers hold the lock.
+func (st *state) checkGig(gig *models.Gig) error {
+    if _, ok := st.users[gig.OrganizerID]; !ok {
+        return foreignKeyViolation("gigs", "gigs_organizer_id_fkey")
+    }
+    if _, ok := st.venues[gig.VenueID]; !ok {
+        return foreignKeyViolation("gigs", "gigs_venue_id_fkey")
+    }
+    for _, slug := range gig.Genres {
+        if _, ok := st.genres[slug]; !ok {
+            return foreignKeyViolation("gig_genres", "gig_genres_genre_slug_fkey")
+        }
+    }
+    if err := st.checkLineup(gig); err != nil {
+        return err
+    }
+    switch gig.Status {
+    case models.GigStatusDraft, models.GigStatusPublished, models.GigStatusCancelled,
+        models.GigStatusPostponed, models.GigStatusRescheduled:
+    default:
+        return checkViolation("gigs", "gigs_status_check")
+    }
+    if gig.EndsAt != nil && !gig.EndsAt.After(gig.StartsAt) {
+        return checkViolation("gigs", "gigs_ends_after_start_check")
+    }
+    return nil
+}
+
+// filterGigs returns copies of the gigs matching filter, with their venue
+// fields and lineup filled, unordered. Callers hold the lock.
+func (st *state) filterGigs(filter models.GigFilter) []models.Gig {
+    now := st.now()
+
+    var gigs []models.Gig
+    for _, gig := range st.gigs {
+        date := localDate(gig)
+        price := 0.0
+        if gig.Price != nil {
+            price = *gig.Price
+        }
+        switch {
+        case gig.Status == models.GigStatusDraft && gig.OrganizerID != filter.ViewerID,
+            filter.Status != "" && gig.Status != filter.Status,
+            filter.DateFrom != "" && date < filter.DateFrom,
+            filter.DateTo != "" && date > filter.DateTo,
+            filter.Upcoming && endOf(gig).Before(now) && gig.Status != models.GigStatusPostponed,
+            filter.Genre != "" && !st.inGenre(gig, models.GenreKey(filter.Genre)),
+            filter.PriceMin != nil && price < *filter.PriceMin,
+            filter.PriceMax != nil && price > *filter.PriceMax,
+            filter.OrganizerID != "" && gig.OrganizerID != filter.OrganizerID,
+            filter.VenueID != "" && gig.VenueID != filter.VenueID,
+            filter.ArtistID != "" && !st.bills(gig, func(a models.Artist) bool { return a.ID == filter.ArtistID }),
+            filter.Artist != "" && !st.bills(gig, func(a models.Artist) bool { return containsFold(a.Name, filter.Artist) }):
+            continue
+        }
+        gigs = append(gigs, st.withLineup(st.withVenue(cloneGig(gig))))
+    }
+    return gigs
+}
+
+// loadOrganizers mirrors GigRepository.loadOrganizers. Callers hold the lock.
+func (st *state) loadOrganizers(gigs []models.Gig) error {
+    for i := range gigs {
+        user, ok := st.users[gigs[i].OrganizerID]
+        if !ok {
+            return fmt.Errorf("load organizers: organizer %s of gig %s not found", gigs[i].OrganizerID, gigs[i].ID)
+        }
+        organizer := user.Public()
+        gigs[i].Organizer = &organizer
+    }
+    return nil
+}
+
+// localDate mirrors (starts_at AT TIME ZONE timezone)::date.
+func localDate(gig models.Gig) string {
+    return gig.StartsAt.In(gig.Location()).Format(models.LocalDateLayout)
+}
+
+// endOf mirrors COALESCE(ends_at, starts_at).
+func endOf(gig models.Gig) time.Time {
+    if gig.EndsAt != nil {
+        return *gig.EndsAt
+    }
+    return gig.StartsAt
+}
+
+// sortByDate orders like ORDER BY starts_at DESC, id DESC.
+func sortByDate(gigs []models.Gig) {
+    sort.Slice(gigs, func(i, j int) bool {
+        return lessKey(gigs[j], gigs[i])
+    })
+}
+
+// beforeCursor reports whether the gig sorts after the cursor row, i.e.
+// (starts_at, id) < cursor.
+func beforeCursor(gig models.Gig, cur *repository.GigCursor) bool {
+    return lessKey(gig, models.Gig{StartsAt: cur.StartsAt, ID: cur.ID})
+}
+
+// lessKey compares (starts_at, id) row values.
+func lessKey(a, b models.Gig) bool {
+    if !a.StartsAt.Equal(b.StartsAt) {
+        return a.StartsAt.Before(b.StartsAt)
+    }
+    return a.ID < b.ID
+}
+
+// cloneGig copies a gig so callers never share pointers with the store.
+func cloneGig(gig models.Gig) models.Gig {
+    gig.Genres = append(models.StringArray{}, gig.Genres...)
+    gig.EndsAt = clonePtr(gig.EndsAt)
+    gig.StatusReason = clonePtr(gig.StatusReason)
+    gig.StatusChangedAt = clonePtr(gig.StatusChangedAt)
+    gig.RescheduledFrom = clonePtr(gig.RescheduledFrom)
+    gig.Price = clonePtr(gig.Price)
+    gig.ImageURL = clonePtr(gig.ImageURL)
+    if gig.ImageThumbnails != nil {
+        thumbnails := models.ImageVariants{}
+        for size, url := range gig.ImageThumbnails {
+            thumbnails[size] = url
+        }
+        gig.ImageThumbnails = thumbnails
+    }
+    gig.Lineup = cloneLineup(gig.Lineup)
+    gig.Organizer = nil
+    gig.DistanceKm = nil
+    return gig
+}
+
+func clonePtr[T any](p *T) *T {
+    if p == nil {
+        return nil
+    }
+    v := *p
+    return &v
+}
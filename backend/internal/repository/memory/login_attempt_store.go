@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"context"
+	"sunyi-api/internal/models"
+	"time"
+)
+
+// loginAttempt is a row of login_attempts under one key.
+type loginAttempt struct {
+    id string
+    at time.Time
+}
+
+type LoginAttemptStore struct {
+    state *state
+    // swept is when Attempt last dropped old attempts.
+    swept time.Time
+}
+
+// NewLoginAttemptStore returns a store of sign-in attempts on its own, for
+// servers that throttle logins per process instead of in Postgres.
+func NewLoginAttemptStore() *LoginAttemptStore {
+    return &LoginAttemptStore{
+        state: &state{
+            now:           time.Now,
+            loginAttempts: map[string][]loginAttempt{},
+        },
+    }
+}
+
+// Attempt decides and records under the one lock, which serializes
+// attempts the way the advisory locks do in Postgres. Like the Postgres
+// repository, it drops attempts older than twice window at most once a
+// minute.
+func (s *LoginAttemptStore) Attempt(
+    ctx context.Context,
+    ip string,
+    keys []string,
+    window time.Duration,
+    decide func([]models.LoginFailures) error,
+) (string, error) {
+    if err := ctx.Err(); err != nil {
+        return "", err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    now := st.timestamp()
+    failures := make([]models.LoginFailures, len(keys))
+    for i, key := range keys {
+        attempts := st.loginAttempts[key]
+        if len(attempts) == 0 {
+            continue
+        }
+        last := attempts[len(attempts)-1].at
+        for _, attempt := range attempts {
+            if attempt.at.After(last.Add(-window)) {
+                failures[i].Count++
+            }
+        }
+        failures[i].SinceLast = now.Sub(last)
+    }
+    if err := decide(failures); err != nil {
+        return "", err
+    }
+
+    id := newID()
+    for _, key := range keys {
+        st.loginAttempts[key] = append(st.loginAttempts[key], loginAttempt{id: id, at: now})
+    }
+    if now.Sub(s.swept) >= time.Minute {
+        s.sweep(now.Add(-2 * window))
+        s.swept = now
+    }
+    return id, nil
+}
+
+// sweep drops the attempts from before cutoff. Callers hold the lock.
+func (s *LoginAttemptStore) sweep(cutoff time.Time) {
+    st := s.state
+    for key, attempts := range st.loginAttempts {
+        // Attempts are in order, so the first one kept ends the old ones.
+        i := 0
+        for i < len(attempts) && !attempts[i].at.After(cutoff) {
+            i++
+        }
+        if i == len(attempts) {
+            delete(st.loginAttempts, key)
+        } else {
+            st.loginAttempts[key] = attempts[i:]
+        }
+    }
+}
+
+func (s *LoginAttemptStore) Forgive(ctx context.Context, attemptID string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    for key, attempts := range st.loginAttempts {
+        kept := attempts[:0]
+        for _, attempt := range attempts {
+            if attempt.id != attemptID {
+                kept = append(kept, attempt)
+            }
+        }
+        if len(kept) == 0 {
+            delete(st.loginAttempts, key)
+        } else {
+            st.loginAttempts[key] = kept
+        }
+    }
+    return nil
+}
+
+func (s *LoginAttemptStore) Clear(ctx context.Context, key string) (int, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    cleared := len(st.loginAttempts[key])
+    delete(st.loginAttempts, key)
+    return cleared, nil
+}
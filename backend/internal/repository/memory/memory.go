@@ -0,0 +1,132 @@
+// Package memory implements the repository stores in process. It mirrors
+// the Postgres repositories closely enough for handler tests: the same
+// ordering and paging, and the same apperr values for missing rows and
+// constraint violations, produced by passing the errors Postgres would raise
+// through repository.TranslateError.
+package memory
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sunyi-api/internal/models"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Store holds every in-memory table behind one lock so that cross-table
+// rules such as ON DELETE CASCADE hold.
+type Store struct {
+    Users          *UserStore
+    Gigs           *GigStore
+    Venues         *VenueStore
+    Artists        *ArtistStore
+    Genres         *GenreStore
+    Sessions       *SessionStore
+    PasswordResets *PasswordResetStore
+    LoginAttempts  *LoginAttemptStore
+
+    state *state
+}
+
+type state struct {
+    mu      sync.RWMutex
+    now     func() time.Time
+    users   map[string]models.User
+    gigs    map[string]models.Gig
+    venues  map[string]models.Venue
+    artists map[string]models.Artist
+    // genres is keyed by slug and genreAliases maps alias keys to slugs.
+    genres       map[string]models.Genre
+    genreAliases map[string]string
+    // revisions holds each gig's revisions in version order.
+    revisions map[string][]models.GigRevision
+    sessions  map[string]models.Session
+    // refreshTokens is keyed by token hash.
+    refreshTokens map[string]refreshToken
+    // passwordResets is keyed by token hash.
+    passwordResets map[string]passwordReset
+    // loginAttempts holds the sign-in attempts under each throttling key,
+    // oldest first.
+    loginAttempts map[string][]loginAttempt
+}
+
+func New() *Store {
+    st := &state{
+        now:            time.Now,
+        users:          map[string]models.User{},
+        gigs:           map[string]models.Gig{},
+        venues:         map[string]models.Venue{},
+        artists:        map[string]models.Artist{},
+        genres:         map[string]models.Genre{},
+        genreAliases:   map[string]string{},
+        revisions:      map[string][]models.GigRevision{},
+        sessions:       map[string]models.Session{},
+        refreshTokens:  map[string]refreshToken{},
+        passwordResets: map[string]passwordReset{},
+        loginAttempts:  map[string][]loginAttempt{},
+    }
+    st.seedGenres()
+    return &Store{
+        Users:          &UserStore{state: st},
+        Gigs:           &GigStore{state: st},
+        Venues:         &VenueStore{state: st},
+        Artists:        &ArtistStore{state: st},
+        Genres:         &GenreStore{state: st},
+        Sessions:       &SessionStore{state: st},
+        PasswordResets: &PasswordResetStore{state: st},
+        LoginAttempts:  &LoginAttemptStore{state: st},
+        state:          st,
+    }
+}
+
+// SetClock replaces the time source used for created_at, updated_at,
+// "upcoming" comparisons and session expiry.
+func (s *Store) SetClock(now func() time.Time) {
+    s.state.mu.Lock()
+    defer s.state.mu.Unlock()
+    s.state.now = now
+}
+
+// newID returns a random version 4 UUID, like gen_random_uuid().
+func newID() string {
+    var b [16]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        panic(err)
+    }
+    b[6] = b[6]&0x0f | 0x40
+    b[8] = b[8]&0x3f | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// timestamp mimics NOW() on a TIMESTAMPTZ column, which keeps microseconds.
+func (st *state) timestamp() time.Time {
+    return st.now().UTC().Truncate(time.Microsecond)
+}
+
+func uniqueViolation(constraint string) error {
+    return &pq.Error{
+        Code:       "23505",
+        Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+        Constraint: constraint,
+    }
+}
+
+func foreignKeyViolation(table, constraint string) error {
+    return &pq.Error{
+        Code:       "23503",
+        Message:    fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+        Table:      table,
+        Constraint: constraint,
+    }
+}
+
+func checkViolation(table, constraint string) error {
+    return &pq.Error{
+        Code:       "23514",
+        Message:    fmt.Sprintf("new row for relation %q violates check constraint %q", table, constraint),
+        Table:      table,
+        Constraint: constraint,
+    }
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sunyi-api/internal/repository"
+	"time"
+)
+
+// passwordReset is a row of password_resets, keyed by its hash.
+type passwordReset struct {
+    userID    string
+    createdAt time.Time
+    expiresAt time.Time
+    used      bool
+}
+
+type PasswordResetStore struct {
+    state *state
+}
+
+func (s *PasswordResetStore) Create(ctx context.Context, userID, tokenHash string, ttl, interval time.Duration) (bool, error) {
+    if err := ctx.Err(); err != nil {
+        return false, err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if _, ok := st.users[userID]; !ok {
+        return false, repository.TranslateError(foreignKeyViolation("password_resets", "password_resets_user_id_fkey"), "password reset")
+    }
+    if _, ok := st.passwordResets[tokenHash]; ok {
+        return false, repository.TranslateError(uniqueViolation("password_resets_pkey"), "password reset")
+    }
+    now := st.timestamp()
+    for _, reset := range st.passwordResets {
+        if reset.userID == userID && reset.createdAt.After(now.Add(-interval)) {
+            return false, nil
+        }
+    }
+
+    st.passwordResets[tokenHash] = passwordReset{
+        userID:    userID,
+        createdAt: now,
+        expiresAt: now.Add(ttl),
+    }
+    return true, nil
+}
+
+func (s *PasswordResetStore) Reset(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+    if err := ctx.Err(); err != nil {
+        return "", err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    reset, ok := st.passwordResets[tokenHash]
+    if !ok || reset.used || !reset.expiresAt.After(st.now()) {
+        return "", repository.TranslateError(sql.ErrNoRows, "password reset")
+    }
+
+    now := st.timestamp()
+    user := st.users[reset.userID]
+    user.PasswordHash = passwordHash
+    user.UpdatedAt = now
+    st.users[user.ID] = user
+    for hash, other := range st.passwordResets {
+        if other.userID == user.ID {
+            other.used = true
+            st.passwordResets[hash] = other
+        }
+    }
+    for id, session := range st.sessions {
+        if session.UserID == user.ID && session.RevokedAt == nil {
+            session.RevokedAt = &now
+            st.sessions[id] = session
+        }
+    }
+    return user.ID, nil
+}
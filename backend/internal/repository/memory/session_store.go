@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+	"time"
+)
+
+// refreshToken is a row of refresh_tokens, keyed by its hash.
+type refreshToken struct {
+    sessionID string
+    rotated   bool
+}
+
+type SessionStore struct {
+    state *state
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *models.Session, tokenHash string, ttl time.Duration) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if _, ok := st.users[session.UserID]; !ok {
+        return repository.TranslateError(foreignKeyViolation("sessions", "sessions_user_id_fkey"), "session")
+    }
+    if _, ok := st.refreshTokens[tokenHash]; ok {
+        return repository.TranslateError(uniqueViolation("refresh_tokens_pkey"), "session")
+    }
+
+    session.ID = newID()
+    session.CreatedAt = st.timestamp()
+    session.LastUsedAt = session.CreatedAt
+    session.ExpiresAt = session.CreatedAt.Add(ttl)
+    session.RevokedAt = nil
+    st.sessions[session.ID] = *session
+    st.refreshTokens[tokenHash] = refreshToken{sessionID: session.ID}
+    return nil
+}
+
+func (s *SessionStore) Rotate(ctx context.Context, tokenHash, newTokenHash string, ttl time.Duration) (*models.Session, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    token, ok := st.refreshTokens[tokenHash]
+    if !ok {
+        return nil, repository.TranslateError(sql.ErrNoRows, "refresh token")
+    }
+    session := st.sessions[token.sessionID]
+    if !st.live(session) {
+        return nil, repository.ErrSessionEnded
+    }
+    if token.rotated {
+        now := st.timestamp()
+        session.RevokedAt = &now
+        st.sessions[session.ID] = session
+        return nil, repository.ErrRefreshTokenReused
+    }
+    if _, ok := st.refreshTokens[newTokenHash]; ok {
+        return nil, repository.TranslateError(uniqueViolation("refresh_tokens_pkey"), "session")
+    }
+
+    token.rotated = true
+    st.refreshTokens[tokenHash] = token
+    st.refreshTokens[newTokenHash] = refreshToken{sessionID: session.ID}
+    session.LastUsedAt = st.timestamp()
+    session.ExpiresAt = session.LastUsedAt.Add(ttl)
+    st.sessions[session.ID] = session
+    return &session, nil
+}
+
+func (s *SessionStore) Active(ctx context.Context, id string) (bool, error) {
+    if err := ctx.Err(); err != nil {
+        return false, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    session, ok := st.sessions[id]
+    return ok && st.live(session), nil
+}
+
+func (s *SessionStore) ListActive(ctx context.Context, userID string) ([]models.Session, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    sessions := []models.Session{}
+    for _, session := range st.sessions {
+        if session.UserID == userID && st.live(session) {
+            sessions = append(sessions, session)
+        }
+    }
+    sort.Slice(sessions, func(i, j int) bool {
+        if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+            return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+        }
+        return sessions[i].ID < sessions[j].ID
+    })
+    return sessions, nil
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, userID, id string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    session, ok := st.sessions[id]
+    if !ok || session.UserID != userID || !st.live(session) {
+        return repository.TranslateError(sql.ErrNoRows, "session")
+    }
+    now := st.timestamp()
+    session.RevokedAt = &now
+    st.sessions[id] = session
+    return nil
+}
+
+func (s *SessionStore) RevokeAll(ctx context.Context, userID, exceptID string) (int, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    now := st.timestamp()
+    revoked := 0
+    for id, session := range st.sessions {
+        if session.UserID == userID && id != exceptID && st.live(session) {
+            session.RevokedAt = &now
+            st.sessions[id] = session
+            revoked++
+        }
+    }
+    return revoked, nil
+}
+
+// live reports whether a session is neither revoked nor expired. Callers
+// hold the lock.
+func (st *state) live(session models.Session) bool {
+    return session.ID != "" && session.RevokedAt == nil && session.ExpiresAt.After(st.now())
+}
+
+// deleteSessions removes the user's sessions and their refresh tokens, as
+// ON DELETE CASCADE does. Callers hold the write lock.
+func (st *state) deleteSessions(userID string) {
+    for hash, token := range st.refreshTokens {
+        if st.sessions[token.sessionID].UserID == userID {
+            delete(st.refreshTokens, hash)
+        }
+    }
+    for id, session := range st.sessions {
+        if session.UserID == userID {
+            delete(st.sessions, id)
+        }
+    }
+}
@@ -0,0 +1,240 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+	"time"
+)
+
+type UserStore struct {
+    state *state
+}
+
+func (s *UserStore) Create(ctx context.Context, user *models.User) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if err := st.checkUser(user, ""); err != nil {
+        return repository.TranslateError(err, "user")
+    }
+
+    user.ID = newID()
+    user.CreatedAt = st.timestamp()
+    user.UpdatedAt = user.CreatedAt
+    st.users[user.ID] = *user
+    return nil
+}
+
+func (s *UserStore) GetByID(ctx context.Context, id string) (*models.User, error) {
+    return s.find(ctx, func(u models.User) bool { return u.ID == id })
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+    return s.find(ctx, func(u models.User) bool { return u.Email == email })
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+    return s.find(ctx, func(u models.User) bool { return u.Username == username })
+}
+
+func (s *UserStore) Update(ctx context.Context, user *models.User) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    existing, ok := st.users[user.ID]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "user")
+    }
+    if err := st.checkUser(user, user.ID); err != nil {
+        return repository.TranslateError(err, "user")
+    }
+
+    existing.Username = user.Username
+    existing.Email = user.Email
+    existing.Role = user.Role
+    existing.Bio = user.Bio
+    existing.ProfileImage = user.ProfileImage
+    existing.UpdatedAt = st.timestamp()
+    st.users[user.ID] = existing
+
+    user.UpdatedAt = existing.UpdatedAt
+    return nil
+}
+
+func (s *UserStore) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    user, ok := st.users[id]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "user")
+    }
+    user.PasswordHash = passwordHash
+    user.UpdatedAt = st.timestamp()
+    st.users[id] = user
+    return nil
+}
+
+// Delete removes the user and, like ON DELETE CASCADE, their gigs,
+// sessions and password reset tokens.
+func (s *UserStore) Delete(ctx context.Context, id string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    delete(st.users, id)
+    st.deleteSessions(id)
+    for hash, reset := range st.passwordResets {
+        if reset.userID == id {
+            delete(st.passwordResets, hash)
+        }
+    }
+    for gigID, gig := range st.gigs {
+        if gig.OrganizerID == id {
+            st.deleteGig(gigID)
+        }
+    }
+    // venues.created_by, artists.created_by and gig_revisions.editor_id are
+    // ON DELETE SET NULL.
+    for venueID, venue := range st.venues {
+        if venue.CreatedBy != nil && *venue.CreatedBy == id {
+            venue.CreatedBy = nil
+            st.venues[venueID] = venue
+        }
+    }
+    for artistID, artist := range st.artists {
+        if artist.CreatedBy != nil && *artist.CreatedBy == id {
+            artist.CreatedBy = nil
+            st.artists[artistID] = artist
+        }
+    }
+    for _, revisions := range st.revisions {
+        for i := range revisions {
+            if revisions[i].EditorID != nil && *revisions[i].EditorID == id {
+                revisions[i].EditorID = nil
+            }
+        }
+    }
+    return nil
+}
+
+func (s *UserStore) EmailExists(ctx context.Context, email string) (bool, error) {
+    return s.exists(ctx, func(u models.User) bool { return u.Email == email })
+}
+
+func (s *UserStore) UsernameExists(ctx context.Context, username string) (bool, error) {
+    return s.exists(ctx, func(u models.User) bool { return u.Username == username })
+}
+
+func (s *UserStore) MarkEmailVerified(ctx context.Context, id, email string) (time.Time, error) {
+    if err := ctx.Err(); err != nil {
+        return time.Time{}, err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    user, ok := st.users[id]
+    if !ok || user.Email != email {
+        return time.Time{}, repository.TranslateError(sql.ErrNoRows, "user")
+    }
+    if user.EmailVerifiedAt != nil {
+        return time.Time{}, repository.ErrEmailAlreadyVerified
+    }
+    now := st.timestamp()
+    user.EmailVerifiedAt = &now
+    user.UpdatedAt = now
+    st.users[id] = user
+    return now, nil
+}
+
+func (s *UserStore) ClaimVerificationEmail(ctx context.Context, id string, interval time.Duration) (time.Duration, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    user, ok := st.users[id]
+    if !ok {
+        return 0, repository.TranslateError(sql.ErrNoRows, "user")
+    }
+    if user.EmailVerifiedAt != nil {
+        return 0, repository.ErrEmailAlreadyVerified
+    }
+    now := st.timestamp()
+    if user.VerificationSentAt != nil {
+        if wait := user.VerificationSentAt.Add(interval).Sub(now); wait > 0 {
+            return wait, nil
+        }
+    }
+    user.VerificationSentAt = &now
+    st.users[id] = user
+    return 0, nil
+}
+
+func (s *UserStore) exists(ctx context.Context, match func(models.User) bool) (bool, error) {
+    _, err := s.find(ctx, match)
+    if errors.Is(err, apperr.ErrNotFound) {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+func (s *UserStore) find(ctx context.Context, match func(models.User) bool) (*models.User, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    for _, user := range st.users {
+        if match(user) {
+            return &user, nil
+        }
+    }
+    return nil, repository.TranslateError(sql.ErrNoRows, "user")
+}
+
+// checkUser enforces users_role_check, users_username_key and
+// users_email_key, ignoring the row being updated. Callers hold the lock.
+func (st *state) checkUser(user *models.User, selfID string) error {
+    switch user.Role {
+    case models.RoleUser, models.RoleOrganizer, models.RoleAdmin:
+    default:
+        return checkViolation("users", "users_role_check")
+    }
+    for id, other := range st.users {
+        if id == selfID {
+            continue
+        }
+        if other.Username == user.Username {
+            return uniqueViolation("users_username_key")
+        }
+        if other.Email == user.Email {
+            return uniqueViolation("users_email_key")
+        }
+    }
+    return nil
+}
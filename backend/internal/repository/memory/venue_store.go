@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sunyi-api/internal/geo"
+	"sunyi-api/internal/models"
+	"sunyi-api/internal/repository"
+)
+
+type VenueStore struct {
+    state *state
+}
+
+func (s *VenueStore) Create(ctx context.Context, venue *models.Venue) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if err := st.checkVenue(venue); err != nil {
+        return repository.TranslateError(err, "venue")
+    }
+
+    venue.ID = newID()
+    venue.CreatedAt = st.timestamp()
+    venue.UpdatedAt = venue.CreatedAt
+    st.venues[venue.ID] = cloneVenue(*venue)
+    return nil
+}
+
+func (s *VenueStore) GetByID(ctx context.Context, id string) (*models.Venue, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    venue, ok := st.venues[id]
+    if !ok {
+        return nil, repository.TranslateError(sql.ErrNoRows, "venue")
+    }
+    venue = cloneVenue(venue)
+    return &venue, nil
+}
+
+func (s *VenueStore) List(ctx context.Context, filter models.VenueFilter) ([]models.Venue, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    near := filter.Latitude != nil && filter.Longitude != nil
+    radius := filter.RadiusKm
+    if radius <= 0 {
+        radius = repository.DefaultVenueRadiusKm
+    }
+    query := strings.ToLower(filter.Query)
+
+    st := s.state
+    st.mu.RLock()
+    defer st.mu.RUnlock()
+
+    venues := []models.Venue{}
+    for _, venue := range st.venues {
+        if query != "" && !strings.Contains(strings.ToLower(venue.Name), query) {
+            continue
+        }
+        venue = cloneVenue(venue)
+        if near {
+            distance := geo.HaversineKm(*filter.Latitude, *filter.Longitude, venue.Latitude, venue.Longitude)
+            if distance > radius {
+                continue
+            }
+            venue.DistanceKm = &distance
+        }
+        venues = append(venues, venue)
+    }
+
+    sort.Slice(venues, func(i, j int) bool {
+        a, b := venues[i], venues[j]
+        if near && *a.DistanceKm != *b.DistanceKm {
+            return *a.DistanceKm < *b.DistanceKm
+        }
+        if !near && a.Name != b.Name {
+            return a.Name < b.Name
+        }
+        return a.ID < b.ID
+    })
+    if limit := repository.PageLimit(filter.Limit); len(venues) > limit {
+        venues = venues[:limit]
+    }
+    return venues, nil
+}
+
+func (s *VenueStore) Update(ctx context.Context, venue *models.Venue) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    existing, ok := st.venues[venue.ID]
+    if !ok {
+        return repository.TranslateError(sql.ErrNoRows, "venue")
+    }
+    if err := st.checkVenue(venue); err != nil {
+        return repository.TranslateError(err, "venue")
+    }
+
+    // created_by and created_at are not updatable.
+    updated := cloneVenue(*venue)
+    updated.CreatedBy = clonePtr(existing.CreatedBy)
+    updated.CreatedAt = existing.CreatedAt
+    updated.UpdatedAt = st.timestamp()
+    st.venues[venue.ID] = updated
+
+    venue.UpdatedAt = updated.UpdatedAt
+    return nil
+}
+
+func (s *VenueStore) Delete(ctx context.Context, id string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    st := s.state
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    if _, ok := st.venues[id]; !ok {
+        return repository.TranslateError(sql.ErrNoRows, "venue")
+    }
+    // gigs_venue_id_fkey is ON DELETE RESTRICT.
+    for _, gig := range st.gigs {
+        if gig.VenueID == id {
+            return repository.ErrVenueInUse
+        }
+    }
+    delete(st.venues, id)
+    return nil
+}
+
+// checkVenue enforces the venues table constraints. Callers hold the lock.
+func (st *state) checkVenue(venue *models.Venue) error {
+    if venue.Latitude < -90 || venue.Latitude > 90 {
+        return checkViolation("venues", "venues_latitude_check")
+    }
+    if venue.Longitude < -180 || venue.Longitude > 180 {
+        return checkViolation("venues", "venues_longitude_check")
+    }
+    if venue.CreatedBy != nil {
+        if _, ok := st.users[*venue.CreatedBy]; !ok {
+            return foreignKeyViolation("venues", "venues_created_by_fkey")
+        }
+    }
+    return nil
+}
+
+// withVenue fills the gig's venue fields, as the gig_listings view does.
+// Callers hold the lock.
+func (st *state) withVenue(gig models.Gig) models.Gig {
+    if venue, ok := st.venues[gig.VenueID]; ok {
+        gig.SetVenue(&venue)
+    }
+    return gig
+}
+
+func cloneVenue(venue models.Venue) models.Venue {
+    venue.CreatedBy = clonePtr(venue.CreatedBy)
+    venue.DistanceKm = nil
+    return venue
+}
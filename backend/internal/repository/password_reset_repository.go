@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type PasswordResetRepository struct {
+    db      *sqlx.DB
+    timeout time.Duration
+}
+
+// NewPasswordResetRepository returns a repository whose queries are bounded
+// by queryTimeout unless the caller's context ends sooner.
+func NewPasswordResetRepository(db *sqlx.DB, queryTimeout time.Duration) *PasswordResetRepository {
+    return &PasswordResetRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *PasswordResetRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+// Create records a reset token for the user that expires ttl from now,
+// unless one was already issued within interval. It reports whether the
+// token was recorded; if not, the caller must not send it.
+func (r *PasswordResetRepository) Create(ctx context.Context, userID, tokenHash string, ttl, interval time.Duration) (bool, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        INSERT INTO password_resets (token_hash, user_id, expires_at)
+        SELECT $1, $2, NOW() + make_interval(secs => $3)
+        WHERE NOT EXISTS (
+            SELECT 1 FROM password_resets
+            WHERE user_id = $2 AND created_at > NOW() - make_interval(secs => $4)
+        )
+    `
+    result, err := r.db.ExecContext(ctx, query, tokenHash, userID, ttl.Seconds(), interval.Seconds())
+    if err != nil {
+        return false, TranslateError(err, "password reset")
+    }
+    rows, err := result.RowsAffected()
+    return rows > 0, err
+}
+
+// Reset spends the unexpired token hashing to tokenHash, sets the owner's
+// password hash, and signs them out everywhere: their other reset tokens
+// are spent and their sessions revoked, which also ends their access
+// tokens. It returns the user's id. A token that is unknown, expired or
+// used is ErrNotFound.
+func (r *PasswordResetRepository) Reset(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return "", TranslateError(err, "password reset")
+    }
+    defer tx.Rollback()
+
+    var userID string
+    query := `
+        UPDATE password_resets SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id
+    `
+    if err := tx.GetContext(ctx, &userID, query, tokenHash); err != nil {
+        return "", TranslateError(err, "password reset")
+    }
+
+    query = `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+    if _, err := tx.ExecContext(ctx, query, passwordHash, userID); err != nil {
+        return "", TranslateError(err, "user")
+    }
+    query = `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+    if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+        return "", TranslateError(err, "password reset")
+    }
+    query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+    if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+        return "", TranslateError(err, "session")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return "", TranslateError(err, "password reset")
+    }
+    return userID, nil
+}
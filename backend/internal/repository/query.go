@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// withTimeout bounds ctx by the default query timeout. A caller deadline
+// that is already sooner is kept.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+    if timeout <= 0 {
+        return context.WithCancel(ctx)
+    }
+    return context.WithTimeout(ctx, timeout)
+}
+
+// whereBuilder collects WHERE conditions and their positional arguments so
+// optional filters can be appended without tracking $n indexes by hand.
+type whereBuilder struct {
+    conds []string
+    args  []interface{}
+}
+
+// arg registers a value and returns its placeholder.
+func (w *whereBuilder) arg(v interface{}) string {
+    w.args = append(w.args, v)
+    return fmt.Sprintf("$%d", len(w.args))
+}
+
+func (w *whereBuilder) where(cond string) {
+    w.conds = append(w.conds, cond)
+}
+
+func (w *whereBuilder) clause() string {
+    if len(w.conds) == 0 {
+        return ""
+    }
+    return "WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// clone copies the builder so a count query and a page query can diverge.
+func (w *whereBuilder) clone() *whereBuilder {
+    return &whereBuilder{
+        conds: append([]string(nil), w.conds...),
+        args:  append([]interface{}(nil), w.args...),
+    }
+}
+
+// escapeLike escapes LIKE wildcards so s matches only itself.
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+    // ErrSessionEnded means the refresh token belongs to a session that was
+    // revoked or went unused for too long.
+    ErrSessionEnded = apperr.Unauthorized("Session has expired or was revoked; sign in again").WithCode(apperr.CodeSessionEnded)
+    // ErrRefreshTokenReused means a refresh token was presented after it had
+    // already been exchanged. Either the client or a thief holds a copy, so
+    // the whole session is revoked.
+    ErrRefreshTokenReused = apperr.Unauthorized("Refresh token was already used; the session has been revoked").WithCode(apperr.CodeRefreshTokenReused)
+)
+
+type SessionRepository struct {
+    db      *sqlx.DB
+    timeout time.Duration
+}
+
+// NewSessionRepository returns a repository whose queries are bounded by
+// queryTimeout unless the caller's context ends sooner.
+func NewSessionRepository(db *sqlx.DB, queryTimeout time.Duration) *SessionRepository {
+    return &SessionRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *SessionRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+// Create starts a session whose first refresh token hashes to tokenHash and
+// which expires ttl from now. Expiry is reckoned by the database clock, as
+// it is checked against.
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session, tokenHash string, ttl time.Duration) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return TranslateError(err, "session")
+    }
+    defer tx.Rollback()
+
+    query := `
+        INSERT INTO sessions (user_id, user_agent, ip_address, expires_at)
+        VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+        RETURNING id, created_at, last_used_at, expires_at
+    `
+    err = tx.QueryRowContext(
+        ctx,
+        query,
+        session.UserID,
+        session.UserAgent,
+        session.IPAddress,
+        ttl.Seconds(),
+    ).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+    if err != nil {
+        return TranslateError(err, "session")
+    }
+
+    query = `INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)`
+    if _, err := tx.ExecContext(ctx, query, tokenHash, session.ID); err != nil {
+        return TranslateError(err, "session")
+    }
+    return TranslateError(tx.Commit(), "session")
+}
+
+// Rotate exchanges the refresh token hashing to tokenHash for one hashing to
+// newTokenHash and extends the session to ttl from now. An unknown token is
+// ErrNotFound. A token that was already exchanged revokes its session and
+// fails with ErrRefreshTokenReused; one whose session has ended fails with
+// ErrSessionEnded.
+func (r *SessionRepository) Rotate(ctx context.Context, tokenHash, newTokenHash string, ttl time.Duration) (*models.Session, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    tx, err := r.db.BeginTxx(ctx, nil)
+    if err != nil {
+        return nil, TranslateError(err, "session")
+    }
+    defer tx.Rollback()
+
+    // Locking the session serializes concurrent refreshes of it, so only
+    // one of two requests racing with the same token can win.
+    var token struct {
+        SessionID string     `db:"session_id"`
+        RotatedAt *time.Time `db:"rotated_at"`
+        Live      bool       `db:"live"`
+    }
+    query := `
+        SELECT t.session_id, t.rotated_at, s.revoked_at IS NULL AND s.expires_at > NOW() AS live
+        FROM refresh_tokens t
+        JOIN sessions s ON s.id = t.session_id
+        WHERE t.token_hash = $1
+        FOR UPDATE OF s
+    `
+    if err := tx.GetContext(ctx, &token, query, tokenHash); err != nil {
+        return nil, TranslateError(err, "refresh token")
+    }
+    if !token.Live {
+        return nil, ErrSessionEnded
+    }
+    if token.RotatedAt != nil {
+        query = `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`
+        if _, err := tx.ExecContext(ctx, query, token.SessionID); err != nil {
+            return nil, TranslateError(err, "session")
+        }
+        if err := tx.Commit(); err != nil {
+            return nil, TranslateError(err, "session")
+        }
+        return nil, ErrRefreshTokenReused
+    }
+
+    query = `UPDATE refresh_tokens SET rotated_at = NOW() WHERE token_hash = $1`
+    if _, err := tx.ExecContext(ctx, query, tokenHash); err != nil {
+        return nil, TranslateError(err, "session")
+    }
+    query = `INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)`
+    if _, err := tx.ExecContext(ctx, query, newTokenHash, token.SessionID); err != nil {
+        return nil, TranslateError(err, "session")
+    }
+
+    var session models.Session
+    query = `
+        UPDATE sessions
+        SET last_used_at = NOW(), expires_at = NOW() + make_interval(secs => $1)
+        WHERE id = $2
+        RETURNING *
+    `
+    if err := tx.GetContext(ctx, &session, query, ttl.Seconds(), token.SessionID); err != nil {
+        return nil, TranslateError(err, "session")
+    }
+    if err := tx.Commit(); err != nil {
+        return nil, TranslateError(err, "session")
+    }
+    return &session, nil
+}
+
+// Active reports whether the session exists and has neither been revoked
+// nor expired.
+func (r *SessionRepository) Active(ctx context.Context, id string) (bool, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    var active bool
+    query := `
+        SELECT EXISTS (
+            SELECT 1 FROM sessions
+            WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+        )
+    `
+    if err := r.db.GetContext(ctx, &active, query, id); err != nil {
+        // A malformed id names no session.
+        if err = TranslateError(err, "session"); errors.Is(err, apperr.ErrNotFound) {
+            return false, nil
+        }
+        return false, err
+    }
+    return active, nil
+}
+
+// ListActive returns the user's live sessions, most recently used first.
+func (r *SessionRepository) ListActive(ctx context.Context, userID string) ([]models.Session, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        SELECT * FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY last_used_at DESC, id
+    `
+    sessions := []models.Session{}
+    if err := r.db.SelectContext(ctx, &sessions, query, userID); err != nil {
+        return nil, TranslateError(err, "session")
+    }
+    return sessions, nil
+}
+
+// Revoke ends one of the user's live sessions. Anyone else's session, or
+// one already ended, is ErrNotFound.
+func (r *SessionRepository) Revoke(ctx context.Context, userID, id string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE sessions SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+    `
+    result, err := r.db.ExecContext(ctx, query, id, userID)
+    if err != nil {
+        return TranslateError(err, "session")
+    }
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rows == 0 {
+        return TranslateError(sql.ErrNoRows, "session")
+    }
+    return nil
+}
+
+// RevokeAll ends every live session of the user but the one named by
+// exceptID, which may be empty, and returns how many it ended.
+func (r *SessionRepository) RevokeAll(ctx context.Context, userID, exceptID string) (int, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE sessions SET revoked_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+          AND id::text <> $2
+    `
+    result, err := r.db.ExecContext(ctx, query, userID, exceptID)
+    if err != nil {
+        return 0, TranslateError(err, "session")
+    }
+    rows, err := result.RowsAffected()
+    return int(rows), err
+}
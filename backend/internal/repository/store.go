@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"sunyi-api/internal/models"
+	"time"
+)
+
+// UserStore is the persistence contract handlers depend on. UserRepository
+// implements it against Postgres and memory.UserStore in process.
+type UserStore interface {
+    Create(ctx context.Context, user *models.User) error
+    GetByID(ctx context.Context, id string) (*models.User, error)
+    GetByEmail(ctx context.Context, email string) (*models.User, error)
+    GetByUsername(ctx context.Context, username string) (*models.User, error)
+    Update(ctx context.Context, user *models.User) error
+    UpdatePassword(ctx context.Context, id, passwordHash string) error
+    Delete(ctx context.Context, id string) error
+    EmailExists(ctx context.Context, email string) (bool, error)
+    UsernameExists(ctx context.Context, username string) (bool, error)
+    MarkEmailVerified(ctx context.Context, id, email string) (time.Time, error)
+    ClaimVerificationEmail(ctx context.Context, id string, interval time.Duration) (time.Duration, error)
+}
+
+// GigStore is the persistence contract for gigs. GigRepository implements it
+// against Postgres and memory.GigStore in process.
+type GigStore interface {
+    Create(ctx context.Context, gig *models.Gig) error
+    List(ctx context.Context, filter models.GigFilter) (*models.GigListResponse, error)
+    Nearby(ctx context.Context, filter models.NearbyGigFilter) ([]models.Gig, error)
+    // InViewport returns at most MaxViewportGigs gigs, and whether more
+    // matched. Implementations may leave out organizers, lineups and other
+    // fields a map marker does not show.
+    InViewport(ctx context.Context, filter models.MapGigFilter) ([]models.Gig, bool, error)
+    GetByID(ctx context.Context, id string) (*models.Gig, error)
+    GetByOrganizerID(ctx context.Context, organizerID string) ([]models.Gig, error)
+    Update(ctx context.Context, gig *models.Gig, editorID string) error
+    Restore(ctx context.Context, gig *models.Gig, fromVersion int, editorID string) error
+    Transition(ctx context.Context, gig *models.Gig, from models.GigStatus, editorID string) error
+    Delete(ctx context.Context, id string, version int) error
+    Revisions(ctx context.Context, gigID string) ([]models.GigRevision, error)
+    Revision(ctx context.Context, gigID string, version int) (*models.GigRevision, error)
+}
+
+// VenueStore is the persistence contract for venues. VenueRepository
+// implements it against Postgres and memory.VenueStore in process.
+type VenueStore interface {
+    Create(ctx context.Context, venue *models.Venue) error
+    GetByID(ctx context.Context, id string) (*models.Venue, error)
+    List(ctx context.Context, filter models.VenueFilter) ([]models.Venue, error)
+    Update(ctx context.Context, venue *models.Venue) error
+    Delete(ctx context.Context, id string) error
+}
+
+// ArtistStore is the persistence contract for artists. ArtistRepository
+// implements it against Postgres and memory.ArtistStore in process.
+type ArtistStore interface {
+    Create(ctx context.Context, artist *models.Artist) error
+    GetByID(ctx context.Context, id string) (*models.Artist, error)
+    List(ctx context.Context, filter models.ArtistFilter) ([]models.Artist, error)
+    Update(ctx context.Context, artist *models.Artist) error
+    Delete(ctx context.Context, id string) error
+}
+
+// GenreStore reads the genre taxonomy. GenreRepository implements it
+// against Postgres and memory.GenreStore in process.
+type GenreStore interface {
+    List(ctx context.Context) ([]models.Genre, error)
+    Resolve(ctx context.Context, keys []string) (map[string]string, error)
+}
+
+// SessionStore persists sign-in sessions and their refresh tokens, which
+// are only ever stored hashed. SessionRepository implements it against
+// Postgres and memory.SessionStore in process.
+type SessionStore interface {
+    Create(ctx context.Context, session *models.Session, tokenHash string, ttl time.Duration) error
+    Rotate(ctx context.Context, tokenHash, newTokenHash string, ttl time.Duration) (*models.Session, error)
+    Active(ctx context.Context, id string) (bool, error)
+    ListActive(ctx context.Context, userID string) ([]models.Session, error)
+    Revoke(ctx context.Context, userID, id string) error
+    RevokeAll(ctx context.Context, userID, exceptID string) (int, error)
+}
+
+// PasswordResetStore persists password reset tokens, which are only ever
+// stored hashed. PasswordResetRepository implements it against Postgres
+// and memory.PasswordResetStore in process.
+type PasswordResetStore interface {
+    Create(ctx context.Context, userID, tokenHash string, ttl, interval time.Duration) (bool, error)
+    Reset(ctx context.Context, tokenHash, passwordHash string) (string, error)
+}
+
+// LoginAttemptStore records sign-in attempts under throttling keys.
+// LoginAttemptRepository implements it against Postgres and
+// memory.LoginAttemptStore in process.
+type LoginAttemptStore interface {
+    Attempt(
+        ctx context.Context,
+        ip string,
+        keys []string,
+        window time.Duration,
+        decide func([]models.LoginFailures) error,
+    ) (string, error)
+    Forgive(ctx context.Context, attemptID string) error
+    Clear(ctx context.Context, key string) (int, error)
+}
+
+var (
+    _ UserStore          = (*UserRepository)(nil)
+    _ GigStore           = (*GigRepository)(nil)
+    _ VenueStore         = (*VenueRepository)(nil)
+    _ ArtistStore        = (*ArtistRepository)(nil)
+    _ GenreStore         = (*GenreRepository)(nil)
+    _ SessionStore       = (*SessionRepository)(nil)
+    _ PasswordResetStore = (*PasswordResetRepository)(nil)
+    _ LoginAttemptStore  = (*LoginAttemptRepository)(nil)
+)
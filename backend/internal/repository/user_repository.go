@@ -1,27 +1,46 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"sunyi-api/internal/apperr"
 	"sunyi-api/internal/models"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// ErrEmailAlreadyVerified means the address was verified before, so the
+// link is spent and there is nothing to resend.
+var ErrEmailAlreadyVerified = apperr.Conflict("email", "Email address is already verified").WithCode(apperr.CodeEmailVerified)
+
 type UserRepository struct {
-    db *sqlx.DB
+    db      *sqlx.DB
+    timeout time.Duration
+}
+
+// NewUserRepository returns a repository whose queries are bounded by
+// queryTimeout unless the caller's context ends sooner.
+func NewUserRepository(db *sqlx.DB, queryTimeout time.Duration) *UserRepository {
+    return &UserRepository{db: db, timeout: queryTimeout}
 }
 
-func NewUserRepository(db *sqlx.DB) *UserRepository {
-    return &UserRepository{db: db}
+func (r *UserRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
 }
 
-func (r *UserRepository) Create(user *models.User) error {
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     query := `
         INSERT INTO users (username, email, password_hash, role, bio, profile_image)
         VALUES ($1, $2, $3, $4, $5, $6)
         RETURNING id, created_at, updated_at
     `
-    return r.db.QueryRow(
+    err := r.db.QueryRowContext(
+        ctx,
         query,
         user.Username,
         user.Email,
@@ -30,39 +49,49 @@ func (r *UserRepository) Create(user *models.User) error {
         user.Bio,
         user.ProfileImage,
     ).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+    return TranslateError(err, "user")
 }
 
-func (r *UserRepository) GetByID(id string) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     var user models.User
     query := `SELECT * FROM users WHERE id = $1`
-    err := r.db.Get(&user, query, id)
-    if err == sql.ErrNoRows {
-        return nil, nil
+    if err := r.db.GetContext(ctx, &user, query, id); err != nil {
+        return nil, TranslateError(err, "user")
     }
-    return &user, err
+    return &user, nil
 }
 
-func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     var user models.User
     query := `SELECT * FROM users WHERE email = $1`
-    err := r.db.Get(&user, query, email)
-    if err == sql.ErrNoRows {
-        return nil, nil
+    if err := r.db.GetContext(ctx, &user, query, email); err != nil {
+        return nil, TranslateError(err, "user")
     }
-    return &user, err
+    return &user, nil
 }
 
-func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     var user models.User
     query := `SELECT * FROM users WHERE username = $1`
-    err := r.db.Get(&user, query, username)
-    if err == sql.ErrNoRows {
-        return nil, nil
+    if err := r.db.GetContext(ctx, &user, query, username); err != nil {
+        return nil, TranslateError(err, "user")
     }
-    return &user, err
+    return &user, nil
 }
 
-func (r *UserRepository) Update(user *models.User) error {
+func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     query := `
         UPDATE users 
         SET username = $1, email = $2, role = $3, bio = $4, 
@@ -70,7 +99,8 @@ func (r *UserRepository) Update(user *models.User) error {
         WHERE id = $6
         RETURNING updated_at
     `
-    return r.db.QueryRow(
+    err := r.db.QueryRowContext(
+        ctx,
         query,
         user.Username,
         user.Email,
@@ -79,24 +109,127 @@ func (r *UserRepository) Update(user *models.User) error {
         user.ProfileImage,
         user.ID,
     ).Scan(&user.UpdatedAt)
+    return TranslateError(err, "user")
 }
 
-func (r *UserRepository) Delete(id string) error {
+// UpdatePassword replaces the user's password hash. Update never touches
+// it, so a profile edit cannot clobber a concurrent password change.
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+    result, err := r.db.ExecContext(ctx, query, passwordHash, id)
+    if err != nil {
+        return TranslateError(err, "user")
+    }
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rows == 0 {
+        return TranslateError(sql.ErrNoRows, "user")
+    }
+    return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     query := `DELETE FROM users WHERE id = $1`
-    _, err := r.db.Exec(query, id)
-    return err
+    _, err := r.db.ExecContext(ctx, query, id)
+    return TranslateError(err, "user")
 }
 
-func (r *UserRepository) EmailExists(email string) (bool, error) {
+func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     var exists bool
     query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
-    err := r.db.Get(&exists, query, email)
-    return exists, err
+    err := r.db.GetContext(ctx, &exists, query, email)
+    return exists, TranslateError(err, "user")
 }
 
-func (r *UserRepository) UsernameExists(username string) (bool, error) {
+func (r *UserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
     var exists bool
     query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
-    err := r.db.Get(&exists, query, username)
-    return exists, err
-}
\ No newline at end of file
+    err := r.db.GetContext(ctx, &exists, query, username)
+    return exists, TranslateError(err, "user")
+}
+
+// MarkEmailVerified records that the user proved they own email. It fails
+// with ErrEmailAlreadyVerified if that already happened, and with NotFound
+// if the user is gone or no longer has that address.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id, email string) (time.Time, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    var verifiedAt time.Time
+    query := `
+        UPDATE users
+        SET email_verified_at = NOW(), updated_at = NOW()
+        WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+        RETURNING email_verified_at
+    `
+    err := r.db.GetContext(ctx, &verifiedAt, query, id, email)
+    if !errors.Is(err, sql.ErrNoRows) {
+        return verifiedAt, TranslateError(err, "user")
+    }
+
+    var verified bool
+    query = `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1 AND email = $2`
+    if err := r.db.GetContext(ctx, &verified, query, id, email); err != nil {
+        return time.Time{}, TranslateError(err, "user")
+    }
+    if verified {
+        return time.Time{}, ErrEmailAlreadyVerified
+    }
+    return time.Time{}, TranslateError(sql.ErrNoRows, "user")
+}
+
+// ClaimVerificationEmail reserves the right to mail the user a verification
+// link, at most once per interval. When the last one went out too recently
+// it returns how long to wait instead; the caller sends nothing.
+func (r *UserRepository) ClaimVerificationEmail(ctx context.Context, id string, interval time.Duration) (time.Duration, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE users
+        SET email_verification_sent_at = NOW()
+        WHERE id = $1 AND email_verified_at IS NULL
+          AND (email_verification_sent_at IS NULL
+               OR email_verification_sent_at <= NOW() - make_interval(secs => $2))
+        RETURNING id
+    `
+    var claimed string
+    err := r.db.GetContext(ctx, &claimed, query, id, interval.Seconds())
+    if !errors.Is(err, sql.ErrNoRows) {
+        return 0, TranslateError(err, "user")
+    }
+
+    var state struct {
+        Verified bool    `db:"verified"`
+        Wait     float64 `db:"wait"`
+    }
+    query = `
+        SELECT email_verified_at IS NOT NULL AS verified,
+               COALESCE(EXTRACT(EPOCH FROM email_verification_sent_at
+                   + make_interval(secs => $2) - NOW()), 0)::float8 AS wait
+        FROM users
+        WHERE id = $1
+    `
+    if err := r.db.GetContext(ctx, &state, query, id, interval.Seconds()); err != nil {
+        return 0, TranslateError(err, "user")
+    }
+    if state.Verified {
+        return 0, ErrEmailAlreadyVerified
+    }
+    // The previous send aged out between the two statements.
+    return max(time.Duration(state.Wait*float64(time.Second)), time.Second), nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sunyi-api/internal/apperr"
+	"sunyi-api/internal/geo"
+	"sunyi-api/internal/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrVenueInUse means gigs still take place at the venue being deleted.
+var ErrVenueInUse = apperr.Conflict("venue", "Venue still has gigs and cannot be deleted")
+
+type VenueRepository struct {
+    db      *sqlx.DB
+    timeout time.Duration
+}
+
+// NewVenueRepository returns a repository whose queries are bounded by
+// queryTimeout unless the caller's context ends sooner.
+func NewVenueRepository(db *sqlx.DB, queryTimeout time.Duration) *VenueRepository {
+    return &VenueRepository{db: db, timeout: queryTimeout}
+}
+
+func (r *VenueRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+    return withTimeout(ctx, r.timeout)
+}
+
+func (r *VenueRepository) Create(ctx context.Context, venue *models.Venue) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        INSERT INTO venues (name, address, latitude, longitude, created_by)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at, updated_at
+    `
+    err := r.db.QueryRowContext(
+        ctx,
+        query,
+        venue.Name,
+        venue.Address,
+        venue.Latitude,
+        venue.Longitude,
+        venue.CreatedBy,
+    ).Scan(&venue.ID, &venue.CreatedAt, &venue.UpdatedAt)
+    return TranslateError(err, "venue")
+}
+
+func (r *VenueRepository) GetByID(ctx context.Context, id string) (*models.Venue, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    var venue models.Venue
+    query := `
+        SELECT id, name, address, latitude, longitude, created_by, created_at, updated_at
+        FROM venues
+        WHERE id = $1
+    `
+    if err := r.db.GetContext(ctx, &venue, query, id); err != nil {
+        return nil, TranslateError(err, "venue")
+    }
+    return &venue, nil
+}
+
+const DefaultVenueRadiusKm = 10
+
+// List searches venues by a case-insensitive name fragment and, when a point
+// is given, by distance from it. Venues near a point come closest first,
+// otherwise by name.
+func (r *VenueRepository) List(ctx context.Context, filter models.VenueFilter) ([]models.Venue, error) {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    w := &whereBuilder{}
+    if filter.Query != "" {
+        w.where("name ILIKE '%' || " + w.arg(escapeLike(filter.Query)) + " || '%'")
+    }
+
+    distance := "NULL::float8"
+    orderBy := "name, id"
+    if filter.Latitude != nil && filter.Longitude != nil {
+        radius := filter.RadiusKm
+        if radius <= 0 {
+            radius = DefaultVenueRadiusKm
+        }
+        lat, lng := *filter.Latitude, *filter.Longitude
+        box := geo.BoundingBox(lat, lng, radius)
+        w.where("latitude BETWEEN " + w.arg(box.MinLat) + " AND " + w.arg(box.MaxLat))
+        if box.CrossesAntimeridian() {
+            w.where("(longitude >= " + w.arg(box.MinLng) + " OR longitude <= " + w.arg(box.MaxLng) + ")")
+        } else {
+            w.where("longitude BETWEEN " + w.arg(box.MinLng) + " AND " + w.arg(box.MaxLng))
+        }
+        distance = haversineSQL(w.arg(lat), w.arg(lng))
+        w.where(distance + " <= " + w.arg(radius))
+        orderBy = "distance_km, id"
+    }
+
+    query := `
+        SELECT id, name, address, latitude, longitude, created_by, created_at, updated_at,
+               ` + distance + ` AS distance_km
+        FROM venues
+        ` + w.clause() + `
+        ORDER BY ` + orderBy + `
+        LIMIT ` + w.arg(PageLimit(filter.Limit))
+
+    venues := []models.Venue{}
+    if err := r.db.SelectContext(ctx, &venues, query, w.args...); err != nil {
+        return nil, TranslateError(err, "venue")
+    }
+    return venues, nil
+}
+
+func (r *VenueRepository) Update(ctx context.Context, venue *models.Venue) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    query := `
+        UPDATE venues
+        SET name = $1, address = $2, latitude = $3, longitude = $4, updated_at = NOW()
+        WHERE id = $5
+        RETURNING updated_at
+    `
+    err := r.db.QueryRowContext(
+        ctx,
+        query,
+        venue.Name,
+        venue.Address,
+        venue.Latitude,
+        venue.Longitude,
+        venue.ID,
+    ).Scan(&venue.UpdatedAt)
+    return TranslateError(err, "venue")
+}
+
+// Delete removes a venue no gig refers to, failing with ErrVenueInUse
+// otherwise.
+func (r *VenueRepository) Delete(ctx context.Context, id string) error {
+    ctx, cancel := r.withTimeout(ctx)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM venues WHERE id = $1`, id)
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Constraint == "gigs_venue_id_fkey" {
+        return ErrVenueInUse
+    }
+    if err != nil {
+        return TranslateError(err, "venue")
+    }
+
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rows == 0 {
+        return TranslateError(sql.ErrNoRows, "venue")
+    }
+    return nil
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"sunyi-api/config"
+	"sunyi-api/internal/handlers"
+	"sunyi-api/internal/jwtkeys"
+	"sunyi-api/internal/loginguard"
+	"sunyi-api/internal/mail"
+	"sunyi-api/internal/middleware"
+	"sunyi-api/internal/repository"
+	"sunyi-api/internal/storage"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Stores are the persistence backends the API runs against: the Postgres
+// repositories in production, the memory stores in tests, and the blob store
+// uploads go to, and the mailer emails go out through.
+type Stores struct {
+	Users          repository.UserStore
+	Gigs           repository.GigStore
+	Venues         repository.VenueStore
+	Artists        repository.ArtistStore
+	Genres         repository.GenreStore
+	Sessions       repository.SessionStore
+	PasswordResets repository.PasswordResetStore
+	LoginAttempts  repository.LoginAttemptStore
+	Blobs          storage.BlobStore
+	Mail           mail.Mailer
+	// Background tracks work handlers leave running after they respond,
+	// such as mailing reset links, so shutdown can wait for it.
+	Background *sync.WaitGroup
+}
+
+var validatorSetup sync.Once
+
+// NewRouter wires every handler and middleware into a gin engine. keys
+// signs and verifies access tokens.
+func NewRouter(cfg *config.Config, stores Stores, keys *jwtkeys.Keyring) *gin.Engine {
+	loginGuard := loginguard.New(stores.LoginAttempts, cfg.Auth.Login)
+	authHandler := handlers.NewAuthHandler(
+		stores.Users,
+		stores.Sessions,
+		stores.PasswordResets,
+		loginGuard,
+		keys,
+		stores.Mail,
+		cfg.Mail.AppURL,
+		cfg.JWT.Expiration,
+		cfg.JWT.RefreshExpiration,
+		stores.Background,
+	)
+	gigHandler := handlers.NewGigHandler(stores.Gigs, stores.Venues, stores.Artists, stores.Genres, stores.Blobs)
+	userHandler := handlers.NewUserHandler(stores.Users, stores.Gigs, stores.Blobs)
+	venueHandler := handlers.NewVenueHandler(stores.Venues, stores.Gigs)
+	artistHandler := handlers.NewArtistHandler(stores.Artists, stores.Gigs)
+	genreHandler := handlers.NewGenreHandler(stores.Genres)
+	adminHandler := handlers.NewAdminHandler(loginGuard)
+
+	requireAuth := middleware.AuthMiddleware(keys, stores.Sessions)
+	// Public reads still identify the caller, e.g. so organizers see their
+	// own drafts.
+	optionalAuth := middleware.OptionalAuth(keys, stores.Sessions)
+	organizerOnly := middleware.OrganizerOnly(cfg.Auth.RequireVerifiedEmail)
+
+	validatorSetup.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			middleware.RegisterValidatorTagNames(v)
+			middleware.RegisterValidations(v)
+		}
+	})
+
+	router := gin.Default()
+	// Client addresses key the login throttle, so forwarded headers are only
+	// believed from the configured proxies. Config.Validate has checked the
+	// entries parse.
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		panic(err)
+	}
+	router.Use(middleware.ErrorHandler())
+
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.CORS.AllowedOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
+		AllowCredentials: true,
+		MaxAge:           cfg.CORS.MaxAge,
+	}))
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "healthy",
+			"time":   time.Now().Format(time.RFC3339),
+		})
+	})
+
+	router.GET("/.well-known/jwks.json", authHandler.GetJWKS)
+
+	if cfg.Uploads.Backend == "local" {
+		router.Static(storage.LocalURLPrefix, cfg.Uploads.Dir)
+	}
+
+	api := router.Group("/api")
+	{
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", authHandler.Register)
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", requireAuth, authHandler.Logout)
+			auth.GET("/me", requireAuth, authHandler.GetCurrentUser)
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/verify-email/resend", requireAuth, authHandler.ResendVerification)
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.POST("/change-password", requireAuth, authHandler.ChangePassword)
+			auth.GET("/sessions", requireAuth, authHandler.GetSessions)
+			auth.DELETE("/sessions/:id", requireAuth, authHandler.RevokeSession)
+		}
+
+		users := api.Group("/users")
+		{
+			users.GET("/:id", userHandler.GetUser)
+			users.GET("/:id/profile", userHandler.GetProfile)
+			users.PUT("/:id", requireAuth, userHandler.UpdateUser)
+			users.POST("/:id/profile-image", requireAuth, userHandler.UploadProfileImage)
+		}
+
+		gigs := api.Group("/gigs")
+		{
+			gigs.GET("", optionalAuth, gigHandler.GetAllGigs)
+			gigs.GET("/nearby", optionalAuth, gigHandler.GetNearbyGigs)
+			gigs.GET("/map", optionalAuth, gigHandler.GetMapGigs)
+			gigs.GET("/:id", optionalAuth, gigHandler.GetGigByID)
+			gigs.GET("/organizer/:organizerId", optionalAuth, gigHandler.GetGigsByOrganizer)
+
+			gigs.POST("",
+				requireAuth,
+				organizerOnly,
+				gigHandler.CreateGig,
+			)
+			gigs.PUT("/:id",
+				requireAuth,
+				organizerOnly,
+				gigHandler.UpdateGig,
+			)
+			gigs.PATCH("/:id",
+				requireAuth,
+				organizerOnly,
+				gigHandler.PatchGig,
+			)
+			gigs.DELETE("/:id",
+				requireAuth,
+				organizerOnly,
+				gigHandler.DeleteGig,
+			)
+			gigs.POST("/:id/image",
+				requireAuth,
+				organizerOnly,
+				gigHandler.UploadGigImage,
+			)
+			gigs.POST("/:id/publish",
+				requireAuth,
+				organizerOnly,
+				gigHandler.PublishGig,
+			)
+			gigs.POST("/:id/cancel",
+				requireAuth,
+				organizerOnly,
+				gigHandler.CancelGig,
+			)
+			gigs.POST("/:id/postpone",
+				requireAuth,
+				organizerOnly,
+				gigHandler.PostponeGig,
+			)
+			gigs.POST("/:id/reschedule",
+				requireAuth,
+				organizerOnly,
+				gigHandler.RescheduleGig,
+			)
+			gigs.GET("/:id/revisions",
+				requireAuth,
+				organizerOnly,
+				gigHandler.GetGigRevisions,
+			)
+			gigs.GET("/:id/revisions/diff",
+				requireAuth,
+				organizerOnly,
+				gigHandler.DiffGigRevisions,
+			)
+			gigs.GET("/:id/revisions/:version",
+				requireAuth,
+				organizerOnly,
+				gigHandler.GetGigRevision,
+			)
+			gigs.POST("/:id/revisions/:version/restore",
+				requireAuth,
+				organizerOnly,
+				gigHandler.RestoreGigRevision,
+			)
+		}
+
+		venues := api.Group("/venues")
+		{
+			venues.GET("", venueHandler.GetVenues)
+			venues.GET("/:id", venueHandler.GetVenueByID)
+			venues.GET("/:id/gigs", optionalAuth, venueHandler.GetVenueGigs)
+
+			venues.POST("",
+				requireAuth,
+				organizerOnly,
+				venueHandler.CreateVenue,
+			)
+			venues.PUT("/:id",
+				requireAuth,
+				organizerOnly,
+				venueHandler.UpdateVenue,
+			)
+			venues.DELETE("/:id",
+				requireAuth,
+				organizerOnly,
+				venueHandler.DeleteVenue,
+			)
+		}
+
+		artists := api.Group("/artists")
+		{
+			artists.GET("", artistHandler.GetArtists)
+			artists.GET("/:id", artistHandler.GetArtistByID)
+			artists.GET("/:id/gigs", optionalAuth, artistHandler.GetArtistGigs)
+
+			artists.POST("",
+				requireAuth,
+				organizerOnly,
+				artistHandler.CreateArtist,
+			)
+			artists.PUT("/:id",
+				requireAuth,
+				organizerOnly,
+				artistHandler.UpdateArtist,
+			)
+			artists.DELETE("/:id",
+				requireAuth,
+				organizerOnly,
+				artistHandler.DeleteArtist,
+			)
+		}
+
+		api.GET("/genres", genreHandler.GetGenres)
+
+		admin := api.Group("/admin", requireAuth, middleware.AdminOnly())
+		{
+			admin.DELETE("/login-locks", adminHandler.ClearLoginLock)
+		}
+	}
+
+	return router
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalURLPrefix is where the router serves a LocalStore's directory.
+const LocalURLPrefix = "/uploads"
+
+// LocalStore keeps blobs as files under a directory.
+type LocalStore struct {
+    dir string
+}
+
+func NewLocalStore(dir string) *LocalStore {
+    return &LocalStore{dir: dir}
+}
+
+// Put writes to a temporary file and renames it into place, so a reader
+// never sees a partly written blob.
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+    if err := ctx.Err(); err != nil {
+        return "", err
+    }
+    name, err := s.path(key)
+    if err != nil {
+        return "", err
+    }
+    if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+        return "", err
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+    if err != nil {
+        return "", err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return "", err
+    }
+    if err := tmp.Close(); err != nil {
+        return "", err
+    }
+    if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+        return "", err
+    }
+    if err := os.Rename(tmp.Name(), name); err != nil {
+        return "", err
+    }
+
+    return LocalURLPrefix + "/" + key, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    name, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return err
+    }
+    return nil
+}
+
+// path maps a key to a file under the directory, refusing keys that would
+// escape it.
+func (s *LocalStore) path(key string) (string, error) {
+    if key == "" || path.Clean(key) != key || !filepath.IsLocal(filepath.FromSlash(key)) {
+        return "", fmt.Errorf("invalid blob key %q", key)
+    }
+    return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
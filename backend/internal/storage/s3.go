@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"sunyi-api/config"
+)
+
+// S3Store keeps blobs in a bucket of any S3-compatible object store (AWS,
+// MinIO, R2, ...), signing requests with AWS Signature Version 4.
+type S3Store struct {
+    cfg      config.S3Config
+    endpoint *url.URL
+    client   *http.Client
+    now      func() time.Time
+}
+
+func NewS3Store(cfg config.S3Config, client *http.Client) (*S3Store, error) {
+    endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+    if err != nil || endpoint.Host == "" {
+        return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+    }
+    return &S3Store{cfg: cfg, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+// Put uploads with a long cache lifetime: keys are never reused for
+// different content.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", contentType)
+    req.Header.Set("Cache-Control", "public, max-age=31536000, immutable")
+    s.sign(req, data)
+
+    if err := s.do(req, key); err != nil {
+        return "", err
+    }
+    return s.publicURL(key), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+    if err != nil {
+        return err
+    }
+    s.sign(req, nil)
+    return s.do(req, key)
+}
+
+func (s *S3Store) do(req *http.Request, key string) error {
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("s3 %s %s: %w", req.Method, key, err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode/100 == 2 || (req.Method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+        io.Copy(io.Discard, resp.Body)
+        return nil
+    }
+
+    var body struct {
+        Code    string `xml:"Code"`
+        Message string `xml:"Message"`
+    }
+    raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+    if xml.Unmarshal(raw, &body) == nil && body.Code != "" {
+        return fmt.Errorf("s3 %s %s: %s: %s: %s", req.Method, key, resp.Status, body.Code, body.Message)
+    }
+    return fmt.Errorf("s3 %s %s: %s", req.Method, key, resp.Status)
+}
+
+// objectURL addresses key in the bucket, path-style or virtual-hosted.
+func (s *S3Store) objectURL(key string) string {
+    host, path := s.endpoint.Host, s.endpoint.Path+"/"+key
+    if s.cfg.PathStyle {
+        path = s.endpoint.Path + "/" + s.cfg.Bucket + "/" + key
+    } else {
+        host = s.cfg.Bucket + "." + host
+    }
+    return s.endpoint.Scheme + "://" + host + escapePath(path)
+}
+
+func (s *S3Store) publicURL(key string) string {
+    if s.cfg.PublicURL != "" {
+        return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + escapePath(key)
+    }
+    return s.objectURL(key)
+}
+
+// sign adds the SigV4 headers. The payload is hashed rather than sent
+// unsigned, which every S3-compatible store accepts, also over plain HTTP.
+func (s *S3Store) sign(req *http.Request, payload []byte) {
+    now := s.now().UTC()
+    amzDate := now.Format("20060102T150405Z")
+    day := now.Format("20060102")
+    payloadHash := sha256Hex(payload)
+
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    headers := map[string]string{"host": req.URL.Host}
+    for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Content-Sha256"} {
+        if value := req.Header.Get(name); value != "" {
+            headers[strings.ToLower(name)] = strings.TrimSpace(value)
+        }
+    }
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        req.URL.RawQuery,
+        canonicalHeaders.String(),
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+    stringToSign := strings.Join([]string{
+        "AWS4-HMAC-SHA256",
+        amzDate,
+        scope,
+        sha256Hex([]byte(canonicalRequest)),
+    }, "\n")
+
+    key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), day)
+    key = hmacSHA256(key, s.cfg.Region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf(
+        "AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        s.cfg.AccessKeyID, scope, signedHeaders, signature,
+    ))
+}
+
+// escapePath percent-encodes everything but unreserved characters and "/",
+// as SigV4's canonical URI requires.
+func escapePath(p string) string {
+    var b strings.Builder
+    for i := 0; i < len(p); i++ {
+        c := p[i]
+        if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+            c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+            b.WriteByte(c)
+        } else {
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
+
+func sha256Hex(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
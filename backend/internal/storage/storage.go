@@ -0,0 +1,34 @@
+// Package storage keeps uploaded files behind the BlobStore interface, with
+// implementations for the local filesystem and S3-compatible object stores.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sunyi-api/config"
+)
+
+// BlobStore stores files under slash-separated keys such as
+// "gigs/<id>/<name>.jpg" and hands out the URL clients fetch them from.
+type BlobStore interface {
+    // Put stores data under key, replacing any blob already there, and
+    // returns its public URL.
+    Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+    // Delete removes the blob at key. A missing blob is not an error.
+    Delete(ctx context.Context, key string) error
+}
+
+// New returns the BlobStore cfg.Backend names.
+func New(cfg config.UploadConfig) (BlobStore, error) {
+    switch cfg.Backend {
+    case "local":
+        return NewLocalStore(cfg.Dir), nil
+    case "s3":
+        return NewS3Store(cfg.S3, &http.Client{Timeout: 30 * time.Second})
+    default:
+        return nil, fmt.Errorf("unknown upload backend %q", cfg.Backend)
+    }
+}
@@ -0,0 +1,102 @@
+"use client";
+
+import { useState } from "react";
+import Link from "next/link";
+import { authAPI } from "../../../lib/api";
+import { Loader2 } from "lucide-react";
+
+export default function ForgotPasswordPage() {
+  const [email, setEmail] = useState("");
+  const [sent, setSent] = useState(false);
+  const [error, setError] = useState("");
+  const [loading, setLoading] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setLoading(true);
+
+    try {
+      await authAPI.forgotPassword(email);
+      setSent(true);
+    } catch (err: any) {
+      setError(
+        err.response?.data?.error || "Failed to send. Please try again."
+      );
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center px-4">
+      <div className="max-w-md w-full">
+        <div className="bg-[#1a1a1a] rounded-lg p-8 border border-[#2a2a2a]">
+          <h1 className="text-2xl font-bold text-[var(--fg)] mb-6">
+            Reset password
+          </h1>
+
+          {error && (
+            <div className="bg-red-900/20 border border-red-300/30 rounded-lg p-3 mb-6">
+              <p className="text-red-300 text-sm">{error}</p>
+            </div>
+          )}
+
+          {sent ? (
+            <p className="text-gray-300">
+              If an account uses {email}, a link to reset its password is on
+              its way.
+            </p>
+          ) : (
+            <form onSubmit={handleSubmit} className="space-y-5">
+              <div>
+                <label className="block text-sm font-medium text-gray-300 mb-2">
+                  Email
+                </label>
+                <input
+                  type="email"
+                  required
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  className="w-full px-4 py-3 bg-[#121212] border border-[#2a2a2a] rounded-lg 
+                    text-[var(--fg)] placeholder-gray-500
+                    focus:outline-none focus:border-red-300/50 focus:ring-1 focus:ring-red-300/50
+                    transition"
+                  placeholder="your@email.com"
+                />
+              </div>
+
+              <button
+                type="submit"
+                disabled={loading}
+                className="w-full bg-red-300 text-[#121212] py-3 rounded-lg font-semibold
+                  hover:bg-red-200 active:bg-red-400
+                  disabled:opacity-50 disabled:cursor-not-allowed
+                  transition duration-200
+                  flex items-center justify-center gap-2"
+              >
+                {loading ? (
+                  <>
+                    <Loader2 className="w-5 h-5 animate-spin" />
+                    Sending...
+                  </>
+                ) : (
+                  "Send reset link"
+                )}
+              </button>
+            </form>
+          )}
+
+          <div className="mt-6 text-center">
+            <Link
+              href="/auth/login"
+              className="text-red-300 hover:text-red-200 font-medium transition text-sm"
+            >
+              Back to login
+            </Link>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+}
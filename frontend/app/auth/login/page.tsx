@@ -121,7 +121,15 @@ export default function LoginPage() {
             </button>
           </form>
 
-          <div className="mt-6 text-center">
+          <div className="mt-6 text-center space-y-2">
+            <p className="text-gray-400 text-sm">
+              <Link
+                href="/auth/forgot-password"
+                className="text-red-300 hover:text-red-200 font-medium transition"
+              >
+                Forgot your password?
+              </Link>
+            </p>
             <p className="text-gray-400 text-sm">
               Don't have an account?{" "}
               <Link
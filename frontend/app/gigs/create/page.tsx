@@ -138,16 +138,34 @@ export default function CreateGigPage() {
       // Parse price
       const price = formData.price ? parseFloat(formData.price) : undefined;
 
+      // An end time at or before the start time means the show runs past
+      // midnight, so it ends on the following day.
+      let endsAt: string | undefined;
+      if (formData.end_time) {
+        let endDate = formData.date;
+        if (formData.end_time <= formData.start_time) {
+          const next = new Date(`${formData.date}T00:00:00Z`);
+          next.setUTCDate(next.getUTCDate() + 1);
+          endDate = next.toISOString().slice(0, 10);
+        }
+        endsAt = `${endDate}T${formData.end_time}`;
+      }
+
       await gigsAPI.create({
         title: formData.title,
         description: formData.description,
-        venue_name: formData.venue_name,
-        venue_address: formData.venue_address,
-        latitude: formData.latitude,
-        longitude: formData.longitude,
-        date: formData.date,
-        start_time: formData.start_time,
-        end_time: formData.end_time || undefined,
+        // Matched against venues already listed nearby before a new one
+        // is added.
+        venue: {
+          name: formData.venue_name,
+          address: formData.venue_address,
+          latitude: formData.latitude,
+          longitude: formData.longitude,
+        },
+        starts_at: `${formData.date}T${formData.start_time}`,
+        ends_at: endsAt,
+        timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+        status: "published",
         price: price,
         genres: genresArray,
       });
@@ -30,8 +30,8 @@ export default function Home() {
   const fetchGigs = async () => {
     try {
       setLoading(true);
-      const data = await gigsAPI.getAll();
-      setGigs(data);
+      const page = await gigsAPI.getAll({ limit: 100 });
+      setGigs(page.data);
     } catch (err) {
       console.error("Failed to fetch gigs:", err);
       setError("Failed to load gigs. Please try again.");
@@ -84,47 +84,47 @@ export default function Home() {
           </button>
         </div>
 
-        {loading && (
-          <div className="flex justify-center items-center py-12">
-            <Loader2 className="w-8 h-8 animate-spin text-gray-600" />
+        {viewMode === "map" ? (
+          // The map loads the gigs in view itself, clustered by the server.
+          <div className="h-[600px] mb-12">
+            <GigMap
+              center={{
+                lat: parseFloat(
+                  process.env.NEXT_PUBLIC_MAP_CENTER_LAT || "-6.2088"
+                ),
+                lng: parseFloat(
+                  process.env.NEXT_PUBLIC_MAP_CENTER_LNG || "106.8456"
+                ),
+              }}
+            />
           </div>
-        )}
+        ) : (
+          <>
+            {loading && (
+              <div className="flex justify-center items-center py-12">
+                <Loader2 className="w-8 h-8 animate-spin text-gray-600" />
+              </div>
+            )}
 
-        {error && (
-          <div className="bg-red-50 border border-red-200 rounded-lg p-4 text-red-700">
-            {error}
-          </div>
-        )}
+            {error && (
+              <div className="bg-red-50 border border-red-200 rounded-lg p-4 text-red-700">
+                {error}
+              </div>
+            )}
 
-        {!loading && !error && gigs.length === 0 && (
-          <div className="text-center py-12">
-            <p className="text-gray-500 text-lg mb-4">Lagi gaada nih.</p>
-            <p className="text-red-300">Check back later for new events!</p>
-          </div>
-        )}
+            {!loading && !error && gigs.length === 0 && (
+              <div className="text-center py-12">
+                <p className="text-gray-500 text-lg mb-4">Lagi gaada nih.</p>
+                <p className="text-red-300">Check back later for new events!</p>
+              </div>
+            )}
 
-        {!loading && !error && gigs.length > 0 && (
-          <>
-            {viewMode === "list" ? (
+            {!loading && !error && gigs.length > 0 && (
               <div className="grid grid-cols-1 sm:grid-cols-2 lg:grid-cols-3 gap-6">
                 {gigs.map((gig) => (
                   <GigCard key={gig.id} gig={gig} />
                 ))}
               </div>
-            ) : (
-              <div className="h-[600px] mb-12">
-                <GigMap
-                  gigs={gigs}
-                  center={{
-                    lat: parseFloat(
-                      process.env.NEXT_PUBLIC_MAP_CENTER_LAT || "-6.2088"
-                    ),
-                    lng: parseFloat(
-                      process.env.NEXT_PUBLIC_MAP_CENTER_LNG || "106.8456"
-                    ),
-                  }}
-                />
-              </div>
             )}
           </>
         )}
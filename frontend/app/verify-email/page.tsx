@@ -0,0 +1,78 @@
+"use client";
+
+import { Suspense, useEffect, useState } from "react";
+import { useSearchParams } from "next/navigation";
+import Link from "next/link";
+import { authAPI } from "../../lib/api";
+import { Loader2 } from "lucide-react";
+
+function VerifyEmail() {
+  const token = useSearchParams().get("token");
+  const [status, setStatus] = useState<"verifying" | "verified" | "failed">(
+    "verifying"
+  );
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    if (!token) {
+      setStatus("failed");
+      setError("This link is missing its verification token.");
+      return;
+    }
+    authAPI
+      .verifyEmail(token)
+      .then(() => setStatus("verified"))
+      .catch((err: any) => {
+        setStatus("failed");
+        setError(
+          err.response?.data?.error || "Failed to verify. Please try again."
+        );
+      });
+  }, [token]);
+
+  return (
+    <div className="bg-[#1a1a1a] rounded-lg p-8 border border-[#2a2a2a]">
+      <h1 className="text-2xl font-bold text-[var(--fg)] mb-6">
+        Verify email
+      </h1>
+
+      {status === "verifying" && (
+        <p className="text-gray-400 flex items-center gap-2">
+          <Loader2 className="w-5 h-5 animate-spin" />
+          Verifying...
+        </p>
+      )}
+
+      {status === "verified" && (
+        <p className="text-gray-300">Your email address is verified.</p>
+      )}
+
+      {status === "failed" && (
+        <div className="bg-red-900/20 border border-red-300/30 rounded-lg p-3">
+          <p className="text-red-300 text-sm">{error}</p>
+        </div>
+      )}
+
+      <div className="mt-6 text-center">
+        <Link
+          href="/"
+          className="text-red-300 hover:text-red-200 font-medium transition"
+        >
+          Back to gigs
+        </Link>
+      </div>
+    </div>
+  );
+}
+
+export default function VerifyEmailPage() {
+  return (
+    <div className="min-h-screen flex items-center justify-center px-4">
+      <div className="max-w-md w-full">
+        <Suspense>
+          <VerifyEmail />
+        </Suspense>
+      </div>
+    </div>
+  );
+}
@@ -15,6 +15,14 @@ export default function GigCard({ gig }: GigCardProps) {
     return `Rp ${price.toLocaleString("id-ID")}`;
   };
 
+  const statusBanner: Record<string, string> = {
+    draft: "Draft",
+    cancelled: "Cancelled",
+    postponed: "Postponed",
+    rescheduled: "Rescheduled",
+  };
+  const banner = statusBanner[gig.status];
+
   const formatDate = (dateStr: string) => {
     try {
       return format(new Date(dateStr), "EEE, MMM d, yyyy");
@@ -30,7 +38,7 @@ export default function GigCard({ gig }: GigCardProps) {
       <div className="h-40 bg-gradient-to-br from-red-900/20 to-red-300/10 relative overflow-hidden">
         {gig.image_url ? (
           <img
-            src={gig.image_url}
+            src={gig.image_thumbnails?.medium ?? gig.image_url}
             alt={gig.title}
             className="w-full h-full object-cover group-hover:scale-105 transition-transform duration-300"
           />
@@ -42,6 +50,25 @@ export default function GigCard({ gig }: GigCardProps) {
           </div>
         )}
 
+        {/* Status */}
+        {banner && (
+          <div
+            className={`absolute bottom-0 inset-x-0 px-3 py-1.5 text-xs font-semibold uppercase tracking-wide ${
+              gig.status === "cancelled"
+                ? "bg-red-900/90 text-red-100"
+                : "bg-[#121212]/90 text-red-300"
+            }`}
+            title={gig.status_reason ?? undefined}
+          >
+            {banner}
+            {gig.status_reason && (
+              <span className="ml-2 font-normal normal-case tracking-normal text-gray-300">
+                {gig.status_reason}
+              </span>
+            )}
+          </div>
+        )}
+
         {/* Genres */}
         {gig.genres && gig.genres.length > 0 && (
           <div className="absolute top-3 left-3 flex gap-2 flex-wrap">
@@ -1,9 +1,23 @@
 "use client";
 
-import { useEffect } from "react";
-import { MapContainer, TileLayer, Marker, Popup, useMap } from "react-leaflet";
+import { useCallback, useEffect, useRef, useState } from "react";
+import {
+  MapContainer,
+  TileLayer,
+  Marker,
+  Popup,
+  useMap,
+  useMapEvents,
+} from "react-leaflet";
 import L from "leaflet";
-import type { Gig } from "../types";
+import { gigsAPI } from "../lib/api";
+import type {
+  GigClusterProperties,
+  GigFeature,
+  GigFeatureCollection,
+  GigFilter,
+  GigPointProperties,
+} from "../types";
 import Link from "next/link";
 import { Calendar, MapPin } from "lucide-react";
 import { format } from "date-fns";
@@ -40,29 +54,120 @@ const createCustomIcon = () => {
   });
 };
 
+const createClusterIcon = (count: number) => {
+  const size = count < 10 ? 32 : count < 100 ? 40 : 48;
+  return L.divIcon({
+    className: "custom-marker",
+    html: `
+      <div style="
+        width: ${size}px;
+        height: ${size}px;
+        display: flex;
+        align-items: center;
+        justify-content: center;
+        background: #991b1b;
+        border: 3px solid #fca5a5;
+        border-radius: 50%;
+        box-shadow: 0 2px 8px rgba(0,0,0,0.3);
+        color: #fff;
+        font-size: 12px;
+        font-weight: 700;
+      ">${count}</div>
+    `,
+    iconSize: [size, size],
+    iconAnchor: [size / 2, size / 2],
+  });
+};
+
 interface GigMapProps {
-  gigs: Gig[];
+  // Narrows the gigs shown, e.g. to one genre. The viewport is added to it.
+  filter?: GigFilter;
   center?: { lat: number; lng: number };
-  onGigClick?: (gig: Gig) => void;
+  onGigClick?: (gig: GigPointProperties) => void;
 }
 
-// Component to fit bounds when gigs change
-function MapBounds({ gigs }: { gigs: Gig[] }) {
+// Fetches the clustered gigs in view whenever the map settles, so zoomed
+// out the server sends a few clusters rather than every gig.
+function ViewportGigs({
+  filter,
+  onLoad,
+}: {
+  filter?: GigFilter;
+  onLoad: (collection: GigFeatureCollection) => void;
+}) {
   const map = useMap();
+  // Only the latest request may update the map; earlier ones may land late.
+  const latest = useRef(0);
 
-  useEffect(() => {
-    if (gigs.length > 0) {
-      const bounds = L.latLngBounds(
-        gigs.map((gig) => [gig.latitude, gig.longitude])
-      );
-      map.fitBounds(bounds, { padding: [50, 50], maxZoom: 14 });
+  const load = useCallback(async () => {
+    const request = ++latest.current;
+    const bounds = map.getBounds();
+    // Leaflet lets longitudes run past ±180 as the map wraps; the server
+    // takes min_lng > max_lng as a viewport across the antimeridian.
+    const wide = bounds.getEast() - bounds.getWest() >= 360;
+    const wrap = (lng: number) => L.Util.wrapNum(lng, [-180, 180], true);
+    try {
+      const collection = await gigsAPI.getMap({
+        ...filter,
+        min_lat: Math.max(bounds.getSouth(), -90),
+        max_lat: Math.min(bounds.getNorth(), 90),
+        min_lng: wide ? -180 : wrap(bounds.getWest()),
+        max_lng: wide ? 180 : wrap(bounds.getEast()),
+        zoom: Math.round(map.getZoom()),
+      });
+      if (request === latest.current) onLoad(collection);
+    } catch (err) {
+      console.error("Failed to fetch map gigs:", err);
     }
-  }, [gigs, map]);
+  }, [map, filter, onLoad]);
+
+  useEffect(() => {
+    load();
+  }, [load]);
+
+  useMapEvents({ moveend: load });
 
   return null;
 }
 
-export default function GigMap({ gigs, center, onGigClick }: GigMapProps) {
+function ClusterMarker({ feature }: { feature: GigFeature }) {
+  const map = useMap();
+  const [lng, lat] = feature.geometry.coordinates;
+  const count = (feature.properties as GigClusterProperties).point_count;
+
+  return (
+    <Marker
+      position={[lat, lng]}
+      icon={createClusterIcon(count)}
+      eventHandlers={{
+        click: () => {
+          if (feature.bbox) {
+            const [west, south, east, north] = feature.bbox;
+            map.fitBounds(
+              [
+                [south, west],
+                [north, east],
+              ],
+              { padding: [50, 50] }
+            );
+          } else {
+            map.setView([lat, lng], map.getZoom() + 2);
+          }
+        },
+      }}
+    />
+  );
+}
+
+export default function GigMap({ filter, center, onGigClick }: GigMapProps) {
+  const [features, setFeatures] = useState<GigFeature[]>([]);
+  const [truncated, setTruncated] = useState(false);
+
+  const handleLoad = useCallback((collection: GigFeatureCollection) => {
+    setFeatures(collection.features);
+    setTruncated(collection.truncated);
+  }, []);
+
   const formatDate = (dateStr: string) => {
     try {
       return format(new Date(dateStr), "MMM d, yyyy");
@@ -76,7 +181,7 @@ export default function GigMap({ gigs, center, onGigClick }: GigMapProps) {
     : [-6.2088, 106.8456]; // Jakarta center
 
   return (
-    <div className="w-full h-full rounded-lg overflow-hidden border border-[#2a2a2a] ">
+    <div className="relative w-full h-full rounded-lg overflow-hidden border border-[#2a2a2a] ">
       <MapContainer
         center={defaultCenter}
         zoom={12}
@@ -88,50 +193,63 @@ export default function GigMap({ gigs, center, onGigClick }: GigMapProps) {
           attribution='&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors &copy; <a href="https://carto.com/attributions">CARTO</a>'
         />
 
-        {gigs.length > 0 && <MapBounds gigs={gigs} />}
-
-        {gigs.map((gig) => (
-          <Marker
-            key={gig.id}
-            position={[gig.latitude, gig.longitude]}
-            icon={createCustomIcon()}
-            eventHandlers={{
-              click: () => {
-                if (onGigClick) onGigClick(gig);
-              },
-            }}
-          >
-            <Popup className="custom-popup" maxWidth={250}>
-              <div className="bg-[#1a1a1a] p-3 rounded-lg -m-3">
-                <h3 className="font-bold text-[var(--fg)] mb-2 text-base">
-                  {gig.title}
-                </h3>
-
-                <div className="space-y-1.5 mb-3">
-                  <div className="flex items-center gap-2 text-xs text-gray-400">
-                    <Calendar className="w-3.5 h-3.5 text-red-300/60" />
-                    <span>{formatDate(gig.date)}</span>
-                  </div>
-                  <div className="flex items-center gap-2 text-xs text-gray-400">
-                    <MapPin className="w-3.5 h-3.5 text-red-300/60" />
-                    <span>{gig.venue_name}</span>
+        <ViewportGigs filter={filter} onLoad={handleLoad} />
+
+        {features.map((feature) => {
+          if (feature.properties.cluster) {
+            return <ClusterMarker key={feature.id} feature={feature} />;
+          }
+          const gig = feature.properties;
+          const [lng, lat] = feature.geometry.coordinates;
+          return (
+            <Marker
+              key={feature.id}
+              position={[lat, lng]}
+              icon={createCustomIcon()}
+              eventHandlers={{
+                click: () => {
+                  if (onGigClick) onGigClick(gig);
+                },
+              }}
+            >
+              <Popup className="custom-popup" maxWidth={250}>
+                <div className="bg-[#1a1a1a] p-3 rounded-lg -m-3">
+                  <h3 className="font-bold text-[var(--fg)] mb-2 text-base">
+                    {gig.title}
+                  </h3>
+
+                  <div className="space-y-1.5 mb-3">
+                    <div className="flex items-center gap-2 text-xs text-gray-400">
+                      <Calendar className="w-3.5 h-3.5 text-red-300/60" />
+                      <span>{formatDate(gig.date)}</span>
+                    </div>
+                    <div className="flex items-center gap-2 text-xs text-gray-400">
+                      <MapPin className="w-3.5 h-3.5 text-red-300/60" />
+                      <span>{gig.venue_name}</span>
+                    </div>
                   </div>
-                </div>
 
-                {/* <Link
-                  href={`/gigs/${gig.id}`}
-                  className="block text-center bg-[#262626] py-2 px-3 rounded hover:bg-[#1e1e1e] hover:transform-[scale(1.05)] 
-                  transition duration-300 ease"
-                >
-                  <span className="text-sm font-semibold text-red-300">
-                    View Details
-                  </span>
-                </Link> */}
-              </div>
-            </Popup>
-          </Marker>
-        ))}
+                  {/* <Link
+                    href={`/gigs/${gig.id}`}
+                    className="block text-center bg-[#262626] py-2 px-3 rounded hover:bg-[#1e1e1e] hover:transform-[scale(1.05)] 
+                    transition duration-300 ease"
+                  >
+                    <span className="text-sm font-semibold text-red-300">
+                      View Details
+                    </span>
+                  </Link> */}
+                </div>
+              </Popup>
+            </Marker>
+          );
+        })}
       </MapContainer>
+
+      {truncated && (
+        <div className="absolute top-3 left-1/2 -translate-x-1/2 z-[1000] bg-[#1a1a1a]/90 border border-[#2a2a2a] rounded-lg px-3 py-1.5 text-xs text-gray-300">
+          Too many gigs to show here; zoom in to see them all.
+        </div>
+      )}
     </div>
   );
 }
@@ -45,7 +45,7 @@ export default function Header() {
                 </Link>
 
                 <button
-                  onClick={logout}
+                  onClick={() => logout()}
                   className="flex items-center gap-2 text-white hover:text-red-300 hover:cursor-pointer transition"
                 >
                   <LogOut className="w-5 h-5" />
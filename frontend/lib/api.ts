@@ -1,11 +1,34 @@
 import axios from "axios";
+import type { InternalAxiosRequestConfig } from "axios";
 import type {
   User,
+  PublicUser,
+  UserProfile,
   Gig,
   CreateGigInput,
+  RescheduleGigInput,
+  GigInput,
+  GigPatch,
+  GigPatchResponse,
+  GigRevision,
+  GigDiff,
+  GigFilter,
+  GigListResponse,
+  NearbyGigFilter,
+  MapGigFilter,
+  GigFeatureCollection,
   LoginInput,
   RegisterInput,
+  ChangePasswordInput,
   AuthResponse,
+  Session,
+  Venue,
+  VenueInput,
+  VenueFilter,
+  Artist,
+  ArtistInput,
+  ArtistFilter,
+  Genre,
 } from "@/types";
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL || "http://localhost:8080";
@@ -26,6 +49,64 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Stores the tokens from signing in or refreshing.
+export function saveTokens(auth: AuthResponse) {
+  localStorage.setItem("token", auth.token);
+  localStorage.setItem("refresh_token", auth.refresh_token);
+}
+
+export function clearTokens() {
+  localStorage.removeItem("token");
+  localStorage.removeItem("refresh_token");
+}
+
+let refreshing: Promise<string | null> | null = null;
+
+// A refresh token works only once, and the server revokes the session if
+// it sees one twice, so concurrent 401s share a single refresh.
+function refreshAccessToken(): Promise<string | null> {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = localStorage.getItem("refresh_token");
+      if (!refreshToken) {
+        return null;
+      }
+      try {
+        const response = await axios.post<AuthResponse>(`${API_URL}/api/auth/refresh`, {
+          refresh_token: refreshToken,
+        });
+        saveTokens(response.data);
+        return response.data.token;
+      } catch {
+        clearTokens();
+        return null;
+      } finally {
+        refreshing = null;
+      }
+    })();
+  }
+  return refreshing;
+}
+
+// Retry a request that failed with an expired access token once, after
+// refreshing it.
+api.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config as (InternalAxiosRequestConfig & { retried?: boolean }) | undefined;
+    const isSignIn = original?.url === "/api/auth/login" || original?.url === "/api/auth/register";
+    if (error.response?.status === 401 && original && !original.retried && !isSignIn) {
+      original.retried = true;
+      const token = await refreshAccessToken();
+      if (token) {
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      }
+    }
+    return Promise.reject(error);
+  }
+);
+
 // Auth API
 export const authAPI = {
   register: async (data: RegisterInput): Promise<AuthResponse> => {
@@ -42,12 +123,66 @@ export const authAPI = {
     const response = await api.get("/api/auth/me");
     return response.data;
   },
+
+  // Ends this session, or with everywhere every session of the user.
+  logout: async (everywhere = false): Promise<void> => {
+    await api.post("/api/auth/logout", null, { params: everywhere ? { all: true } : {} });
+  },
+
+  getSessions: async (): Promise<Session[]> => {
+    const response = await api.get("/api/auth/sessions");
+    return response.data;
+  },
+
+  revokeSession: async (id: string): Promise<void> => {
+    await api.delete(`/api/auth/sessions/${id}`);
+  },
+
+  // Access tokens record whether the email was verified when they were
+  // issued, so a signed-in user gets a fresh one afterwards.
+  verifyEmail: async (token: string): Promise<User> => {
+    const response = await api.post("/api/auth/verify-email", { token });
+    if (localStorage.getItem("refresh_token")) {
+      await refreshAccessToken();
+    }
+    return response.data;
+  },
+
+  // Fails with 429 and a Retry-After header if a link was sent recently.
+  resendVerification: async (): Promise<void> => {
+    await api.post("/api/auth/verify-email/resend");
+  },
+
+  // Succeeds whether or not an account uses the email.
+  forgotPassword: async (email: string): Promise<void> => {
+    await api.post("/api/auth/forgot-password", { email });
+  },
+
+  // Signs the account out everywhere; the user logs in with the new password.
+  resetPassword: async (token: string, password: string): Promise<void> => {
+    await api.post("/api/auth/reset-password", { token, password });
+  },
+
+  // Signs out every other session.
+  changePassword: async (data: ChangePasswordInput): Promise<void> => {
+    await api.post("/api/auth/change-password", data);
+  },
 };
 
 // Gigs API
 export const gigsAPI = {
-  getAll: async (): Promise<Gig[]> => {
-    const response = await api.get("/api/gigs");
+  getAll: async (filter: GigFilter = {}): Promise<GigListResponse> => {
+    const response = await api.get("/api/gigs", { params: filter });
+    return response.data;
+  },
+
+  getNearby: async (filter: NearbyGigFilter): Promise<Gig[]> => {
+    const response = await api.get("/api/gigs/nearby", { params: filter });
+    return response.data;
+  },
+
+  getMap: async (filter: MapGigFilter): Promise<GigFeatureCollection> => {
+    const response = await api.get("/api/gigs/map", { params: filter });
     return response.data;
   },
 
@@ -61,32 +196,219 @@ export const gigsAPI = {
     return response.data;
   },
 
-  update: async (id: string, data: Partial<CreateGigInput>): Promise<Gig> => {
-    const response = await api.put(`/api/gigs/${id}`, data);
+  // Writes take the version the caller last saw and fail with 412 if the
+  // gig has changed since.
+
+  // update sends a merge patch, so only the given fields change.
+  update: async (
+    id: string,
+    version: number,
+    patch: GigPatch
+  ): Promise<GigPatchResponse> => {
+    const response = await api.patch(`/api/gigs/${id}`, patch, {
+      headers: {
+        "Content-Type": "application/merge-patch+json",
+        "If-Match": gigETag(version),
+      },
+    });
     return response.data;
   },
 
-  delete: async (id: string): Promise<void> => {
-    await api.delete(`/api/gigs/${id}`);
+  replace: async (id: string, version: number, data: GigInput): Promise<Gig> => {
+    const response = await api.put(`/api/gigs/${id}`, data, {
+      headers: { "If-Match": gigETag(version) },
+    });
+    return response.data;
+  },
+
+  delete: async (id: string, version: number): Promise<void> => {
+    await api.delete(`/api/gigs/${id}`, {
+      headers: { "If-Match": gigETag(version) },
+    });
   },
 
   getByOrganizer: async (organizerId: string): Promise<Gig[]> => {
     const response = await api.get(`/api/gigs/organizer/${organizerId}`);
     return response.data;
   },
+
+  publish: async (id: string): Promise<Gig> => {
+    const response = await api.post(`/api/gigs/${id}/publish`);
+    return response.data;
+  },
+
+  cancel: async (id: string, reason: string): Promise<Gig> => {
+    const response = await api.post(`/api/gigs/${id}/cancel`, { reason });
+    return response.data;
+  },
+
+  postpone: async (id: string, reason?: string): Promise<Gig> => {
+    const response = await api.post(`/api/gigs/${id}/postpone`, { reason });
+    return response.data;
+  },
+
+  reschedule: async (id: string, data: RescheduleGigInput): Promise<Gig> => {
+    const response = await api.post(`/api/gigs/${id}/reschedule`, data);
+    return response.data;
+  },
+
+  uploadImage: async (id: string, version: number, image: File): Promise<Gig> => {
+    const form = new FormData();
+    form.append("image", image);
+    const response = await api.post(`/api/gigs/${id}/image`, form, {
+      headers: {
+        "Content-Type": "multipart/form-data",
+        "If-Match": gigETag(version),
+      },
+    });
+    return response.data;
+  },
+
+  getRevisions: async (id: string): Promise<GigRevision[]> => {
+    const response = await api.get(`/api/gigs/${id}/revisions`);
+    return response.data;
+  },
+
+  getRevision: async (id: string, version: number): Promise<GigRevision> => {
+    const response = await api.get(`/api/gigs/${id}/revisions/${version}`);
+    return response.data;
+  },
+
+  diffRevisions: async (id: string, from: number, to: number): Promise<GigDiff> => {
+    const response = await api.get(`/api/gigs/${id}/revisions/diff`, {
+      params: { from, to },
+    });
+    return response.data;
+  },
+
+  restoreRevision: async (
+    id: string,
+    revision: number,
+    currentVersion: number
+  ): Promise<GigPatchResponse> => {
+    const response = await api.post(`/api/gigs/${id}/revisions/${revision}/restore`, null, {
+      headers: { "If-Match": gigETag(currentVersion) },
+    });
+    return response.data;
+  },
+};
+
+// gigETag is the ETag the API sends for a gig version.
+function gigETag(version: number): string {
+  return `"${version}"`;
+}
+
+// Venues API
+export const venuesAPI = {
+  search: async (filter: VenueFilter = {}): Promise<Venue[]> => {
+    const response = await api.get("/api/venues", { params: filter });
+    return response.data;
+  },
+
+  getById: async (id: string): Promise<Venue> => {
+    const response = await api.get(`/api/venues/${id}`);
+    return response.data;
+  },
+
+  getGigs: async (id: string, filter: GigFilter = {}): Promise<GigListResponse> => {
+    const response = await api.get(`/api/venues/${id}/gigs`, { params: filter });
+    return response.data;
+  },
+
+  // create fails with 409 duplicate_venue when a similar venue is nearby.
+  create: async (data: VenueInput): Promise<Venue> => {
+    const response = await api.post("/api/venues", data);
+    return response.data;
+  },
+
+  update: async (id: string, data: VenueInput): Promise<Venue> => {
+    const response = await api.put(`/api/venues/${id}`, data);
+    return response.data;
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await api.delete(`/api/venues/${id}`);
+  },
+};
+
+// Artists API
+export const artistsAPI = {
+  search: async (filter: ArtistFilter = {}): Promise<Artist[]> => {
+    const response = await api.get("/api/artists", { params: filter });
+    return response.data;
+  },
+
+  getById: async (id: string): Promise<Artist> => {
+    const response = await api.get(`/api/artists/${id}`);
+    return response.data;
+  },
+
+  getGigs: async (id: string, filter: GigFilter = {}): Promise<GigListResponse> => {
+    const response = await api.get(`/api/artists/${id}/gigs`, { params: filter });
+    return response.data;
+  },
+
+  create: async (data: ArtistInput): Promise<Artist> => {
+    const response = await api.post("/api/artists", data);
+    return response.data;
+  },
+
+  update: async (id: string, data: ArtistInput): Promise<Artist> => {
+    const response = await api.put(`/api/artists/${id}`, data);
+    return response.data;
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await api.delete(`/api/artists/${id}`);
+  },
+};
+
+// Genres API
+export const genresAPI = {
+  list: async (): Promise<Genre[]> => {
+    const response = await api.get("/api/genres");
+    return response.data;
+  },
 };
 
 // Users API
 export const usersAPI = {
-  getById: async (id: string): Promise<User> => {
+  getById: async (id: string): Promise<PublicUser> => {
     const response = await api.get(`/api/users/${id}`);
     return response.data;
   },
 
-  update: async (id: string, data: Partial<User>): Promise<User> => {
+  getProfile: async (id: string): Promise<UserProfile> => {
+    const response = await api.get(`/api/users/${id}/profile`);
+    return response.data;
+  },
+
+  update: async (
+    id: string,
+    data: Partial<Pick<User, "username" | "bio" | "profile_image">>
+  ): Promise<User> => {
     const response = await api.put(`/api/users/${id}`, data);
     return response.data;
   },
+
+  uploadProfileImage: async (id: string, image: File): Promise<User> => {
+    const form = new FormData();
+    form.append("image", image);
+    const response = await api.post(`/api/users/${id}/profile-image`, form, {
+      headers: { "Content-Type": "multipart/form-data" },
+    });
+    return response.data;
+  },
+};
+
+// Admin API
+export const adminAPI = {
+  // Lifts the sign-in lock on an email, an address, or both, and returns
+  // how many failed attempts that forgave.
+  clearLoginLock: async (lock: { email?: string; ip?: string }): Promise<number> => {
+    const response = await api.delete("/api/admin/login-locks", { params: lock });
+    return response.data.cleared;
+  },
 };
 
 export default api;
@@ -1,7 +1,7 @@
 "use client";
 
 import React, { createContext, useContext, useState, useEffect } from "react";
-import { authAPI } from "./api";
+import { authAPI, saveTokens, clearTokens } from "./api";
 import type { User } from "@/types";
 
 interface AuthContextType {
@@ -14,7 +14,7 @@ interface AuthContextType {
     password: string,
     role: "user" | "organizer"
   ) => Promise<void>;
-  logout: () => void;
+  logout: (everywhere?: boolean) => Promise<void>;
   loading: boolean;
   isOrganizer: boolean;
 }
@@ -43,7 +43,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
       setUser(currentUser);
     } catch (error) {
       console.error("Failed to fetch user:", error);
-      localStorage.removeItem("token");
+      clearTokens();
       setToken(null);
     } finally {
       setLoading(false);
@@ -54,7 +54,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     const response = await authAPI.login({ email, password });
     setToken(response.token);
     setUser(response.user);
-    localStorage.setItem("token", response.token);
+    saveTokens(response);
   };
 
   const register = async (
@@ -71,13 +71,19 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     });
     setToken(response.token);
     setUser(response.user);
-    localStorage.setItem("token", response.token);
+    saveTokens(response);
   };
 
-  const logout = () => {
+  // Signing out locally must not depend on the server being reachable.
+  const logout = async (everywhere = false) => {
+    try {
+      await authAPI.logout(everywhere);
+    } catch (error) {
+      console.error("Failed to end session:", error);
+    }
     setUser(null);
     setToken(null);
-    localStorage.removeItem("token");
+    clearTokens();
   };
 
   const isOrganizer = user?.role === "organizer";
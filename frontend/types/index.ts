@@ -1,4 +1,5 @@
-export type UserRole = "user" | "organizer";
+// Admins are made from the command line; nobody registers as one.
+export type UserRole = "user" | "organizer" | "admin";
 
 export interface User {
   id: string;
@@ -7,43 +8,294 @@ export interface User {
   role: UserRole;
   bio?: string;
   profile_image?: string;
+  // Null until the user follows the link mailed to them.
+  email_verified_at: string | null;
   created_at: string;
 }
 
+export interface PublicUser {
+  id: string;
+  username: string;
+  role: UserRole;
+  bio?: string;
+  profile_image?: string;
+  created_at: string;
+}
+
+export type GigStatus =
+  | "draft"
+  | "published"
+  | "cancelled"
+  | "postponed"
+  | "rescheduled";
+
+// Downscaled copies of a gig's image: small is 320px wide, medium 960px.
+export interface GigImageThumbnails {
+  small: string;
+  medium: string;
+}
+
+export interface Venue {
+  id: string;
+  name: string;
+  address: string;
+  latitude: number;
+  longitude: number;
+  // The organizer who added the venue and may edit it.
+  created_by: string | null;
+  distance_km?: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface VenueInput {
+  name: string;
+  address: string;
+  latitude: number;
+  longitude: number;
+}
+
+export interface VenueFilter {
+  q?: string;
+  lat?: number;
+  lng?: number;
+  radius_km?: number;
+  limit?: number;
+}
+
+export interface Artist {
+  id: string;
+  name: string;
+  bio: string | null;
+  // The organizer who added the artist and may edit it.
+  created_by: string | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ArtistInput {
+  name: string;
+  bio?: string | null;
+}
+
+export interface ArtistFilter {
+  q?: string;
+  limit?: number;
+}
+
+// A canonical genre. Gigs carry genre slugs; names and aliases sent on
+// write ("Hip Hop", "rap") are resolved to them.
+export interface Genre {
+  slug: string;
+  name: string;
+  // The broader genre, e.g. "rock" for shoegaze. Filtering by a genre
+  // includes its sub-genres.
+  parent: string | null;
+  upcoming_gigs: number;
+}
+
+// One artist on a gig's bill; position 1 is the headliner. Set times carry
+// the gig's local offset.
+export interface LineupSlot {
+  artist_id: string;
+  artist_name: string;
+  position: number;
+  set_starts_at: string | null;
+  set_ends_at: string | null;
+}
+
+// A lineup entry as sent: the bill follows the array order and set times
+// are local date-times (YYYY-MM-DDTHH:MM) in the gig's timezone.
+export interface LineupSlotInput {
+  artist_id: string;
+  set_starts_at?: string | null;
+  set_ends_at?: string | null;
+}
+
 export interface Gig {
   id: string;
   title: string;
   description: string;
+  // The venue fields below are read from the venue.
+  venue_id: string;
   venue_name: string;
   venue_address: string;
   latitude: number;
   longitude: number;
+  // starts_at/ends_at carry the gig's local offset; the *_utc forms are in
+  // UTC. date, start_time and end_time are local wall-clock values, so an
+  // overnight show has an end_time earlier than its start_time.
+  starts_at: string;
+  starts_at_utc: string;
+  ends_at?: string;
+  ends_at_utc?: string;
+  timezone: string;
   date: string;
   start_time: string;
   end_time?: string;
   price?: number;
   image_url?: string;
+  image_thumbnails?: GigImageThumbnails | null;
   organizer_id: string;
-  organizer?: User;
-  genres?: string[];
+  organizer?: PublicUser;
+  // Genre slugs, see Genre.
+  genres: string[];
+  lineup: LineupSlot[];
+  status: GigStatus;
+  status_reason?: string | null;
+  status_changed_at?: string | null;
+  rescheduled_from?: string | null;
+  // Sent back as If-Match when editing or deleting the gig.
+  version: number;
+  distance_km?: number;
   created_at: string;
   updated_at: string;
 }
 
-export interface CreateGigInput {
+// The organizer-editable fields, as sent with PUT.
+export interface GigInput {
   title: string;
   description: string;
+  venue_id: string;
+  // Local date-times (YYYY-MM-DDTHH:MM) in the IANA timezone.
+  starts_at: string;
+  ends_at?: string;
+  timezone: string;
+  price?: number;
+  genres?: string[];
+  lineup?: LineupSlotInput[];
+}
+
+// A new gig names an existing venue by venue_id or describes it in venue,
+// which reuses a nearby venue with a similar name if there is one.
+export interface CreateGigInput extends Omit<GigInput, "venue_id"> {
+  venue_id?: string;
+  venue?: VenueInput;
+  // Defaults to draft.
+  status?: "draft" | "published";
+}
+
+// A JSON merge patch: absent fields are kept and null clears a field.
+export type GigPatch = { [K in keyof GigInput]?: GigInput[K] | null };
+
+export interface FieldChange {
+  field: string;
+  from: unknown;
+  to: unknown;
+}
+
+export interface GigPatchResponse {
+  gig: Gig;
+  changes: FieldChange[];
+}
+
+export type GigRevisionAction = "created" | "updated" | "restored" | GigStatus;
+
+export interface GigRevision {
+  id: string;
+  gig_id: string;
+  version: number;
+  action: GigRevisionAction;
+  editor_id: string | null;
+  restored_from: number | null;
+  snapshot: GigInput & { status: GigStatus; status_reason: string | null };
+  changes: FieldChange[];
+  created_at: string;
+  editor?: PublicUser;
+}
+
+export interface GigDiff {
+  from: number;
+  to: number;
+  changes: FieldChange[];
+}
+
+export interface RescheduleGigInput {
+  starts_at: string;
+  ends_at?: string;
+  timezone?: string;
+  reason?: string;
+}
+
+export interface UserProfile {
+  user: PublicUser;
+  upcoming_gigs: Gig[];
+}
+
+export interface GigFilter {
+  date_from?: string;
+  date_to?: string;
+  genre?: string;
+  price_min?: number;
+  price_max?: number;
+  organizer_id?: string;
+  venue_id?: string;
+  artist_id?: string;
+  // Matches gigs billing an artist whose name contains it.
+  artist?: string;
+  status?: GigStatus;
+  upcoming?: boolean;
+  cursor?: string;
+  limit?: number;
+}
+
+export interface NearbyGigFilter extends GigFilter {
+  lat: number;
+  lng: number;
+  radius_km?: number;
+  sort?: "distance" | "date";
+}
+
+export interface MapGigFilter extends GigFilter {
+  min_lat: number;
+  min_lng: number;
+  max_lat: number;
+  max_lng: number;
+  zoom: number;
+}
+
+export interface GigClusterProperties {
+  cluster: true;
+  point_count: number;
+}
+
+export interface GigPointProperties {
+  cluster: false;
+  id: string;
+  title: string;
   venue_name: string;
-  venue_address: string;
-  latitude: number;
-  longitude: number;
+  starts_at: string;
+  timezone: string;
   date: string;
   start_time: string;
-  end_time?: string;
+  status: GigStatus;
   price?: number;
+  image_url?: string;
   genres?: string[];
 }
 
+export interface GigFeature {
+  type: "Feature";
+  id: string;
+  bbox?: [number, number, number, number];
+  geometry: { type: "Point"; coordinates: [number, number] };
+  properties: GigClusterProperties | GigPointProperties;
+}
+
+export interface GigFeatureCollection {
+  type: "FeatureCollection";
+  features: GigFeature[];
+  // Set when the viewport held more gigs than the server clusters; only the
+  // latest are included.
+  truncated: boolean;
+}
+
+export interface GigListResponse {
+  data: Gig[];
+  next_cursor: string | null;
+  total: number;
+}
+
 export interface LoginInput {
   email: string;
   password: string;
@@ -53,10 +305,30 @@ export interface RegisterInput {
   username: string;
   email: string;
   password: string;
-  role: UserRole;
+  role: Exclude<UserRole, "admin">;
 }
 
+export interface ChangePasswordInput {
+  current_password: string;
+  new_password: string;
+}
+
+// token is a short-lived access token. refresh_token renews it through
+// authAPI.refresh, once: every refresh returns a new one.
 export interface AuthResponse {
   token: string;
+  expires_at: string;
+  refresh_token: string;
   user: User;
 }
+
+// A signed-in device. current marks the one making the request.
+export interface Session {
+  id: string;
+  user_agent: string;
+  ip_address: string;
+  created_at: string;
+  last_used_at: string;
+  expires_at: string;
+  current: boolean;
+}